@@ -18,7 +18,7 @@ $(document).ready(function() {
 
     $('.remove-image').click(function() {
         const $button = $(this);
-        if (confirm('¿Estás seguro de que quieres eliminar esta imagen?')) {
+        if (confirm('¿Mover esta imagen a la papelera? Un administrador puede restaurarla.')) {
             const imageId = $(this).data('image-id');
             console.log('Eliminar imagen con ID:', imageId);
 
@@ -84,6 +84,55 @@ $(document).ready(function() {
         });
     });
 
+    $('#autocompleteBook').click(async function() {
+        const isbn = $('#isbn').val().trim();
+        const title = $('#title').val().trim();
+        const author = $('#author').val().trim();
+        const errorElement = $('#autocompleteError');
+        errorElement.hide();
+
+        if (!isbn && !title) {
+            errorElement.text('Escribe un ISBN o un título primero.').show();
+            return;
+        }
+
+        const params = isbn ? { isbn: isbn } : { title: title, author: author };
+
+        try {
+            const book = await $.get('/api/metadata/lookup', params);
+            if (book.title) {
+                $('#title').val(book.title);
+            }
+            if (book.authors && book.authors.length > 0) {
+                $('#author').val(book.authors.join(', '));
+            }
+            if (book.isbn) {
+                $('#isbn').val(book.isbn);
+            }
+            if (book.publisher) {
+                $('#publisher').val(book.publisher);
+            }
+            if (book.year) {
+                $('#publishedYear').val(book.year);
+            }
+            if (book.page_count) {
+                $('#pageCount').val(book.page_count);
+            }
+            if (book.subjects && book.subjects.length > 0) {
+                $('#subjects').text(book.subjects.join(', '));
+                $('#subjectsContainer').show();
+            }
+            if (book.cover_url) {
+                $('#coverPreview').attr('src', book.cover_url);
+                $('#coverURL').val(book.cover_url);
+                $('#coverContainer').show();
+            }
+        } catch (error) {
+            console.error('Error autocompletando el libro:', error);
+            errorElement.text(error.status === 404 ? 'No se encontró el libro.' : 'Error consultando Open Library.').show();
+        }
+    });
+
     $('#bookForm').on('submit', function(e) {
         e.preventDefault();
 
@@ -100,12 +149,585 @@ $(document).ready(function() {
                 console.log('Libro agregado con éxito', response);
             },
             error: function(xhr, status, error) {
+                if (xhr.status === 409 && xhr.responseJSON && xhr.responseJSON.duplicates) {
+                    showDuplicateWarning(xhr.responseJSON);
+                    return;
+                }
                 // TODO: finish impl
                 console.error('Error al agregar el libro:', error);
             }
         });
     });
 
+    function showDuplicateWarning(response) {
+        const reasons = { isbn: 'mismo ISBN', title_author: 'mismo título y autor', image: 'portada parecida' };
+        const list = $('#duplicateList');
+        list.empty();
+        response.duplicates.forEach(duplicate => {
+            const item = $('<li>');
+            item.append($('<a>').attr('href', `/book_info?id=${duplicate.book.id}`).text(`${duplicate.book.title} - ${duplicate.book.author}`));
+            item.append(document.createTextNode(` (${duplicate.reasons.map(reason => reasons[reason] || reason).join(', ')})`));
+            list.append(item);
+        });
+        $('#duplicateMessage').text(response.message);
+        // A book with the same ISBN cannot be added twice.
+        $('#addDuplicateAnyway').toggle(!response.duplicates.some(duplicate => duplicate.reasons.includes('isbn')));
+        $('#duplicateWarning').show();
+    }
+
+    $('#addDuplicateAnyway').click(function() {
+        $('#allowDuplicate').val('true');
+        $('#duplicateWarning').hide();
+        $('#bookForm').submit();
+    });
+
+    $('.merge-books').click(async function() {
+        const pair = $(this).closest('.duplicate-pair');
+        const result = pair.find('.duplicate-result');
+        try {
+            const report = await $.ajax({
+                url: '/admin/books/merge',
+                type: 'POST',
+                data: JSON.stringify({ survivor_id: $(this).data('survivor-id'), duplicate_id: $(this).data('duplicate-id') }),
+                contentType: 'application/json'
+            });
+            result.text(`Fusionados: ${report.images} imágenes, ${report.likes} likes, ${report.reviews} reseñas`);
+            pair.find('button').prop('disabled', true);
+        } catch (error) {
+            result.text(error.responseText || 'Error al fusionar los libros');
+        }
+    });
+
+    $('.dismiss-duplicate').click(async function() {
+        const pair = $(this).closest('.duplicate-pair');
+        try {
+            await $.ajax({
+                url: '/admin/books/duplicates/dismiss',
+                type: 'POST',
+                data: JSON.stringify({ book_id: pair.data('book-id'), other_book_id: pair.data('other-book-id') }),
+                contentType: 'application/json'
+            });
+            pair.remove();
+        } catch (error) {
+            pair.find('.duplicate-result').text(error.responseText || 'Error al descartar el duplicado');
+        }
+    });
+
+    $('#userBookForm').on('submit', async function(e) {
+        e.preventDefault();
+
+        const form = $(this);
+        const bookID = form.data('book-id');
+        const currentPage = form.find('[name="current_page"]').val();
+        const progressPercent = form.find('[name="progress_percent"]').val();
+
+        const payload = { status: form.find('[name="status"]').val() };
+        if (currentPage !== '') {
+            payload.current_page = parseInt(currentPage, 10);
+        }
+        if (progressPercent !== '') {
+            payload.progress_percent = parseFloat(progressPercent);
+        }
+
+        try {
+            await $.ajax({
+                url: `/api/me/books/${bookID}`,
+                type: 'PUT',
+                data: JSON.stringify(payload),
+                contentType: 'application/json'
+            });
+            window.location.reload();
+        } catch (error) {
+            console.error('Error guardando el progreso:', error);
+            const infoModal = form.find('.info-modal');
+            infoModal.text(error.responseText || 'Error guardando el progreso');
+            infoModal.show();
+            setTimeout(() => infoModal.hide(), 3000);
+        }
+    });
+
+    $('#reviewForm').on('submit', async function(e) {
+        e.preventDefault();
+
+        const form = $(this);
+        const bookID = form.data('book-id');
+        const payload = {
+            rating: parseFloat(form.find('[name="rating"]').val()),
+            body: form.find('[name="body"]').val()
+        };
+
+        try {
+            await $.ajax({
+                url: `/api/books/${bookID}/reviews`,
+                type: 'POST',
+                data: JSON.stringify(payload),
+                contentType: 'application/json'
+            });
+            window.location.reload();
+        } catch (error) {
+            console.error('Error guardando la reseña:', error);
+            const infoModal = form.find('.info-modal');
+            infoModal.text(error.responseText || 'Error guardando la reseña');
+            infoModal.show();
+            setTimeout(() => infoModal.hide(), 3000);
+        }
+    });
+
+    $('.delete-review').click(async function() {
+        if (!confirm('¿Estás seguro de que quieres borrar esta reseña?')) {
+            return;
+        }
+
+        const reviewID = $(this).data('review-id');
+        try {
+            await $.ajax({ url: `/api/reviews/${reviewID}`, type: 'DELETE' });
+            window.location.reload();
+        } catch (error) {
+            console.error('Error borrando la reseña:', error);
+        }
+    });
+
+    $('.moderate-review').click(async function() {
+        const reviewID = $(this).data('review-id');
+        const hidden = $(this).data('hidden') === true || $(this).data('hidden') === 'true';
+        try {
+            await $.ajax({
+                url: `/api/reviews/${reviewID}/moderation`,
+                type: 'PUT',
+                data: JSON.stringify({ hidden: hidden }),
+                contentType: 'application/json'
+            });
+            window.location.reload();
+        } catch (error) {
+            console.error('Error moderando la reseña:', error);
+        }
+    });
+
+    async function mergeAuthors(form, dryRun) {
+        const canonicalID = parseInt(form.find('input[name="canonical"]:checked').val(), 10);
+        const aliasIDs = form.find('input[name="alias"]:checked').map(function() {
+            return parseInt($(this).val(), 10);
+        }).get().filter(id => id !== canonicalID);
+        const report = form.find('.merge-report');
+        report.empty();
+        try {
+            const result = await $.ajax({
+                url: '/admin/authors/merge',
+                type: 'POST',
+                data: JSON.stringify({ canonical_id: canonicalID, alias_ids: aliasIDs, dry_run: dryRun }),
+                contentType: 'application/json'
+            });
+            report.append($('<p>').text(`${dryRun ? 'Vista previa' : 'Fusionado'}: ${result.aliases.join(', ')} → ${result.canonical.name}`));
+            const list = $('<ul>');
+            result.books.forEach(book => {
+                list.append($('<li>').text(`${book.title}: "${book.before}" → "${book.after}"`));
+            });
+            report.append(list);
+            if (!dryRun) {
+                form.find('button').prop('disabled', true);
+            }
+        } catch (error) {
+            report.append($('<p class="error-message">').text(error.responseText || 'Error al fusionar los autores'));
+        }
+    }
+
+    $('.preview-merge').click(function() {
+        mergeAuthors($(this).closest('form'), true);
+    });
+
+    $('.apply-merge').click(function() {
+        mergeAuthors($(this).closest('form'), false);
+    });
+
+    async function saveLocation(url, type, payload, item) {
+        try {
+            await $.ajax({
+                url: url,
+                type: type,
+                data: JSON.stringify(payload),
+                contentType: 'application/json'
+            });
+            window.location.reload();
+        } catch (error) {
+            const message = error.responseText || 'Error al guardar la ubicación';
+            if (item) {
+                alert(message);
+            } else {
+                $('.location-result').text(message);
+            }
+        }
+    }
+
+    function locationParentID(value) {
+        return value ? parseInt(value, 10) : null;
+    }
+
+    $('#locationForm').on('submit', function(e) {
+        e.preventDefault();
+        const form = $(this);
+        saveLocation('/api/locations', 'POST', {
+            name: form.find('[name="name"]').val(),
+            kind: form.find('[name="kind"]').val(),
+            parent_id: locationParentID(form.find('[name="parent_id"]').val())
+        });
+    });
+
+    $('.rename-location').click(function() {
+        const item = $(this).closest('.location-item');
+        const name = prompt('Nuevo nombre:', item.data('name'));
+        if (name) {
+            saveLocation(`/api/locations/${item.data('location-id')}`, 'PUT', {
+                name: name,
+                parent_id: locationParentID(item.data('parent-id'))
+            }, item);
+        }
+    });
+
+    $('.move-location').click(function() {
+        const item = $(this).closest('.location-item');
+        if (item.find('.move-target').length) {
+            return;
+        }
+
+        // Shelves go inside bookcases and bookcases inside rooms; the books on a shelf move with it.
+        const parentKind = item.data('kind') === 'shelf' ? 'bookcase' : 'room';
+        const select = $('<select class="form-control form-control-sm d-inline-block w-auto move-target">');
+        $('#locationParent option').each(function() {
+            const option = $(this);
+            if (option.data('kind') === parentKind && option.val() !== String(item.data('parent-id'))) {
+                select.append(option.clone());
+            }
+        });
+        const save = $('<button type="button" class="btn btn-sm btn-primary ml-1">').text('Mover aquí');
+        save.click(function() {
+            saveLocation(`/api/locations/${item.data('location-id')}`, 'PUT', {
+                name: item.data('name'),
+                parent_id: locationParentID(select.val())
+            }, item);
+        });
+        item.append(select, save);
+    });
+
+    $('.delete-location').click(async function() {
+        const item = $(this).closest('.location-item');
+        if (!confirm(`¿Eliminar ${item.data('name')}?`)) {
+            return;
+        }
+
+        try {
+            await $.ajax({ url: `/api/locations/${item.data('location-id')}`, type: 'DELETE' });
+            item.remove();
+        } catch (error) {
+            alert(error.responseText || 'Error al eliminar la ubicación');
+        }
+    });
+
+    async function sendLoan(url, payload, container) {
+        try {
+            const result = await $.ajax({
+                url: url,
+                type: 'POST',
+                data: JSON.stringify(payload),
+                contentType: 'application/json'
+            });
+            if (result.status === 'unauthenticated') {
+                container.find('.loan-result').text('Inicia sesión para pedir libros prestados');
+                return;
+            }
+            window.location.reload();
+        } catch (error) {
+            container.find('.loan-result').text(error.responseText || 'Error al guardar el préstamo');
+        }
+    }
+
+    $('.request-loan').on('submit', function(e) {
+        e.preventDefault();
+        const section = $(this).closest('.loans-section');
+        sendLoan(`/api/books/${section.data('book-id')}/loan_requests`, { notes: $(this).find('[name="notes"]').val() }, section);
+    });
+
+    $('.lend-book').on('submit', function(e) {
+        e.preventDefault();
+        const form = $(this);
+        const section = form.closest('.loans-section');
+        sendLoan(`/api/books/${section.data('book-id')}/loans`, {
+            borrower_email: form.find('[name="borrower_email"]').val(),
+            borrower_name: form.find('[name="borrower_name"]').val(),
+            due_on: form.find('[name="due_on"]').val(),
+            notes: form.find('[name="notes"]').val()
+        }, section);
+    });
+
+    $('.return-loan').click(function() {
+        sendLoan(`/api/loans/${$(this).data('loan-id')}/return`, {}, $(this).closest('.container, .loans-section'));
+    });
+
+    $('.approve-loan').on('submit', function(e) {
+        e.preventDefault();
+        const request = $(this).closest('.loan-request');
+        sendLoan(`/api/loans/${request.data('loan-id')}/approve`, { date: $(this).find('[name="due_on"]').val() }, request.closest('.container'));
+    });
+
+    $('.reject-loan').click(function() {
+        const request = $(this).closest('.loan-request');
+        sendLoan(`/api/loans/${request.data('loan-id')}/reject`, {}, request.closest('.container'));
+    });
+
+    // A wishlist item marked as acquired opens add_book with its data already filled in.
+    const wishlistID = new URLSearchParams(window.location.search).get('wishlist_id');
+    if (wishlistID && $('#wishlistID').length) {
+        $.get(`/api/wishlist/${wishlistID}`).then(function(item) {
+            $('#wishlistID').val(item.id);
+            $('#title').val(item.title);
+            $('#author').val(item.author);
+            if (item.isbn_13) {
+                $('#isbn').val(item.isbn_13);
+            }
+            if (item.publisher) {
+                $('#publisher').val(item.publisher);
+            }
+            if (item.target_price) {
+                $('#purchasePrice').val(item.target_price);
+                $('#currency').val(item.currency);
+            }
+        }).catch(function(error) {
+            console.error('Error cargando el libro de la lista de deseos:', error);
+        });
+    }
+
+    $('#wishlistForm').on('submit', async function(e) {
+        e.preventDefault();
+        const form = $(this);
+        try {
+            const result = await $.ajax({
+                url: '/api/wishlist',
+                type: 'POST',
+                data: JSON.stringify({
+                    title: form.find('[name="title"]').val(),
+                    author: form.find('[name="author"]').val(),
+                    isbn: form.find('[name="isbn"]').val(),
+                    publisher: form.find('[name="publisher"]').val(),
+                    priority: parseInt(form.find('[name="priority"]').val(), 10),
+                    target_price: form.find('[name="target_price"]').val(),
+                    currency: form.find('[name="currency"]').val(),
+                    seen_at: form.find('[name="seen_at"]').val(),
+                    notes: form.find('[name="notes"]').val()
+                }),
+                contentType: 'application/json'
+            });
+            if (result.status === 'unauthenticated') {
+                form.find('.wishlist-result').text('Inicia sesión para agregar libros a la lista');
+                return;
+            }
+            window.location.reload();
+        } catch (error) {
+            form.find('.wishlist-result').text(error.responseText || 'Error al guardar el libro');
+        }
+    });
+
+    $('.delete-wishlist-item').click(async function() {
+        const row = $(this).closest('tr');
+        if (!confirm('¿Quitar este libro de la lista de deseos?')) {
+            return;
+        }
+
+        try {
+            await $.ajax({ url: `/api/wishlist/${$(this).data('item-id')}`, type: 'DELETE' });
+            row.remove();
+        } catch (error) {
+            alert(error.responseText || 'Error al quitar el libro');
+        }
+    });
+
+    $('.trash-book').click(async function() {
+        if (!confirm('¿Mover este libro a la papelera? Un administrador puede restaurarlo.')) {
+            return;
+        }
+
+        try {
+            await $.ajax({ url: `/api/books/${$(this).data('book-id')}`, type: 'DELETE' });
+            window.location.href = '/admin/papelera';
+        } catch (error) {
+            alert(error.responseText || 'Error al borrar el libro');
+        }
+    });
+
+    async function updateTrashItem(button, url, type) {
+        const item = button.closest('.trash-item');
+        try {
+            await $.ajax({ url: item.data('url') + url, type: type });
+            item.remove();
+        } catch (error) {
+            $('.trash-result').text(error.responseText || 'Error al actualizar la papelera');
+        }
+    }
+
+    $('.restore-trash-item').click(function() {
+        updateTrashItem($(this), '/restore', 'POST');
+    });
+
+    $('.purge-trash-item').click(function() {
+        if (confirm('Esto no se puede deshacer. ¿Borrar para siempre?')) {
+            updateTrashItem($(this), '', 'DELETE');
+        }
+    });
+
+    $('.revert-revision').click(async function() {
+        const revision = $(this).data('revision');
+        if (!confirm(`¿Volver a la versión #${revision} de este libro? Se guardará como una versión nueva.`)) {
+            return;
+        }
+
+        try {
+            await $.ajax({ url: `/api/books/${$(this).data('book-id')}/revisions/${revision}/revert`, type: 'POST' });
+            window.location.reload();
+        } catch (error) {
+            $('.revision-result').text(error.responseText || 'Error al revertir el libro');
+        }
+    });
+
+    function showImportReport(job) {
+        const result = $('.catalog-import-result').empty();
+        if (job.status === 'running') {
+            result.append($('<p>').text(`Procesando ${job.processed} de ${job.total} libros...`));
+            return;
+        }
+        if (job.status === 'aborted') {
+            result.append($('<p class="text-danger">').text(`La importación falló: ${job.error}`));
+            return;
+        }
+
+        const report = job.report;
+        result.append($('<p>').text(`${report.dry_run ? 'Simulación: ' : ''}${report.created.length} nuevos, ${report.updated.length} actualizados, ${report.skipped.length} sin cambios, ${report.failed.length} con errores.`));
+        if (report.failed.length > 0) {
+            const list = $('<ul class="text-danger">');
+            report.failed.forEach(entry => {
+                list.append($('<li>').text(`Fila ${entry.index} (${entry.title || 'sin título'}): ${entry.reason}`));
+            });
+            result.append(list);
+        }
+    }
+
+    async function followImport(jobID) {
+        const job = await $.getJSON(`/api/imports/${jobID}`);
+        showImportReport(job);
+        if (job.status === 'running') {
+            setTimeout(() => followImport(jobID), 1000);
+        }
+    }
+
+    $('#catalogImportForm').on('submit', async function(e) {
+        e.preventDefault();
+
+        try {
+            const job = await $.ajax({
+                url: '/api/catalog/import',
+                type: 'POST',
+                data: new FormData(this),
+                contentType: false,
+                processData: false
+            });
+            showImportReport(job);
+            followImport(job.id);
+        } catch (error) {
+            $('.catalog-import-result').text(error.responseText || 'Error al importar el catálogo');
+        }
+    });
+
+    function showGoodreadsPreview(rows) {
+        const body = $('.goodreads-preview tbody').empty();
+        rows.forEach(row => {
+            const checkbox = $('<input type="checkbox" class="goodreads-row">').val(row.row);
+            let book;
+            if (row.error) {
+                checkbox.prop('disabled', true);
+                book = $('<span class="text-danger">').text(row.error);
+            } else if (row.match) {
+                checkbox.prop('checked', true);
+                book = $('<span>').append(
+                    $('<a>').attr('href', `/book_info?id=${row.match.book_id}`).text(`${row.match.title} de ${row.match.author}`),
+                    $('<small class="text-muted">').text(` (por ${row.match.label})`)
+                );
+            } else {
+                checkbox.prop('disabled', true);
+                book = $('<span class="text-muted">').text('No está en el catálogo');
+            }
+
+            body.append($('<tr>').append(
+                $('<td>').append(checkbox),
+                $('<td>').text(`${row.title} de ${row.author}`),
+                $('<td>').text(row.status_label),
+                $('<td>').text(row.rating ? '★'.repeat(row.rating) : ''),
+                $('<td>').append(book)
+            ));
+        });
+        $('.goodreads-preview').removeClass('d-none');
+    }
+
+    $('#goodreadsForm').on('submit', async function(e) {
+        e.preventDefault();
+        $('.goodreads-result').empty();
+
+        try {
+            const rows = await $.ajax({
+                url: '/api/goodreads/preview',
+                type: 'POST',
+                data: new FormData(this),
+                contentType: false,
+                processData: false
+            });
+            showGoodreadsPreview(rows);
+        } catch (error) {
+            $('.goodreads-preview').addClass('d-none');
+            $('.goodreads-result').text(error.responseText || 'Error al leer el archivo');
+        }
+    });
+
+    $('.goodreads-import').click(async function() {
+        const data = new FormData($('#goodreadsForm')[0]);
+        const skipped = $('.goodreads-row:not(:checked):not(:disabled)').map(function() {
+            return $(this).val();
+        }).get();
+        data.append('skip', skipped.join(','));
+
+        try {
+            const report = await $.ajax({
+                url: '/api/goodreads/import',
+                type: 'POST',
+                data: data,
+                contentType: false,
+                processData: false
+            });
+            $('.goodreads-preview').addClass('d-none');
+            const result = $('.goodreads-result').empty();
+            result.append($('<p>').text(`${report.updated.length} libros importados, ${report.skipped.length} omitidos, ${report.failed.length} con errores.`));
+            if (report.failed.length > 0) {
+                const list = $('<ul class="text-danger">');
+                report.failed.forEach(entry => {
+                    list.append($('<li>').text(`Fila ${entry.index} (${entry.title}): ${entry.reason}`));
+                });
+                result.append(list);
+            }
+            result.append($('<a href="/mi-estante">').text('Ver mi estante'));
+        } catch (error) {
+            $('.goodreads-result').text(error.responseText || 'Error al importar');
+        }
+    });
+
+    $('.review-proposal').click(async function() {
+        const proposalID = $(this).data('proposal-id');
+        const accept = $(this).data('action') === 'accept';
+        try {
+            await $.ajax({
+                url: accept ? `/api/metadata/proposals/${proposalID}/accept` : `/api/metadata/proposals/${proposalID}`,
+                type: accept ? 'POST' : 'DELETE'
+            });
+            location.reload();
+        } catch (error) {
+            $('.proposal-result').text(error.responseText || 'Error al revisar la propuesta');
+        }
+    });
+
     $('.like-emoji').click(async function() {
         const clickedElement = $(this);
         const bookID = clickedElement.data('book-id');
@@ -219,56 +841,14 @@ $(document).ready(function() {
             const searchTypes = $("input[name='searchType']:checked").map(function() {
                 return $(this).val();
             }).get();
-            window.location.href = `search_books?textSearch=${textToSearch}&searchType=${searchTypes.join(',')}`;
+            const status = $('#statusFilter').val() || '';
+            const tag = encodeURIComponent($('#tagFilter').val().trim());
+            window.location.href = `search_books?textSearch=${textToSearch}&searchType=${searchTypes.join(',')}&status=${status}&tag=${tag}`;
         } else {
             $('.error-message').show();
         }
     });
 
-    $('input[type="checkbox"][name="author"]').change(function() {
-        $('input[type="checkbox"][name="author"]').prop('checked', false);
-        $(this).prop('checked', true);
-    });
-
-    $("input[name='author']").change(async function() {
-        const author = $(this).val();
-        if (author) {
-            $("#booksList").empty();
-            try {
-                const books = await $.get(`/api/books?start_with=${author}`);
-                console.log(books);
-
-                books.forEach(book => {
-                    let imagesHtml = '';
-                    if (book.images && book.images.length > 0) {
-                        console.log(book.images);
-                        book.images.forEach(image => {
-                            imagesHtml += `<img src="data:image/jpeg;base64,${image.Image}" class="card-img-bottom" alt="Image of ${book.title}">`;
-                        });
-                    }
-
-                    $("#booksList").append(`
-                        <div class="card my-2">
-                            <div class="card-body">
-                                <h5 class="card-title"><a href="book_info?id=${book.id}">${book.title}</a></h5>
-                                <h6 class="card-subtitle mb-2 text-muted">${book.author}</h6>
-                                <p class="card-text">${book.description || ""}</p>
-                            </div>
-                            ${imagesHtml}
-                        </div>
-                    `);
-
-                    var booksListSection = document.getElementById('booksList');
-
-                    // Hacer scroll hasta el elemento
-                    booksListSection.scrollIntoView({ behavior: 'smooth' });
-                });
-            } catch (error) {
-                console.error("Error fetching books by author:", error);
-            }
-        }
-    });
-
     async function updateBadgeCount(bookID) {
         console.log('Book ID to update: ' + bookID);
         const count = await loadLikesForBook(bookID);
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"leonlib/internal/handler"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const usage = `usage:
+  leonlib                                         start the web server
+  leonlib export [-format toml|csv|json] ...      write the catalog, by default to library/books_db.toml
+  leonlib import [-dry-run] [-map ...] FILE       import a CSV or JSON catalog
+  leonlib calibre [-dry-run] [-format ebook] DIR  import the books of a Calibre library
+`
+
+// runCommand runs the command line tools, e.g. "leonlib export"; without arguments the binary starts the web server.
+func runCommand(name string, args []string) {
+	var err error
+	switch name {
+	case "export":
+		err = runExport(args)
+	case "import":
+		err = runImport(args)
+	case "calibre":
+		err = runCalibre(args)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", name, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+}
+
+// runExport writes the catalog in the format of library/books_db.toml, with its images in a directory or everything
+// in a zip, so the file in git can be brought up to date with the database. With -format csv or json it writes a
+// catalog for spreadsheets instead.
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := flags.String("format", "toml", "toml, csv or json")
+	libraryPath := flags.String("library", "library/books_db.toml", "file the TOML catalog is written to")
+	imagesDir := flags.String("images", "images", "directory the images are written to")
+	zipPath := flags.String("zip", "", "write the TOML catalog and the images to this zip instead")
+	outPath := flags.String("o", "", "file the CSV or JSON catalog is written to; the standard output by default")
+	mappingInput := flags.String("map", "", "column names for CSV and JSON, e.g. title=Título,author=Autor")
+	_ = flags.Parse(args)
+
+	imagesSet := false
+	flags.Visit(func(f *flag.Flag) {
+		imagesSet = imagesSet || f.Name == "images"
+	})
+
+	db := openDatabase()
+	defer db.Close()
+
+	if *format != "toml" {
+		mapping, err := handler.ParseColumnMapping(*mappingInput)
+		if err != nil {
+			return err
+		}
+
+		// The images of a CSV or JSON catalog are only written when asked for.
+		var saveImage func(name string, image []byte) error
+		if imagesSet {
+			if saveImage, err = imageSaver(*imagesDir); err != nil {
+				return err
+			}
+		}
+
+		return writeOutput(*outPath, func(out io.Writer) error {
+			return handler.ExportCatalog(db, out, *format, mapping, saveImage)
+		})
+	}
+
+	if *zipPath != "" {
+		return exportZip(db, *zipPath)
+	}
+
+	saveImage, err := imageSaver(*imagesDir)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(*libraryPath), 0o755); err != nil {
+		return err
+	}
+
+	if err := writeOutput(*libraryPath, func(out io.Writer) error {
+		return handler.ExportLibrary(db, out, saveImage)
+	}); err != nil {
+		return err
+	}
+
+	log.Printf("Catalog exported to %s with its images in %s\n", *libraryPath, *imagesDir)
+	return nil
+}
+
+func imageSaver(imagesDir string) (func(name string, image []byte) error, error) {
+	if err := os.MkdirAll(imagesDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return func(name string, image []byte) error {
+		return os.WriteFile(filepath.Join(imagesDir, name), image, 0o644)
+	}, nil
+}
+
+// writeOutput runs write on the file at path, or on the standard output when path is empty.
+func writeOutput(path string, write func(out io.Writer) error) error {
+	if path == "" {
+		return write(os.Stdout)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := write(file); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+func exportZip(db *sql.DB, zipPath string) error {
+	if err := writeOutput(zipPath, func(out io.Writer) error {
+		return handler.ExportLibraryZip(db, out)
+	}); err != nil {
+		return err
+	}
+
+	log.Printf("Catalog exported to %s\n", zipPath)
+	return nil
+}
+
+// runImport imports a CSV or JSON catalog and prints the report; with -dry-run nothing is saved.
+func runImport(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	format := flags.String("format", "", "csv or json; by default the extension of the file")
+	mappingInput := flags.String("map", "", "columns of the file, e.g. title=Título,author=Autor")
+	imagesDir := flags.String("images", "images", "directory the images named in the file are read from")
+	dryRun := flags.Bool("dry-run", false, "report what would change without saving it")
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("the file to import is required\n\n%s", usage)
+	}
+	path := flags.Arg(0)
+
+	if *format == "" {
+		*format = strings.TrimPrefix(filepath.Ext(path), ".")
+	}
+
+	mapping, err := handler.ParseColumnMapping(*mappingInput)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	db := openDatabase()
+	defer db.Close()
+
+	report, err := handler.ImportCatalog(db, file, *format, mapping, *imagesDir, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	return printReport(report)
+}
+
+// runCalibre imports the books of the Calibre library in DIR, the directory with metadata.db, with their covers.
+func runCalibre(args []string) error {
+	flags := flag.NewFlagSet("calibre", flag.ExitOnError)
+	format := flags.String("format", "ebook", "format of the imported books: hardcover, paperback, ebook or audiobook")
+	dryRun := flags.Bool("dry-run", false, "report what would change without saving it")
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("the directory of the Calibre library is required\n\n%s", usage)
+	}
+
+	db := openDatabase()
+	defer db.Close()
+
+	report, err := handler.ImportCalibre(db, flags.Arg(0), *format, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	return printReport(report)
+}
+
+func printReport(report handler.ImportReport) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(report)
+}
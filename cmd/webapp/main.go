@@ -3,16 +3,19 @@ package main
 import (
 	"context"
 	"database/sql"
-	"fmt"
 	"github.com/gorilla/sessions"
 	_ "github.com/lib/pq"
 	"golang.org/x/oauth2"
 	"leonlib/internal/auth"
 	"leonlib/internal/captcha"
+	"leonlib/internal/handler"
+	"leonlib/internal/metadata"
 	"leonlib/internal/router"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 )
 
 var (
@@ -26,10 +29,17 @@ var (
 	mainAppUser = os.Getenv("LEONLIB_MAINAPP_USER")
 )
 
-func init() {
+const (
+	defaultRankingRefreshMinutes = 15
+	defaultTrashRetentionDays    = 30
+)
+
+// configureWebapp reads the settings only the web server needs.
+func configureWebapp() {
 	if mainAppUser == "" {
 		log.Fatal("error: LEONLIB_MAINAPP_USER not defined")
 	}
+	auth.AdminEmail = mainAppUser
 	captcha.SiteKey = os.Getenv("LEONLIB_CAPTCHA_SITE_KEY")
 	captcha.SecretKey = os.Getenv("LEONLIB_CAPTCHA_SECRET_KEY")
 	if captcha.SiteKey == "" {
@@ -53,26 +63,56 @@ func init() {
 	auth.SessionStore = sessions.NewCookieStore([]byte(os.Getenv("SESSION_SECRET")))
 }
 
-func main() {
+func openDatabase() *sql.DB {
 	var psqlInfo string
 
 	psqlInfo = "host=" + dbHost + " port=" + dbPort + " user=" + dbUser + " password=" + dbPassword + " dbname=" + dbName + " sslmode=disable"
 
-	fmt.Printf("debug:x connection=(%s)\n", psqlInfo)
-
-	var err error
-	DB, err = sql.Open("postgres", psqlInfo)
+	db, err := sql.Open("postgres", psqlInfo)
 	if err != nil {
 		panic(err)
 	}
 
-	err = DB.Ping()
+	err = db.Ping()
 	if err != nil {
 		panic(err)
 	}
 
+	return db
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1], os.Args[2:])
+		return
+	}
+
+	configureWebapp()
+
+	DB = openDatabase()
 	defer DB.Close()
 
+	if trendingDays, err := strconv.Atoi(os.Getenv("LEONLIB_TRENDING_DAYS")); err == nil && trendingDays > 0 {
+		handler.DefaultTrendingDays = trendingDays
+	}
+
+	refreshMinutes, err := strconv.Atoi(os.Getenv("LEONLIB_RANKING_REFRESH_MINUTES"))
+	if err != nil || refreshMinutes <= 0 {
+		refreshMinutes = defaultRankingRefreshMinutes
+	}
+	handler.StartRankingRefresher(DB, time.Duration(refreshMinutes)*time.Minute)
+
+	// A retention of 0 days keeps the trash until an admin empties it.
+	trashRetentionDays, err := strconv.Atoi(os.Getenv("LEONLIB_TRASH_RETENTION_DAYS"))
+	if err != nil || trashRetentionDays < 0 {
+		trashRetentionDays = defaultTrashRetentionDays
+	}
+	handler.StartTrashPurger(DB, trashRetentionDays)
+
+	handler.StartImageHashBackfill(DB)
+
+	handler.MetadataProvider = metadata.NewOpenLibrary(os.Getenv("LEONLIB_OPENLIBRARY_URL"), os.Getenv("LEONLIB_OPENLIBRARY_COVERS_URL"))
+
 	r := router.NewRouter(DB)
 
 	fs := http.FileServer(http.Dir("assets/"))
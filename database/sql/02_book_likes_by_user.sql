@@ -0,0 +1 @@
+CREATE INDEX idx_book_likes_user_id_created_at ON book_likes USING btree (user_id, created_at);
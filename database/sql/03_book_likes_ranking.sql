@@ -0,0 +1,8 @@
+CREATE MATERIALIZED VIEW book_likes_ranking AS
+SELECT l.book_id, COUNT(*) AS likes_count
+FROM book_likes l
+GROUP BY l.book_id;
+
+CREATE UNIQUE INDEX idx_book_likes_ranking_book_id ON book_likes_ranking USING btree (book_id);
+CREATE INDEX idx_book_likes_ranking_likes_count ON book_likes_ranking USING btree (likes_count DESC);
+CREATE INDEX idx_book_likes_created_at ON book_likes USING btree (created_at);
@@ -0,0 +1,12 @@
+CREATE TYPE reading_status AS ENUM ('to_read', 'reading', 'read', 'abandoned', 'rereading');
+
+ALTER TABLE books
+    ADD COLUMN reading_status reading_status NOT NULL DEFAULT 'to_read',
+    ADD COLUMN started_on DATE,
+    ADD COLUMN finished_on DATE;
+
+UPDATE books SET reading_status = 'read' WHERE read;
+
+ALTER TABLE books DROP COLUMN read;
+
+CREATE INDEX idx_books_reading_status ON books USING btree (reading_status);
@@ -0,0 +1,15 @@
+CREATE TABLE user_books (
+    user_id TEXT NOT NULL REFERENCES users(user_id),
+    book_id INTEGER NOT NULL REFERENCES books(id),
+    status reading_status NOT NULL DEFAULT 'to_read',
+    current_page INTEGER CHECK (current_page >= 0),
+    progress_percent NUMERIC(5, 2) CHECK (progress_percent BETWEEN 0 AND 100),
+    started_on DATE,
+    finished_on DATE,
+    reread_count INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, book_id)
+);
+
+CREATE INDEX idx_user_books_book_id ON user_books USING btree (book_id);
+CREATE INDEX idx_user_books_user_id_status ON user_books USING btree (user_id, status);
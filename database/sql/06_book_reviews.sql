@@ -0,0 +1,14 @@
+CREATE TABLE book_reviews (
+    review_id SERIAL PRIMARY KEY,
+    book_id INTEGER NOT NULL REFERENCES books(id),
+    user_id TEXT NOT NULL REFERENCES users(user_id),
+    rating NUMERIC(2, 1) NOT NULL CHECK (rating BETWEEN 1 AND 5 AND rating * 2 = TRUNC(rating * 2)),
+    body TEXT NOT NULL DEFAULT '',
+    hidden BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE book_reviews ADD CONSTRAINT unique_book_review_per_user UNIQUE(book_id, user_id);
+
+CREATE INDEX idx_book_reviews_book_id ON book_reviews USING btree (book_id);
@@ -0,0 +1,5 @@
+ALTER TABLE books
+    ADD COLUMN isbn_10 VARCHAR(10) CHECK (isbn_10 ~ '^[0-9]{9}[0-9X]$'),
+    ADD COLUMN isbn_13 VARCHAR(13) CHECK (isbn_13 ~ '^[0-9]{13}$');
+
+CREATE UNIQUE INDEX idx_books_isbn_13 ON books USING btree (isbn_13);
@@ -0,0 +1,6 @@
+ALTER TABLE books
+    ADD COLUMN publisher VARCHAR(255),
+    ADD COLUMN published_year INTEGER CHECK (published_year BETWEEN 0 AND 9999),
+    ADD COLUMN page_count INTEGER CHECK (page_count > 0);
+
+ALTER TABLE books ADD COLUMN metadata_checked_at TIMESTAMPTZ;
@@ -0,0 +1,27 @@
+CREATE TABLE works (
+    id SERIAL PRIMARY KEY,
+    title VARCHAR(255) NOT NULL,
+    author VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_works_title_author ON works USING btree (lower(title), lower(author));
+
+ALTER TABLE books
+    ADD COLUMN work_id INTEGER REFERENCES works(id),
+    ADD COLUMN translator VARCHAR(255),
+    ADD COLUMN format VARCHAR(20) CHECK (format IN ('hardcover', 'paperback', 'ebook', 'audiobook')),
+    ADD COLUMN language VARCHAR(10);
+
+INSERT INTO works(title, author)
+SELECT DISTINCT ON (lower(b.title), lower(b.author)) b.title, b.author
+FROM books b
+ORDER BY lower(b.title), lower(b.author), b.id;
+
+UPDATE books b SET work_id = w.id
+FROM works w
+WHERE lower(w.title) = lower(b.title) AND lower(w.author) = lower(b.author);
+
+ALTER TABLE books ALTER COLUMN work_id SET NOT NULL;
+
+CREATE INDEX idx_books_work_id ON books USING btree (work_id);
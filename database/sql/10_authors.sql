@@ -0,0 +1,80 @@
+CREATE TYPE author_role AS ENUM ('author', 'translator', 'illustrator', 'editor');
+
+CREATE TABLE authors (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    slug VARCHAR(255) NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE book_authors (
+    book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    author_id INTEGER NOT NULL REFERENCES authors(id) ON DELETE CASCADE,
+    role author_role NOT NULL DEFAULT 'author',
+    position SMALLINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (book_id, author_id, role)
+);
+
+CREATE INDEX idx_book_authors_author_id ON book_authors USING btree (author_id);
+
+-- The slug rules must match slugify in internal/handler/authors.go.
+CREATE FUNCTION author_slug(name TEXT) RETURNS TEXT AS $$
+    SELECT trim(BOTH '-' FROM regexp_replace(
+        translate(lower(name), 'áàäâãåéèëêíìïîóòöôõúùüûñçý', 'aaaaaaeeeeiiiiooooouuuuncy'),
+        '[^a-z0-9]+', '-', 'g'))
+$$ LANGUAGE SQL IMMUTABLE;
+
+-- books.author may list several people separated by commas, semicolons, ampersands or slashes. A comma before a
+-- suffix such as "Jr." or in a single "Last, First" name, where one of the sides is a single word, does not separate
+-- names. The rules must match splitAuthorNames in internal/handler/authors.go.
+CREATE FUNCTION split_author_credit(credit TEXT) RETURNS SETOF TEXT AS $$
+DECLARE
+    part TEXT;
+    piece TEXT;
+    pieces TEXT[];
+BEGIN
+    FOREACH part IN ARRAY regexp_split_to_array(credit, '\s*[;&/]\s*') LOOP
+        pieces := ARRAY[]::TEXT[];
+        FOREACH piece IN ARRAY string_to_array(part, ',') LOOP
+            piece := trim(piece);
+            IF piece = '' THEN
+                CONTINUE;
+            ELSIF cardinality(pieces) > 0
+                AND regexp_replace(lower(piece), '[^a-z0-9]', '', 'g') IN ('jr', 'sr', 'ii', 'iii', 'iv', 'phd') THEN
+                pieces[cardinality(pieces)] := pieces[cardinality(pieces)] || ', ' || piece;
+            ELSE
+                pieces := array_append(pieces, piece);
+            END IF;
+        END LOOP;
+
+        IF cardinality(pieces) = 2 AND (pieces[1] !~ '\s' OR pieces[2] !~ '\s') THEN
+            pieces := ARRAY[pieces[1] || ', ' || pieces[2]];
+        END IF;
+
+        RETURN QUERY SELECT unnest(pieces);
+    END LOOP;
+END
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+CREATE TEMPORARY TABLE book_credits AS
+SELECT b.id AS book_id, credit.name, 'author'::author_role AS role, (credit.position - 1)::SMALLINT AS position
+FROM books b, split_author_credit(b.author) WITH ORDINALITY AS credit(name, position)
+UNION ALL
+SELECT b.id, credit.name, 'translator'::author_role, (credit.position - 1)::SMALLINT
+FROM books b, split_author_credit(b.translator) WITH ORDINALITY AS credit(name, position)
+WHERE b.translator IS NOT NULL;
+
+INSERT INTO authors(name, slug)
+SELECT DISTINCT ON (author_slug(c.name)) c.name, author_slug(c.name)
+FROM book_credits c
+WHERE author_slug(c.name) <> ''
+ORDER BY author_slug(c.name), c.name;
+
+INSERT INTO book_authors(book_id, author_id, role, position)
+SELECT c.book_id, a.id, c.role, MIN(c.position)
+FROM book_credits c
+JOIN authors a ON a.slug = author_slug(c.name)
+GROUP BY c.book_id, a.id, c.role;
+
+DROP TABLE book_credits;
+DROP FUNCTION split_author_credit(TEXT);
@@ -0,0 +1,8 @@
+CREATE TABLE author_aliases (
+    alias_slug VARCHAR(255) PRIMARY KEY,
+    alias VARCHAR(255) NOT NULL,
+    author_id INTEGER NOT NULL REFERENCES authors(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_author_aliases_author_id ON author_aliases USING btree (author_id);
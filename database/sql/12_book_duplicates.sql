@@ -0,0 +1,10 @@
+ALTER TABLE book_images ADD COLUMN image_hash BIGINT;
+
+-- Pairs of books an admin marked as "not duplicates" in the duplicates report.
+CREATE TABLE book_duplicate_dismissals (
+    book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    other_book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (book_id, other_book_id),
+    CHECK (book_id < other_book_id)
+);
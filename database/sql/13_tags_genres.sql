@@ -0,0 +1,58 @@
+CREATE TABLE tags (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    slug VARCHAR(100) NOT NULL UNIQUE
+);
+
+CREATE TABLE book_tags (
+    book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    PRIMARY KEY (book_id, tag_id)
+);
+
+CREATE INDEX idx_book_tags_tag_id ON book_tags USING btree (tag_id);
+
+CREATE TABLE genres (
+    id SERIAL PRIMARY KEY,
+    parent_id INTEGER REFERENCES genres(id),
+    name VARCHAR(100) NOT NULL,
+    slug VARCHAR(100) NOT NULL UNIQUE
+);
+
+CREATE INDEX idx_genres_parent_id ON genres USING btree (parent_id);
+
+CREATE TABLE book_genres (
+    book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    genre_id INTEGER NOT NULL REFERENCES genres(id) ON DELETE CASCADE,
+    PRIMARY KEY (book_id, genre_id)
+);
+
+CREATE INDEX idx_book_genres_genre_id ON book_genres USING btree (genre_id);
+
+INSERT INTO genres(name, slug) VALUES
+    ('Ficción', 'ficcion'),
+    ('No ficción', 'no-ficcion'),
+    ('Poesía', 'poesia'),
+    ('Teatro', 'teatro'),
+    ('Infantil y juvenil', 'infantil-y-juvenil'),
+    ('Cómic y novela gráfica', 'comic-y-novela-grafica');
+
+INSERT INTO genres(parent_id, name, slug)
+SELECT p.id, g.name, g.slug
+FROM (VALUES
+    ('ficcion', 'Novela histórica', 'novela-historica'),
+    ('ficcion', 'Ciencia ficción', 'ciencia-ficcion'),
+    ('ficcion', 'Fantasía', 'fantasia'),
+    ('ficcion', 'Novela policiaca', 'novela-policiaca'),
+    ('ficcion', 'Terror', 'terror'),
+    ('ficcion', 'Romance', 'romance'),
+    ('ficcion', 'Cuento', 'cuento'),
+    ('ficcion', 'Novela contemporánea', 'novela-contemporanea'),
+    ('no-ficcion', 'Historia', 'historia'),
+    ('no-ficcion', 'Biografía y memorias', 'biografia-y-memorias'),
+    ('no-ficcion', 'Ciencia y divulgación', 'ciencia-y-divulgacion'),
+    ('no-ficcion', 'Filosofía', 'filosofia'),
+    ('no-ficcion', 'Ensayo', 'ensayo'),
+    ('no-ficcion', 'Tecnología y programación', 'tecnologia-y-programacion')
+) AS g(parent_slug, name, slug)
+JOIN genres p ON p.slug = g.parent_slug;
@@ -0,0 +1,14 @@
+CREATE TABLE series (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    slug VARCHAR(255) NOT NULL UNIQUE,
+    description TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- The position is numeric so novellas published between volumes can be placed as 1.5.
+ALTER TABLE books
+    ADD COLUMN series_id INTEGER REFERENCES series(id) ON DELETE SET NULL,
+    ADD COLUMN series_position NUMERIC(6, 2) CHECK (series_position > 0);
+
+CREATE INDEX idx_books_series_id_position ON books USING btree (series_id, series_position);
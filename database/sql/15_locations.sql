@@ -0,0 +1,18 @@
+CREATE TYPE location_kind AS ENUM ('room', 'bookcase', 'shelf');
+
+-- Rooms contain bookcases and bookcases contain shelves. Books point to the location, so moving a shelf to
+-- another bookcase moves every book on it.
+CREATE TABLE locations (
+    id SERIAL PRIMARY KEY,
+    parent_id INTEGER REFERENCES locations(id),
+    kind location_kind NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK ((kind = 'room') = (parent_id IS NULL))
+);
+
+CREATE UNIQUE INDEX idx_locations_parent_id_name ON locations USING btree (COALESCE(parent_id, 0), lower(name));
+
+ALTER TABLE books ADD COLUMN location_id INTEGER REFERENCES locations(id);
+
+CREATE INDEX idx_books_location_id ON books USING btree (location_id);
@@ -0,0 +1,27 @@
+CREATE TYPE loan_status AS ENUM ('requested', 'rejected', 'active', 'returned');
+
+-- The borrower is either a registered user or just a name typed by the admin.
+CREATE TABLE loans (
+    id SERIAL PRIMARY KEY,
+    book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    borrower_user_id TEXT REFERENCES users(user_id),
+    borrower_name VARCHAR(255),
+    status loan_status NOT NULL DEFAULT 'active',
+    requested_at TIMESTAMPTZ,
+    loaned_on DATE,
+    due_on DATE,
+    returned_on DATE,
+    notes TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (borrower_user_id IS NOT NULL OR borrower_name IS NOT NULL),
+    CHECK (status NOT IN ('active', 'returned') OR loaned_on IS NOT NULL),
+    CHECK (status <> 'returned' OR returned_on IS NOT NULL),
+    CHECK (due_on IS NULL OR loaned_on IS NULL OR due_on >= loaned_on)
+);
+
+-- A copy can only be in one place: at most one active loan per book, and one pending request per user and book.
+CREATE UNIQUE INDEX idx_loans_active_book_id ON loans USING btree (book_id) WHERE status = 'active';
+CREATE UNIQUE INDEX idx_loans_requested_book_id_user_id ON loans USING btree (book_id, borrower_user_id) WHERE status = 'requested';
+CREATE INDEX idx_loans_book_id ON loans USING btree (book_id);
+CREATE INDEX idx_loans_status_due_on ON loans USING btree (status, due_on);
@@ -0,0 +1,31 @@
+-- How an owned copy arrived: bought (date, price, store) or received as a gift.
+ALTER TABLE books
+    ADD COLUMN purchased_on DATE,
+    ADD COLUMN purchase_price NUMERIC(10, 2) CHECK (purchase_price >= 0),
+    ADD COLUMN currency CHAR(3),
+    ADD COLUMN store VARCHAR(255),
+    ADD COLUMN gift_from VARCHAR(255),
+    ADD CONSTRAINT books_purchase_price_currency_check CHECK (purchase_price IS NULL OR currency IS NOT NULL);
+
+CREATE INDEX idx_books_purchased_on ON books USING btree (purchased_on);
+
+-- Books we want to buy. Once bought, the item points to the catalog book it became.
+CREATE TABLE wishlist_items (
+    id SERIAL PRIMARY KEY,
+    title VARCHAR(255) NOT NULL,
+    author VARCHAR(255) NOT NULL,
+    isbn_13 VARCHAR(13),
+    publisher VARCHAR(255),
+    priority SMALLINT NOT NULL DEFAULT 2 CHECK (priority BETWEEN 1 AND 3),
+    target_price NUMERIC(10, 2) CHECK (target_price >= 0),
+    currency CHAR(3),
+    seen_at VARCHAR(500),
+    notes TEXT,
+    added_by TEXT REFERENCES users(user_id),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    acquired_book_id INTEGER REFERENCES books(id) ON DELETE SET NULL,
+    acquired_at TIMESTAMPTZ,
+    CHECK (target_price IS NULL OR currency IS NOT NULL)
+);
+
+CREATE INDEX idx_wishlist_items_acquired_at_priority ON wishlist_items USING btree (acquired_at, priority);
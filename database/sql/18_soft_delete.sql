@@ -0,0 +1,10 @@
+-- Deleted books and images go to the trash first; they are purged for good by an admin or after the retention period.
+ALTER TABLE books ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE book_images ADD COLUMN deleted_at TIMESTAMPTZ;
+
+CREATE INDEX idx_books_deleted_at ON books USING btree (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_book_images_deleted_at ON book_images USING btree (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- A book in the trash does not block adding it again; restoring it fails while the new copy has the same ISBN.
+DROP INDEX idx_books_isbn_13;
+CREATE UNIQUE INDEX idx_books_isbn_13 ON books USING btree (isbn_13) WHERE deleted_at IS NULL;
@@ -0,0 +1,29 @@
+-- Who changed what in the catalog. changes holds the modified fields as {"field": {"before": ..., "after": ...}}.
+CREATE TABLE audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    actor_user_id TEXT,
+    action VARCHAR(20) NOT NULL,
+    entity VARCHAR(20) NOT NULL,
+    entity_id INTEGER NOT NULL,
+    changes JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_audit_log_created_at ON audit_log USING btree (created_at);
+CREATE INDEX idx_audit_log_entity ON audit_log USING btree (entity, entity_id);
+CREATE INDEX idx_audit_log_actor_user_id ON audit_log USING btree (actor_user_id);
+
+-- The log is append-only: rows cannot be changed or removed, not even by the application.
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_no_update_delete
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+CREATE TRIGGER audit_log_no_truncate
+    BEFORE TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
@@ -0,0 +1,12 @@
+-- Every saved version of a book, numbered from 1 per book. The first revision is the book as it was before its first
+-- edit; reverted_from is set when the revision restored an older one.
+CREATE TABLE book_revisions (
+    id SERIAL PRIMARY KEY,
+    book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL CHECK (revision > 0),
+    data JSONB NOT NULL,
+    editor_user_id TEXT REFERENCES users(user_id),
+    reverted_from INTEGER,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (book_id, revision)
+);
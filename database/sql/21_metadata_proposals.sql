@@ -0,0 +1,13 @@
+-- Metadata found by title and author only. It may belong to another edition of the book, so it waits here until an
+-- admin accepts or rejects it.
+CREATE TABLE metadata_proposals (
+    id SERIAL PRIMARY KEY,
+    book_id INTEGER NOT NULL UNIQUE REFERENCES books(id) ON DELETE CASCADE,
+    isbn_10 VARCHAR(10),
+    isbn_13 VARCHAR(13),
+    publisher VARCHAR(255),
+    published_year INTEGER,
+    page_count INTEGER,
+    cover_url TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,2 @@
+-- The name of the file an imported image was read from, so the export writes it back under the same name.
+ALTER TABLE book_images ADD COLUMN file_name VARCHAR(255);
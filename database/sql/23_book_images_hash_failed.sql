@@ -0,0 +1,2 @@
+-- Images that cannot be decoded, such as WebP, have no hash; they are marked so the backfill does not read them again.
+ALTER TABLE book_images ADD COLUMN image_hash_failed BOOLEAN NOT NULL DEFAULT FALSE;
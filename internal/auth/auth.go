@@ -8,4 +8,6 @@ import (
 var (
 	SessionStore *sessions.CookieStore
 	Config       *oauth2.Config
+	// AdminEmail is the email of the main app user, the only one allowed to moderate and administer the catalog.
+	AdminEmail string
 )
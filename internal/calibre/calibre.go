@@ -0,0 +1,260 @@
+// Package calibre reads the books of a Calibre library from its metadata.db
+package calibre
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// MetadataFile is the SQLite database Calibre keeps at the root of every library
+const MetadataFile = "metadata.db"
+
+// ErrNotALibrary is returned when the directory has no metadata.db
+var ErrNotALibrary = errors.New("calibre: the directory is not a Calibre library")
+
+var (
+	htmlBreak = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|li|h[1-6])>`)
+	htmlTag   = regexp.MustCompile(`<[^>]*>`)
+	blankRuns = regexp.MustCompile(`\n{3,}`)
+)
+
+// languageCodes maps the ISO 639-2 codes Calibre stores to the two-letter codes of the most common languages.
+var languageCodes = map[string]string{
+	"spa": "es",
+	"eng": "en",
+	"fra": "fr",
+	"deu": "de",
+	"ita": "it",
+	"por": "pt",
+	"cat": "ca",
+	"glg": "gl",
+	"eus": "eu",
+	"lat": "la",
+	"rus": "ru",
+	"jpn": "ja",
+	"zho": "zh",
+}
+
+// Book is a book of the library as Calibre describes it; every field but ID, Title and Path may be empty.
+type Book struct {
+	ID          int
+	Title       string
+	Authors     []string
+	Series      string
+	SeriesIndex float64
+	Tags        []string
+	// Identifiers holds the ids Calibre knows the book by, keyed by type: "isbn", "goodreads", "amazon"...
+	Identifiers map[string]string
+	// Comments is the description of the book, in HTML.
+	Comments  string
+	Publisher string
+	// Language is the two-letter code of the first language of the book when it is a common one, and the
+	// three-letter code Calibre uses otherwise.
+	Language  string
+	Published time.Time
+	Added     time.Time
+	// Path is the directory of the book, relative to the library.
+	Path     string
+	HasCover bool
+}
+
+// ISBN returns the ISBN of the book, which older libraries keep in the books table instead of the identifiers.
+func (b Book) ISBN() string {
+	if isbn := b.Identifiers["isbn"]; isbn != "" {
+		return isbn
+	}
+
+	return b.Identifiers[""]
+}
+
+// CoverPath returns the path of cover.jpg relative to the library, or "" when the book has no cover.
+func (b Book) CoverPath() string {
+	if !b.HasCover {
+		return ""
+	}
+
+	return filepath.Join(filepath.FromSlash(b.Path), "cover.jpg")
+}
+
+// Description returns the comments of the book as plain text.
+func (b Book) Description() string {
+	text := htmlBreak.ReplaceAllString(b.Comments, "\n")
+	text = html.UnescapeString(htmlTag.ReplaceAllString(text, ""))
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+
+	return strings.TrimSpace(blankRuns.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+// parseDate reads the timestamps Calibre writes, as "2015-03-01 10:00:00+00:00". Calibre saves unknown dates as
+// the year 101, which are returned as the zero time.
+func parseDate(value string) time.Time {
+	if len(value) < len("2006-01-02") {
+		return time.Time{}
+	}
+
+	date, err := time.Parse("2006-01-02", value[:len("2006-01-02")])
+	if err != nil || date.Year() <= 101 {
+		return time.Time{}
+	}
+
+	return date
+}
+
+// ReadLibrary returns the books of the Calibre library in dir, in the order they were added. The database is opened
+// read only, so it can be read while Calibre is running.
+func ReadLibrary(dir string) ([]Book, error) {
+	path, err := filepath.Abs(filepath.Join(dir, MetadataFile))
+	if err != nil {
+		return []Book{}, err
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []Book{}, ErrNotALibrary
+		}
+		return []Book{}, err
+	}
+
+	dsn := (&url.URL{Scheme: "file", Path: filepath.ToSlash(path), RawQuery: "mode=ro"}).String()
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return []Book{}, err
+	}
+	defer db.Close()
+
+	books, err := readBooks(db)
+	if err != nil {
+		return []Book{}, fmt.Errorf("calibre: %w", err)
+	}
+
+	return books, nil
+}
+
+func readBooks(db *sql.DB) ([]Book, error) {
+	rows, err := db.Query(`SELECT b.id, b.title, b.path, b.has_cover, b.series_index,
+			COALESCE(CAST(b.pubdate AS TEXT), ''), COALESCE(CAST(b.timestamp AS TEXT), ''), COALESCE(b.isbn, ''),
+			COALESCE((SELECT s.name FROM books_series_link bsl JOIN series s ON s.id = bsl.series
+				WHERE bsl.book = b.id), ''),
+			COALESCE((SELECT p.name FROM books_publishers_link bpl JOIN publishers p ON p.id = bpl.publisher
+				WHERE bpl.book = b.id), ''),
+			COALESCE((SELECT l.lang_code FROM books_languages_link bll JOIN languages l ON l.id = bll.lang_code
+				WHERE bll.book = b.id ORDER BY bll.item_order LIMIT 1), ''),
+			COALESCE((SELECT c.text FROM comments c WHERE c.book = b.id), '')
+		FROM books b
+		ORDER BY b.id`)
+	if err != nil {
+		return []Book{}, err
+	}
+
+	defer rows.Close()
+
+	books := []Book{}
+	for rows.Next() {
+		var book Book
+		var published, added, isbn string
+		err := rows.Scan(&book.ID, &book.Title, &book.Path, &book.HasCover, &book.SeriesIndex, &published, &added,
+			&isbn, &book.Series, &book.Publisher, &book.Language, &book.Comments)
+		if err != nil {
+			return []Book{}, err
+		}
+
+		book.Published = parseDate(published)
+		book.Added = parseDate(added)
+		book.Identifiers = map[string]string{}
+		if isbn != "" {
+			book.Identifiers[""] = isbn
+		}
+		if code, ok := languageCodes[book.Language]; ok {
+			book.Language = code
+		}
+
+		books = append(books, book)
+	}
+
+	if err := rows.Err(); err != nil {
+		return []Book{}, err
+	}
+
+	byID := map[int]*Book{}
+	for i := range books {
+		byID[books[i].ID] = &books[i]
+	}
+
+	// Authors keep the order they were entered in, as Calibre shows them.
+	err = readLinks(db, `SELECT bal.book, a.name FROM books_authors_link bal JOIN authors a ON a.id = bal.author
+		ORDER BY bal.id`, func(bookID int, name, _ string) {
+		if book, ok := byID[bookID]; ok {
+			book.Authors = append(book.Authors, name)
+		}
+	})
+	if err != nil {
+		return []Book{}, err
+	}
+
+	err = readLinks(db, `SELECT btl.book, t.name FROM books_tags_link btl JOIN tags t ON t.id = btl.tag
+		ORDER BY t.name`, func(bookID int, name, _ string) {
+		if book, ok := byID[bookID]; ok {
+			book.Tags = append(book.Tags, name)
+		}
+	})
+	if err != nil {
+		return []Book{}, err
+	}
+
+	err = readLinks(db, `SELECT book, type, val FROM identifiers`, func(bookID int, kind, value string) {
+		if book, ok := byID[bookID]; ok {
+			book.Identifiers[strings.ToLower(kind)] = value
+		}
+	})
+	if err != nil {
+		return []Book{}, err
+	}
+
+	return books, nil
+}
+
+// readLinks calls add for every row of a query returning a book id and one or two text values.
+func readLinks(db *sql.DB, query string, add func(bookID int, first, second string)) error {
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		var bookID int
+		var first, second string
+		if len(columns) == 3 {
+			err = rows.Scan(&bookID, &first, &second)
+		} else {
+			err = rows.Scan(&bookID, &first)
+		}
+		if err != nil {
+			return err
+		}
+
+		add(bookID, first, second)
+	}
+
+	return rows.Err()
+}
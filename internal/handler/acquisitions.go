@@ -0,0 +1,293 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"leonlib/internal/captcha"
+)
+
+// defaultCurrency is used when a price is typed without a currency.
+const defaultCurrency = "MXN"
+
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// Price is an amount of money with two decimals. It can be written as purchasePrice = 250 or 249.90 in
+// books_db.toml.
+type Price float64
+
+// acquisitionForm holds how an owned copy arrived: bought on a date, at a price, in a store, or as a gift.
+type acquisitionForm struct {
+	PurchasedOn sql.NullTime
+	Price       sql.NullFloat64
+	Currency    sql.NullString
+	Store       sql.NullString
+	GiftFrom    sql.NullString
+}
+
+// SpendingYear sums the books bought in a year with the same currency, and counts the gifts received that year.
+type SpendingYear struct {
+	Year     int     `json:"year"`
+	Currency string  `json:"currency"`
+	Bought   int     `json:"bought"`
+	Total    float64 `json:"total"`
+	Gifts    int     `json:"gifts"`
+}
+
+type PageSpendingVariables struct {
+	Year     string
+	SiteKey  string
+	Years    []SpendingYear
+	LoggedIn bool
+}
+
+func (p *Price) UnmarshalTOML(data interface{}) error {
+	var price float64
+	switch value := data.(type) {
+	case int64:
+		price = float64(value)
+	case float64:
+		price = value
+	default:
+		return fmt.Errorf("invalid price: %v", data)
+	}
+
+	if price < 0 {
+		return fmt.Errorf("invalid price: %v", price)
+	}
+
+	*p = Price(math.Round(price*100) / 100)
+	return nil
+}
+
+func (p Price) String() string {
+	return strconv.FormatFloat(float64(p), 'f', 2, 64)
+}
+
+// PriceLabel formats the purchase price with its currency, or returns an empty string when it is unknown.
+func (bi BookInfo) PriceLabel() string {
+	if bi.PurchasePrice == 0 {
+		return ""
+	}
+
+	return bi.PurchasePrice.String() + " " + bi.Currency
+}
+
+// Average is the mean price of the books bought that year.
+func (sy SpendingYear) Average() string {
+	if sy.Bought == 0 {
+		return ""
+	}
+
+	return Price(sy.Total / float64(sy.Bought)).String()
+}
+
+func (sy SpendingYear) TotalLabel() string {
+	return Price(sy.Total).String()
+}
+
+func parsePrice(name, input string) (sql.NullFloat64, error) {
+	input = strings.TrimSpace(strings.ReplaceAll(input, ",", ""))
+	if input == "" {
+		return sql.NullFloat64{}, nil
+	}
+
+	price, err := strconv.ParseFloat(input, 64)
+	if err != nil || price < 0 || price >= 1e8 {
+		return sql.NullFloat64{}, fmt.Errorf("%s must be a positive amount", name)
+	}
+
+	return sql.NullFloat64{Float64: math.Round(price*100) / 100, Valid: true}, nil
+}
+
+// parseCurrency accepts an ISO 4217 code such as MXN or EUR; an empty currency becomes the default one when there
+// is a price.
+func parseCurrency(input string, price sql.NullFloat64) (sql.NullString, error) {
+	currency := strings.ToUpper(strings.TrimSpace(input))
+	if currency == "" {
+		if price.Valid {
+			return sql.NullString{String: defaultCurrency, Valid: true}, nil
+		}
+		return sql.NullString{}, nil
+	}
+
+	if !currencyCode.MatchString(currency) {
+		return sql.NullString{}, fmt.Errorf("invalid currency: %q", input)
+	}
+
+	return sql.NullString{String: currency, Valid: true}, nil
+}
+
+// parseAcquisitionForm reads the purchased_on, purchase_price, currency, store and gift_from fields.
+func parseAcquisitionForm(r *http.Request) (acquisitionForm, error) {
+	purchasedOn, err := parseOptionalDate(r.FormValue("purchased_on"))
+	if err != nil {
+		return acquisitionForm{}, err
+	}
+
+	price, err := parsePrice("purchase_price", r.FormValue("purchase_price"))
+	if err != nil {
+		return acquisitionForm{}, err
+	}
+
+	currency, err := parseCurrency(r.FormValue("currency"), price)
+	if err != nil {
+		return acquisitionForm{}, err
+	}
+
+	return acquisitionForm{
+		PurchasedOn: purchasedOn,
+		Price:       price,
+		Currency:    currency,
+		Store:       nullableString(r.FormValue("store")),
+		GiftFrom:    nullableString(r.FormValue("gift_from")),
+	}, nil
+}
+
+// acquisitionFromBook validates the acquisition fields of a book read from books_db.toml.
+func acquisitionFromBook(book BookInfo) (acquisitionForm, error) {
+	purchasedOn, err := parseOptionalDate(book.PurchasedOn)
+	if err != nil {
+		return acquisitionForm{}, err
+	}
+
+	price := sql.NullFloat64{Float64: float64(book.PurchasePrice), Valid: book.PurchasePrice > 0}
+	currency, err := parseCurrency(book.Currency, price)
+	if err != nil {
+		return acquisitionForm{}, err
+	}
+
+	return acquisitionForm{
+		PurchasedOn: purchasedOn,
+		Price:       price,
+		Currency:    currency,
+		Store:       nullableString(book.Store),
+		GiftFrom:    nullableString(book.GiftFrom),
+	}, nil
+}
+
+func setBookAcquisition(db execer, bookID int, acquisition acquisitionForm) error {
+	_, err := db.Exec(`UPDATE books SET purchased_on = $1, purchase_price = $2, currency = $3, store = $4, gift_from = $5
+		WHERE id = $6`, acquisition.PurchasedOn, acquisition.Price, acquisition.Currency, acquisition.Store,
+		acquisition.GiftFrom, bookID)
+
+	return err
+}
+
+func getBookAcquisition(db querier, book *BookInfo) error {
+	var purchasedOn sql.NullTime
+	var price sql.NullFloat64
+	var currency, store, giftFrom sql.NullString
+	err := db.QueryRow("SELECT purchased_on, purchase_price, currency, store, gift_from FROM books WHERE id = $1", book.ID).
+		Scan(&purchasedOn, &price, &currency, &store, &giftFrom)
+	if err != nil {
+		return err
+	}
+
+	book.PurchasedOn = formatOptionalDate(purchasedOn)
+	book.PurchasePrice = Price(price.Float64)
+	book.Currency = currency.String
+	book.Store = store.String
+	book.GiftFrom = giftFrom.String
+
+	return nil
+}
+
+// getSpendingByYear groups the bought books by year and currency. The year of a gift without a date is the year
+// it was added to the library.
+func getSpendingByYear(db *sql.DB) ([]SpendingYear, error) {
+	rows, err := db.Query(`SELECT EXTRACT(YEAR FROM COALESCE(b.purchased_on, b.added_on))::INTEGER,
+			COALESCE(b.currency, ''),
+			COUNT(*) FILTER (WHERE b.purchase_price IS NOT NULL),
+			COALESCE(SUM(b.purchase_price), 0),
+			COUNT(*) FILTER (WHERE b.gift_from IS NOT NULL)
+		FROM books b
+		WHERE b.deleted_at IS NULL AND (b.purchase_price IS NOT NULL OR b.gift_from IS NOT NULL)
+		GROUP BY 1, 2
+		ORDER BY 1 DESC, 2`)
+	if err != nil {
+		return []SpendingYear{}, err
+	}
+
+	defer rows.Close()
+
+	years := []SpendingYear{}
+	for rows.Next() {
+		var year SpendingYear
+		if err := rows.Scan(&year.Year, &year.Currency, &year.Bought, &year.Total, &year.Gifts); err != nil {
+			return []SpendingYear{}, err
+		}
+		years = append(years, year)
+	}
+
+	return years, rows.Err()
+}
+
+func SpendingReport(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can see the spending report", http.StatusForbidden)
+		return
+	}
+
+	years, err := getSpendingByYear(db)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(years)
+}
+
+func SpendingPage(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		redirectToErrorPageWithMessageAndStatusCode(w, "Only admins can see the spending report", http.StatusForbidden)
+		return
+	}
+
+	years, err := getSpendingByYear(db)
+	if err != nil {
+		log.Printf("error getting spending report: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	pageVariables := PageSpendingVariables{
+		Year:     now.Format("2006"),
+		SiteKey:  captcha.SiteKey,
+		Years:    years,
+		LoggedIn: true,
+	}
+
+	templateDir := os.Getenv("TEMPLATE_DIR")
+	if templateDir == "" {
+		templateDir = "internal/template" // default value for local development
+	}
+	templatePath := filepath.Join(templateDir, "admin_gastos.html")
+
+	t, err := template.ParseFiles(templatePath)
+	if err != nil {
+		log.Printf("template error: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "template error", http.StatusInternalServerError)
+		return
+	}
+
+	err = t.Execute(w, pageVariables)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("template error: %v", err)
+		return
+	}
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+const acquisitionsTOML = `
+[[book]]
+title = "Patria I, De la revolución de Ayutla a la Guerra de Reforma"
+author = "Paco Ignacio Taibo II"
+purchasedOn = "2023-11-04"
+purchasePrice = 349
+currency = "MXN"
+store = "Gandhi"
+
+[[book]]
+title = "El laberinto de la soledad"
+author = "Octavio Paz"
+purchasePrice = 189.999
+currency = "usd"
+
+[[book]]
+title = "Pedro Páramo"
+author = "Juan Rulfo"
+giftFrom = "Ana"
+`
+
+func TestAcquisitionFromBook(t *testing.T) {
+	var library Library
+	if _, err := toml.Decode(acquisitionsTOML, &library); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		purchasedOn string
+		price       float64
+		currency    string
+		store       string
+		giftFrom    string
+	}{
+		{"2023-11-04", 349, "MXN", "Gandhi", ""},
+		{"", 190, "USD", "", ""},
+		{"", 0, "", "", "Ana"},
+	}
+
+	if len(library.Book) != len(tests) {
+		t.Fatalf("decoded %d books, want %d", len(library.Book), len(tests))
+	}
+
+	for i, test := range tests {
+		book := library.Book[i]
+		acquisition, err := acquisitionFromBook(book)
+		if err != nil {
+			t.Errorf("acquisitionFromBook(%q) error = %v", book.Title, err)
+			continue
+		}
+
+		var purchasedOn string
+		if acquisition.PurchasedOn.Valid {
+			purchasedOn = acquisition.PurchasedOn.Time.Format(time.DateOnly)
+		}
+
+		if purchasedOn != test.purchasedOn || acquisition.Price.Float64 != test.price ||
+			acquisition.Currency.String != test.currency || acquisition.Store.String != test.store ||
+			acquisition.GiftFrom.String != test.giftFrom {
+			t.Errorf("acquisitionFromBook(%q) = %+v, want %+v", book.Title, acquisition, test)
+		}
+	}
+}
+
+func TestAcquisitionFromBookErrors(t *testing.T) {
+	tests := []BookInfo{
+		{Title: "Fecha inválida", PurchasedOn: "04/11/2023"},
+		{Title: "Moneda inválida", PurchasePrice: 100, Currency: "pesos"},
+	}
+
+	for _, book := range tests {
+		if _, err := acquisitionFromBook(book); err == nil {
+			t.Errorf("acquisitionFromBook(%q) should fail", book.Title)
+		}
+	}
+}
@@ -0,0 +1,579 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"leonlib/internal/captcha"
+)
+
+type AuditAction string
+
+const (
+	AuditCreate  AuditAction = "create"
+	AuditUpdate  AuditAction = "update"
+	AuditImport  AuditAction = "import"
+	AuditDelete  AuditAction = "delete"
+	AuditRestore AuditAction = "restore"
+	AuditPurge   AuditAction = "purge"
+	AuditMerge   AuditAction = "merge"
+	AuditRevert  AuditAction = "revert"
+)
+
+type AuditEntity string
+
+const (
+	AuditBook     AuditEntity = "book"
+	AuditImage    AuditEntity = "image"
+	AuditAuthor   AuditEntity = "author"
+	AuditLocation AuditEntity = "location"
+)
+
+var auditActions = []AuditAction{AuditCreate, AuditUpdate, AuditImport, AuditDelete, AuditRestore, AuditPurge, AuditMerge, AuditRevert}
+
+var auditEntities = []AuditEntity{AuditBook, AuditImage, AuditAuthor, AuditLocation}
+
+// AuditChange is the value of a field before and after the change; nil means the field was empty or did not exist.
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+type AuditEntry struct {
+	ID          int64                  `json:"id"`
+	ActorUserID string                 `json:"actor_user_id,omitempty"`
+	Actor       string                 `json:"actor,omitempty"`
+	Action      AuditAction            `json:"action"`
+	Entity      AuditEntity            `json:"entity"`
+	EntityID    int                    `json:"entity_id"`
+	Changes     map[string]AuditChange `json:"changes"`
+	CreatedAt   time.Time              `json:"created_at"`
+}
+
+// AuditField is a change formatted for the audit page.
+type AuditField struct {
+	Name   string
+	Before string
+	After  string
+}
+
+type PageAuditVariables struct {
+	Year       string
+	SiteKey    string
+	Entries    []AuditEntry
+	Filter     auditFilter
+	Actions    []AuditAction
+	Entities   []AuditEntity
+	Pagination Pagination
+	LoggedIn   bool
+}
+
+// auditFilter narrows the audit log; empty fields match every entry.
+type auditFilter struct {
+	Action   string
+	Entity   string
+	EntityID int
+	Actor    string
+	From     string
+	To       string
+}
+
+// auditBook is the part of a book recorded in the audit log.
+type auditBook struct {
+	Title          string   `json:"title,omitempty"`
+	Author         string   `json:"author,omitempty"`
+	Description    string   `json:"description,omitempty"`
+	ISBN10         string   `json:"isbn_10,omitempty"`
+	ISBN13         string   `json:"isbn_13,omitempty"`
+	Publisher      string   `json:"publisher,omitempty"`
+	PublishedYear  int      `json:"published_year,omitempty"`
+	PageCount      int      `json:"page_count,omitempty"`
+	Translator     string   `json:"translator,omitempty"`
+	Format         string   `json:"format,omitempty"`
+	Language       string   `json:"language,omitempty"`
+	ReadingStatus  string   `json:"reading_status,omitempty"`
+	StartedOn      string   `json:"started_on,omitempty"`
+	FinishedOn     string   `json:"finished_on,omitempty"`
+	GoodreadsLink  string   `json:"goodreads_link,omitempty"`
+	WorkID         int      `json:"work_id,omitempty"`
+	Series         string   `json:"series,omitempty"`
+	SeriesPosition float64  `json:"series_position,omitempty"`
+	Location       string   `json:"location,omitempty"`
+	Tags           []string `json:"tags,omitempty"`
+	Genres         []string `json:"genres,omitempty"`
+	PurchasedOn    string   `json:"purchased_on,omitempty"`
+	PurchasePrice  float64  `json:"purchase_price,omitempty"`
+	Currency       string   `json:"currency,omitempty"`
+	Store          string   `json:"store,omitempty"`
+	GiftFrom       string   `json:"gift_from,omitempty"`
+	Images         int      `json:"images,omitempty"`
+}
+
+func (aa AuditAction) Label() string {
+	switch aa {
+	case AuditCreate:
+		return "Alta"
+	case AuditUpdate:
+		return "Cambio"
+	case AuditImport:
+		return "Importación"
+	case AuditDelete:
+		return "A la papelera"
+	case AuditRestore:
+		return "Restaurado"
+	case AuditPurge:
+		return "Borrado definitivo"
+	case AuditMerge:
+		return "Fusión"
+	case AuditRevert:
+		return "Reversión"
+	default:
+		return string(aa)
+	}
+}
+
+func (ae AuditEntity) Label() string {
+	switch ae {
+	case AuditBook:
+		return "Libro"
+	case AuditImage:
+		return "Imagen"
+	case AuditAuthor:
+		return "Autor"
+	case AuditLocation:
+		return "Ubicación"
+	default:
+		return string(ae)
+	}
+}
+
+// Fields returns the changes ordered by field name.
+func (ae AuditEntry) Fields() []AuditField {
+	fields := make([]AuditField, 0, len(ae.Changes))
+	for name, change := range ae.Changes {
+		fields = append(fields, AuditField{Name: name, Before: auditValueLabel(change.Before), After: auditValueLabel(change.After)})
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Name < fields[j].Name
+	})
+
+	return fields
+}
+
+func auditValueLabel(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "—"
+	case string:
+		return v
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	}
+}
+
+func auditBookFromInfo(book BookInfo) auditBook {
+	snapshot := auditBook{
+		Title:          book.Title,
+		Author:         book.Author,
+		Description:    book.Description,
+		ISBN10:         book.ISBN10,
+		ISBN13:         book.ISBN13,
+		Publisher:      book.Publisher,
+		PublishedYear:  book.PublishedYear,
+		PageCount:      book.PageCount,
+		Translator:     book.Translator,
+		Format:         book.Format,
+		Language:       book.Language,
+		ReadingStatus:  string(book.ReadingStatus),
+		StartedOn:      book.StartedOn,
+		FinishedOn:     book.FinishedOn,
+		GoodreadsLink:  book.GoodreadsLink,
+		WorkID:         book.WorkID,
+		Series:         book.Series,
+		SeriesPosition: float64(book.SeriesPosition),
+		Location:       book.Location,
+		PurchasedOn:    book.PurchasedOn,
+		PurchasePrice:  float64(book.PurchasePrice),
+		Currency:       book.Currency,
+		Store:          book.Store,
+		GiftFrom:       book.GiftFrom,
+		Images:         len(book.Base64Images) + len(book.ImageNames),
+	}
+
+	for _, tag := range book.Tags {
+		snapshot.Tags = append(snapshot.Tags, tag.Name)
+	}
+	for _, genre := range book.Genres {
+		snapshot.Genres = append(snapshot.Genres, genre.Name)
+	}
+
+	return snapshot
+}
+
+// getBookDetails loads the book with everything that is kept in its history: tags, genres, series, location and
+// acquisition.
+func getBookDetails(db querier, bookID int) (BookInfo, error) {
+	book, err := getBookByID(db, bookID)
+	if err != nil {
+		return BookInfo{}, err
+	}
+	if book.ID == 0 {
+		return BookInfo{}, sql.ErrNoRows
+	}
+
+	if book.Tags, err = getBookTags(db, bookID); err != nil {
+		return BookInfo{}, err
+	}
+
+	if book.Genres, err = getBookGenres(db, bookID); err != nil {
+		return BookInfo{}, err
+	}
+
+	if err := getBookSeries(db, &book); err != nil {
+		return BookInfo{}, err
+	}
+
+	if err := getBookLocation(db, &book); err != nil {
+		return BookInfo{}, err
+	}
+
+	if err := getBookAcquisition(db, &book); err != nil {
+		return BookInfo{}, err
+	}
+
+	return book, nil
+}
+
+func getAuditBook(db querier, bookID int) (auditBook, error) {
+	book, err := getBookDetails(db, bookID)
+	if err != nil {
+		return auditBook{}, err
+	}
+
+	return auditBookFromInfo(book), nil
+}
+
+// auditFields turns a snapshot into its JSON fields; a nil snapshot has no fields.
+func auditFields(snapshot interface{}) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if snapshot == nil {
+		return fields, nil
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+// auditDiff keeps the fields that differ between the two snapshots.
+func auditDiff(before, after interface{}) (map[string]AuditChange, error) {
+	beforeFields, err := auditFields(before)
+	if err != nil {
+		return nil, err
+	}
+
+	afterFields, err := auditFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]AuditChange{}
+	for name, value := range beforeFields {
+		if !reflect.DeepEqual(value, afterFields[name]) {
+			changes[name] = AuditChange{Before: value, After: afterFields[name]}
+		}
+	}
+	for name, value := range afterFields {
+		if _, ok := beforeFields[name]; !ok {
+			changes[name] = AuditChange{After: value}
+		}
+	}
+
+	return changes, nil
+}
+
+// auditActor is the signed in user that makes the request; r is nil for the changes made by the app itself.
+func auditActor(r *http.Request) sql.NullString {
+	if r == nil {
+		return sql.NullString{}
+	}
+
+	userID, err := getCurrentUserID(r)
+	if err != nil {
+		return sql.NullString{}
+	}
+
+	return sql.NullString{String: userID, Valid: true}
+}
+
+// recordAudit appends the change to the audit log; r is nil for the changes made by the app itself, like the trash
+// purge. The change is already done, so a failure is logged instead of returned.
+func recordAudit(q execer, r *http.Request, action AuditAction, entity AuditEntity, entityID int, before, after interface{}) {
+	recordAuditAs(q, auditActor(r), action, entity, entityID, before, after)
+}
+
+// recordAuditAs is recordAudit for the work done outside the request, like a background import.
+func recordAuditAs(q execer, actor sql.NullString, action AuditAction, entity AuditEntity, entityID int, before, after interface{}) {
+	changes, err := auditDiff(before, after)
+	if err != nil {
+		log.Printf("error computing audit changes for %s %d: %v", entity, entityID, err)
+		return
+	}
+
+	if action == AuditUpdate && len(changes) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(changes)
+	if err != nil {
+		log.Printf("error encoding audit changes for %s %d: %v", entity, entityID, err)
+		return
+	}
+
+	_, err = q.Exec("INSERT INTO audit_log(actor_user_id, action, entity, entity_id, changes) VALUES($1, $2, $3, $4, $5)",
+		actor, action, entity, entityID, data)
+	if err != nil {
+		log.Printf("error recording %s of %s %d in the audit log: %v", action, entity, entityID, err)
+	}
+}
+
+func parseAuditFilter(r *http.Request) (auditFilter, error) {
+	query := r.URL.Query()
+	filter := auditFilter{
+		Action: strings.TrimSpace(query.Get("action")),
+		Entity: strings.TrimSpace(query.Get("entity")),
+		Actor:  strings.TrimSpace(query.Get("actor")),
+		From:   strings.TrimSpace(query.Get("from")),
+		To:     strings.TrimSpace(query.Get("to")),
+	}
+
+	if entityID := strings.TrimSpace(query.Get("entity_id")); entityID != "" {
+		id, err := strconv.Atoi(entityID)
+		if err != nil || id <= 0 {
+			return auditFilter{}, errors.New("entity_id must be a positive number")
+		}
+		filter.EntityID = id
+	}
+
+	for _, date := range []string{filter.From, filter.To} {
+		if _, err := parseOptionalDate(date); err != nil {
+			return auditFilter{}, err
+		}
+	}
+
+	return filter, nil
+}
+
+// auditFilterConditions uses $1 for the action, $2 for the entity, $3 for the entity id, $4 for the user id or email
+// of the actor, and $5 and $6 for the first and last day.
+const auditFilterConditions = `($1 = '' OR a.action = $1)
+	AND ($2 = '' OR a.entity = $2)
+	AND ($3 = 0 OR a.entity_id = $3)
+	AND ($4 = '' OR a.actor_user_id = $4 OR u.email ILIKE $4)
+	AND ($5 = '' OR a.created_at >= NULLIF($5, '')::DATE)
+	AND ($6 = '' OR a.created_at < NULLIF($6, '')::DATE + 1)`
+
+func (af auditFilter) args() []interface{} {
+	return []interface{}{af.Action, af.Entity, af.EntityID, af.Actor, af.From, af.To}
+}
+
+func countAuditEntries(db *sql.DB, filter auditFilter) (int, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM audit_log a LEFT JOIN users u ON u.user_id = a.actor_user_id
+		WHERE `+auditFilterConditions, filter.args()...).Scan(&count)
+
+	return count, err
+}
+
+// getAuditEntries returns the entries matching the filter, the latest first. A zero limit returns all of them.
+func getAuditEntries(db *sql.DB, filter auditFilter, limit, offset int) ([]AuditEntry, error) {
+	queryStr := `SELECT a.id, COALESCE(a.actor_user_id, ''), COALESCE(u.name, u.email, ''), a.action, a.entity, a.entity_id,
+			a.changes, a.created_at
+		FROM audit_log a
+		LEFT JOIN users u ON u.user_id = a.actor_user_id
+		WHERE ` + auditFilterConditions + `
+		ORDER BY a.id DESC`
+	args := filter.args()
+	if limit > 0 {
+		queryStr += ` LIMIT $7 OFFSET $8`
+		args = append(args, limit, offset)
+	}
+
+	rows, err := db.Query(queryStr, args...)
+	if err != nil {
+		return []AuditEntry{}, err
+	}
+
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		var changes []byte
+		if err := rows.Scan(&entry.ID, &entry.ActorUserID, &entry.Actor, &entry.Action, &entry.Entity, &entry.EntityID,
+			&changes, &entry.CreatedAt); err != nil {
+			return []AuditEntry{}, err
+		}
+		if err := json.Unmarshal(changes, &entry.Changes); err != nil {
+			return []AuditEntry{}, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func writeAuditCSV(w http.ResponseWriter, entries []AuditEntry) error {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit_log.csv"`)
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"id", "created_at", "actor_user_id", "actor", "action", "entity", "entity_id", "changes"}); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		changes, err := json.Marshal(entry.Changes)
+		if err != nil {
+			return err
+		}
+
+		err = writer.Write([]string{strconv.FormatInt(entry.ID, 10), entry.CreatedAt.Format(time.RFC3339), entry.ActorUserID,
+			entry.Actor, string(entry.Action), string(entry.Entity), strconv.Itoa(entry.EntityID), string(changes)})
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// AuditLog exports the entries matching the filter as JSON, or as CSV with format=csv.
+func AuditLog(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can see the audit log", http.StatusForbidden)
+		return
+	}
+
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, err := getAuditEntries(db, filter, 0, 0)
+	if err != nil {
+		log.Printf("error getting audit log: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "csv" {
+		if err := writeAuditCSV(w, entries); err != nil {
+			log.Printf("error writing audit log: %v", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(entries)
+}
+
+func AuditPage(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		redirectToErrorPageWithMessageAndStatusCode(w, "Only admins can see the audit log", http.StatusForbidden)
+		return
+	}
+
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		redirectToErrorPageWithMessageAndStatusCode(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	pagination := parsePagination(r)
+	total, err := countAuditEntries(db, filter)
+	if err != nil {
+		log.Printf("error counting audit entries: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+	pagination.setTotal(total)
+
+	entries, err := getAuditEntries(db, filter, pagination.PerPage, pagination.Offset())
+	if err != nil {
+		log.Printf("error getting audit entries: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	pageVariables := PageAuditVariables{
+		Year:       now.Format("2006"),
+		SiteKey:    captcha.SiteKey,
+		Entries:    entries,
+		Filter:     filter,
+		Actions:    auditActions,
+		Entities:   auditEntities,
+		Pagination: pagination,
+		LoggedIn:   true,
+	}
+
+	templateDir := os.Getenv("TEMPLATE_DIR")
+	if templateDir == "" {
+		templateDir = "internal/template" // default value for local development
+	}
+	templatePath := filepath.Join(templateDir, "admin_auditoria.html")
+
+	t, err := template.ParseFiles(templatePath)
+	if err != nil {
+		log.Printf("template error: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "template error", http.StatusInternalServerError)
+		return
+	}
+
+	err = t.Execute(w, pageVariables)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("template error: %v", err)
+		return
+	}
+}
+
+// recordBookAudit records the change of the book inside the transaction that made it, comparing before with how the
+// book is now.
+func recordBookAudit(tx *sql.Tx, r *http.Request, action AuditAction, bookID int, before interface{}) error {
+	after, err := getAuditBook(tx, bookID)
+	if err != nil {
+		return err
+	}
+
+	recordAudit(tx, r, action, AuditBook, bookID, before, after)
+
+	return nil
+}
@@ -0,0 +1,399 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"leonlib/internal/captcha"
+	"leonlib/internal/names"
+
+	"github.com/lib/pq"
+)
+
+// AuthorCluster is a group of authors that are probably the same person, with the proposed canonical name first.
+type AuthorCluster struct {
+	Canonical Author   `json:"canonical"`
+	Variants  []Author `json:"variants"`
+}
+
+type AuthorAlias struct {
+	Alias     string    `json:"alias"`
+	Author    Author    `json:"author"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type MergedBook struct {
+	ID     int    `json:"id"`
+	Title  string `json:"title"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+type AuthorMergeReport struct {
+	DryRun    bool         `json:"dry_run"`
+	Canonical Author       `json:"canonical"`
+	Aliases   []string     `json:"aliases"`
+	Books     []MergedBook `json:"books"`
+}
+
+type PageAuthorAliasesVariables struct {
+	Year     string
+	SiteKey  string
+	Clusters []AuthorCluster
+	Aliases  []AuthorAlias
+	LoggedIn bool
+}
+
+var errInvalidMerge = errors.New("invalid merge")
+
+type authorMergeRequest struct {
+	CanonicalID int   `json:"canonical_id"`
+	AliasIDs    []int `json:"alias_ids"`
+	DryRun      bool  `json:"dry_run"`
+}
+
+// proposeCanonical prefers the author with more books and, on a tie, the fuller name.
+func proposeCanonical(candidates []Author) int {
+	best := 0
+	for i, candidate := range candidates[1:] {
+		current := candidates[best]
+		switch {
+		case candidate.BookCount != current.BookCount:
+			if candidate.BookCount > current.BookCount {
+				best = i + 1
+			}
+		case len(candidate.Name) > len(current.Name):
+			best = i + 1
+		}
+	}
+
+	return best
+}
+
+func getAuthorClusters(db *sql.DB) ([]AuthorCluster, error) {
+	authors, err := getAllAuthors(db)
+	if err != nil {
+		return []AuthorCluster{}, err
+	}
+
+	authorNames := make([]string, len(authors))
+	for i, author := range authors {
+		authorNames[i] = author.Name
+	}
+
+	clusters := []AuthorCluster{}
+	for _, indexes := range names.Cluster(authorNames) {
+		candidates := make([]Author, len(indexes))
+		for i, index := range indexes {
+			candidates[i] = authors[index]
+		}
+
+		best := proposeCanonical(candidates)
+		cluster := AuthorCluster{Canonical: candidates[best]}
+		for i, candidate := range candidates {
+			if i != best {
+				cluster.Variants = append(cluster.Variants, candidate)
+			}
+		}
+		clusters = append(clusters, cluster)
+	}
+
+	return clusters, nil
+}
+
+func getAuthorAliases(db *sql.DB) ([]AuthorAlias, error) {
+	rows, err := db.Query(`SELECT aa.alias, aa.created_at, a.id, a.name, a.slug
+		FROM author_aliases aa
+		JOIN authors a ON a.id = aa.author_id
+		ORDER BY a.slug, aa.alias`)
+	if err != nil {
+		return []AuthorAlias{}, err
+	}
+
+	defer rows.Close()
+
+	aliases := []AuthorAlias{}
+	for rows.Next() {
+		var alias AuthorAlias
+		if err := rows.Scan(&alias.Alias, &alias.CreatedAt, &alias.Author.ID, &alias.Author.Name, &alias.Author.Slug); err != nil {
+			return []AuthorAlias{}, err
+		}
+		aliases = append(aliases, alias)
+	}
+
+	return aliases, rows.Err()
+}
+
+// resolveAuthorAliases replaces the names of a credit line that are recorded aliases with their canonical name.
+// The line is returned untouched when none of its names is an alias.
+func resolveAuthorAliases(db queryRower, credit string) (string, error) {
+	credits := splitAuthorNames(credit)
+	resolved := false
+	for i, name := range credits {
+		var canonical string
+		err := db.QueryRow(`SELECT a.name FROM author_aliases aa
+			JOIN authors a ON a.id = aa.author_id
+			WHERE aa.alias_slug = $1`, slugify(name)).Scan(&canonical)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		credits[i] = canonical
+		resolved = true
+	}
+
+	if !resolved {
+		return credit, nil
+	}
+
+	return joinAuthorNames(credits), nil
+}
+
+// creditLine aggregates the names of the credits as joinAuthorNames does.
+const creditLine = `CASE WHEN bool_or(a.name LIKE '%,%') THEN string_agg(a.name, '; ' ORDER BY ba.position)
+	ELSE string_agg(a.name, ', ' ORDER BY ba.position) END`
+
+// refreshBookCreditLines rewrites the author and translator columns of a book from its credits.
+func refreshBookCreditLines(tx *sql.Tx, bookID int) (string, error) {
+	var author string
+	err := tx.QueryRow(`UPDATE books b SET
+			author = COALESCE((SELECT `+creditLine+`
+				FROM book_authors ba JOIN authors a ON a.id = ba.author_id
+				WHERE ba.book_id = b.id AND ba.role = 'author'), b.author),
+			translator = (SELECT `+creditLine+`
+				FROM book_authors ba JOIN authors a ON a.id = ba.author_id
+				WHERE ba.book_id = b.id AND ba.role = 'translator')
+		WHERE b.id = $1
+		RETURNING b.author`, bookID).Scan(&author)
+
+	return author, err
+}
+
+// mergeAuthors moves every credit of the aliases to the canonical author, records the alias names and rewrites
+// the affected books, saving the change in their history for actor. With DryRun the transaction is rolled back, so
+// the report is only a preview.
+func mergeAuthors(db *sql.DB, actor sql.NullString, req authorMergeRequest) (AuthorMergeReport, error) {
+	if len(req.AliasIDs) == 0 {
+		return AuthorMergeReport{}, fmt.Errorf("%w: alias_ids is required", errInvalidMerge)
+	}
+
+	for _, aliasID := range req.AliasIDs {
+		if aliasID == req.CanonicalID {
+			return AuthorMergeReport{}, fmt.Errorf("%w: the canonical author cannot be one of the aliases", errInvalidMerge)
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return AuthorMergeReport{}, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	report := AuthorMergeReport{DryRun: req.DryRun, Aliases: []string{}, Books: []MergedBook{}}
+
+	err = tx.QueryRow("SELECT id, name, slug FROM authors WHERE id = $1 FOR UPDATE", req.CanonicalID).
+		Scan(&report.Canonical.ID, &report.Canonical.Name, &report.Canonical.Slug)
+	if errors.Is(err, sql.ErrNoRows) {
+		return AuthorMergeReport{}, fmt.Errorf("%w: author %d does not exist", errInvalidMerge, req.CanonicalID)
+	}
+	if err != nil {
+		return AuthorMergeReport{}, err
+	}
+
+	rows, err := tx.Query(`SELECT DISTINCT b.id, b.title, b.author
+		FROM books b
+		JOIN book_authors ba ON ba.book_id = b.id
+		WHERE ba.author_id = ANY($1)
+		ORDER BY b.id`, pq.Array(req.AliasIDs))
+	if err != nil {
+		return AuthorMergeReport{}, err
+	}
+
+	for rows.Next() {
+		var book MergedBook
+		if err := rows.Scan(&book.ID, &book.Title, &book.Before); err != nil {
+			rows.Close()
+			return AuthorMergeReport{}, err
+		}
+		report.Books = append(report.Books, book)
+	}
+	rows.Close()
+
+	var before []BookInfo
+	for _, book := range report.Books {
+		details, err := getBookDetails(tx, book.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Books in the trash are rewritten too, but their history is not kept.
+			continue
+		}
+		if err != nil {
+			return AuthorMergeReport{}, err
+		}
+		before = append(before, details)
+	}
+
+	for _, aliasID := range req.AliasIDs {
+		var alias Author
+		err := tx.QueryRow("SELECT id, name, slug FROM authors WHERE id = $1 FOR UPDATE", aliasID).Scan(&alias.ID, &alias.Name, &alias.Slug)
+		if errors.Is(err, sql.ErrNoRows) {
+			return AuthorMergeReport{}, fmt.Errorf("%w: author %d does not exist", errInvalidMerge, aliasID)
+		}
+		if err != nil {
+			return AuthorMergeReport{}, err
+		}
+
+		_, err = tx.Exec(`INSERT INTO author_aliases(alias_slug, alias, author_id) VALUES($1, $2, $3)
+			ON CONFLICT (alias_slug) DO UPDATE SET author_id = EXCLUDED.author_id`, alias.Slug, alias.Name, report.Canonical.ID)
+		if err != nil {
+			return AuthorMergeReport{}, err
+		}
+
+		if _, err = tx.Exec("UPDATE author_aliases SET author_id = $1 WHERE author_id = $2", report.Canonical.ID, alias.ID); err != nil {
+			return AuthorMergeReport{}, err
+		}
+
+		_, err = tx.Exec(`UPDATE book_authors ba SET author_id = $1
+			WHERE ba.author_id = $2
+			  AND NOT EXISTS (SELECT 1 FROM book_authors o WHERE o.book_id = ba.book_id AND o.author_id = $1 AND o.role = ba.role)`,
+			report.Canonical.ID, alias.ID)
+		if err != nil {
+			return AuthorMergeReport{}, err
+		}
+
+		// Credits the canonical author already had are removed with the alias.
+		if _, err = tx.Exec("DELETE FROM authors WHERE id = $1", alias.ID); err != nil {
+			return AuthorMergeReport{}, err
+		}
+
+		report.Aliases = append(report.Aliases, alias.Name)
+	}
+
+	for i := range report.Books {
+		report.Books[i].After, err = refreshBookCreditLines(tx, report.Books[i].ID)
+		if err != nil {
+			return AuthorMergeReport{}, err
+		}
+	}
+
+	if req.DryRun {
+		return report, nil
+	}
+
+	for i, aliasID := range req.AliasIDs {
+		recordAuditAs(tx, actor, AuditMerge, AuditAuthor, aliasID, map[string]interface{}{"name": report.Aliases[i]},
+			map[string]interface{}{"merged_into": report.Canonical.Name})
+	}
+	for _, book := range before {
+		if err := recordBookEditIn(tx, actor, AuditUpdate, book, 0); err != nil {
+			return AuthorMergeReport{}, err
+		}
+	}
+
+	return report, tx.Commit()
+}
+
+func AuthorClusters(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can normalize authors", http.StatusForbidden)
+		return
+	}
+
+	clusters, err := getAuthorClusters(db)
+	if err != nil {
+		writeErrorGeneralStatus(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(clusters)
+}
+
+func MergeAuthors(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can normalize authors", http.StatusForbidden)
+		return
+	}
+
+	var req authorMergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Error al decodificar el cuerpo de la solicitud", http.StatusBadRequest)
+		return
+	}
+
+	report, err := mergeAuthors(db, auditActor(r), req)
+	if errors.Is(err, errInvalidMerge) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("error merging authors: %v", err)
+		writeErrorGeneralStatus(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+func AuthorAliasesPage(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		redirectToErrorPageWithMessageAndStatusCode(w, "Only admins can normalize authors", http.StatusForbidden)
+		return
+	}
+
+	clusters, err := getAuthorClusters(db)
+	if err != nil {
+		log.Printf("error getting author clusters: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	aliases, err := getAuthorAliases(db)
+	if err != nil {
+		log.Printf("error getting author aliases: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	pageVariables := PageAuthorAliasesVariables{
+		Year:     now.Format("2006"),
+		SiteKey:  captcha.SiteKey,
+		Clusters: clusters,
+		Aliases:  aliases,
+		LoggedIn: true,
+	}
+
+	templateDir := os.Getenv("TEMPLATE_DIR")
+	if templateDir == "" {
+		templateDir = "internal/template" // default value for local development
+	}
+	templatePath := filepath.Join(templateDir, "admin_autores.html")
+
+	t, err := template.ParseFiles(templatePath)
+	if err != nil {
+		log.Printf("template error: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "template error", http.StatusInternalServerError)
+		return
+	}
+
+	err = t.Execute(w, pageVariables)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("template error: %v", err)
+		return
+	}
+}
@@ -0,0 +1,477 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"leonlib/internal/captcha"
+	"leonlib/internal/names"
+
+	"github.com/gorilla/mux"
+)
+
+type AuthorRole string
+
+const (
+	RoleAuthor      AuthorRole = "author"
+	RoleTranslator  AuthorRole = "translator"
+	RoleIllustrator AuthorRole = "illustrator"
+	RoleEditor      AuthorRole = "editor"
+)
+
+var (
+	// authorSeparator splits a credit line such as "Neil Gaiman & Terry Pratchett" into names. Commas are handled
+	// by splitAuthorNames, as they also appear inside a name.
+	authorSeparator = regexp.MustCompile(`\s*[;&/]\s*`)
+	slugInvalid     = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+type Author struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Slug      string `json:"slug"`
+	BookCount int    `json:"book_count"`
+}
+
+// BookAuthor is a person credited in a book with a given role.
+type BookAuthor struct {
+	AuthorID int        `json:"author_id"`
+	Name     string     `json:"name"`
+	Slug     string     `json:"slug"`
+	Role     AuthorRole `json:"role"`
+}
+
+type AuthorBook struct {
+	Book BookInfo
+	Role AuthorRole
+}
+
+type AuthorIndexGroup struct {
+	Letter  string
+	Authors []Author
+}
+
+type PageAuthorVariables struct {
+	Year     string
+	SiteKey  string
+	Author   Author
+	Books    []AuthorBook
+	LoggedIn bool
+}
+
+type bookCreditRequest struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+func (ar AuthorRole) Label() string {
+	switch ar {
+	case RoleAuthor:
+		return "Autor"
+	case RoleTranslator:
+		return "Traductor"
+	case RoleIllustrator:
+		return "Ilustrador"
+	case RoleEditor:
+		return "Editor"
+	default:
+		return string(ar)
+	}
+}
+
+func parseAuthorRole(input string) (AuthorRole, error) {
+	switch role := AuthorRole(strings.ToLower(strings.TrimSpace(input))); role {
+	case "":
+		return RoleAuthor, nil
+	case RoleAuthor, RoleTranslator, RoleIllustrator, RoleEditor:
+		return role, nil
+	default:
+		return "", fmt.Errorf("invalid role: %q", input)
+	}
+}
+
+func slugify(name string) string {
+	slug := names.StripAccents(name)
+	slug = slugInvalid.ReplaceAllString(slug, "-")
+
+	return strings.Trim(slug, "-")
+}
+
+// splitAuthorNames returns the people of a credit line. Commas separate names too, except before a suffix such as
+// "Jr." and in a single "Last, First" name, told apart from two names by one of its sides being a single word.
+// The rules must match split_author_credit in database/sql/10_authors.sql.
+func splitAuthorNames(credit string) []string {
+	var result []string
+	for _, part := range authorSeparator.Split(credit, -1) {
+		var pieces []string
+		for _, piece := range strings.Split(part, ",") {
+			piece = strings.TrimSpace(piece)
+			switch {
+			case piece == "":
+			case len(pieces) > 0 && names.IsSuffix(piece):
+				pieces[len(pieces)-1] += ", " + piece
+			default:
+				pieces = append(pieces, piece)
+			}
+		}
+
+		if len(pieces) == 2 && (len(strings.Fields(pieces[0])) == 1 || len(strings.Fields(pieces[1])) == 1) {
+			pieces = []string{pieces[0] + ", " + pieces[1]}
+		}
+		result = append(result, pieces...)
+	}
+
+	return result
+}
+
+// joinAuthorNames writes the names as a credit line that splitAuthorNames reads back: names with a comma are
+// separated by semicolons.
+func joinAuthorNames(list []string) string {
+	for _, name := range list {
+		if strings.Contains(name, ",") {
+			return strings.Join(list, "; ")
+		}
+	}
+
+	return strings.Join(list, ", ")
+}
+
+// findOrCreateAuthor returns the author whose slug matches the name, so "José Saramago" and "Jose Saramago"
+// are the same person. Names recorded as aliases resolve to their canonical author.
+func findOrCreateAuthor(q queryRower, name string) (int, error) {
+	slug := slugify(name)
+	if slug == "" {
+		return 0, fmt.Errorf("invalid author name: %q", name)
+	}
+
+	var authorID int
+	err := q.QueryRow("SELECT author_id FROM author_aliases WHERE alias_slug = $1", slug).Scan(&authorID)
+	if err == nil || !errors.Is(err, sql.ErrNoRows) {
+		return authorID, err
+	}
+
+	err = q.QueryRow(`INSERT INTO authors(name, slug) VALUES($1, $2)
+		ON CONFLICT (slug) DO UPDATE SET name = authors.name
+		RETURNING id`, strings.TrimSpace(name), slug).Scan(&authorID)
+
+	return authorID, err
+}
+
+func replaceBookCredits(tx sqlExecutor, bookID int, role AuthorRole, names []string) error {
+	if _, err := tx.Exec("DELETE FROM book_authors WHERE book_id = $1 AND role = $2", bookID, role); err != nil {
+		return err
+	}
+
+	for position, name := range names {
+		authorID, err := findOrCreateAuthor(tx, name)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`INSERT INTO book_authors(book_id, author_id, role, position) VALUES($1, $2, $3, $4)
+			ON CONFLICT DO NOTHING`, bookID, authorID, role, position)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// replaceAuthorAndTranslatorCredits rebuilds the author and translator credits of a book from its author and
+// translator fields. Illustrators and editors are only managed through the credits API, so they are kept.
+func replaceAuthorAndTranslatorCredits(q sqlExecutor, bookID int, author, translator string) error {
+	if err := replaceBookCredits(q, bookID, RoleAuthor, splitAuthorNames(author)); err != nil {
+		return err
+	}
+
+	return replaceBookCredits(q, bookID, RoleTranslator, splitAuthorNames(translator))
+}
+
+func getBookAuthors(db *sql.DB, bookID int) ([]BookAuthor, error) {
+	rows, err := db.Query(`SELECT a.id, a.name, a.slug, ba.role
+		FROM book_authors ba
+		JOIN authors a ON a.id = ba.author_id
+		WHERE ba.book_id = $1
+		ORDER BY ba.role, ba.position`, bookID)
+	if err != nil {
+		return []BookAuthor{}, err
+	}
+
+	defer rows.Close()
+
+	credits := []BookAuthor{}
+	for rows.Next() {
+		var credit BookAuthor
+		if err := rows.Scan(&credit.AuthorID, &credit.Name, &credit.Slug, &credit.Role); err != nil {
+			return []BookAuthor{}, err
+		}
+		credits = append(credits, credit)
+	}
+
+	return credits, rows.Err()
+}
+
+// getAllAuthors returns the authors credited in at least one book, with the number of books of each one.
+func getAllAuthors(db *sql.DB) ([]Author, error) {
+	rows, err := db.Query(`SELECT a.id, a.name, a.slug, COUNT(DISTINCT ba.book_id)
+		FROM authors a
+		JOIN book_authors ba ON ba.author_id = a.id
+		JOIN books b ON b.id = ba.book_id AND b.deleted_at IS NULL
+		GROUP BY a.id
+		ORDER BY a.slug`)
+	if err != nil {
+		return []Author{}, err
+	}
+
+	defer rows.Close()
+
+	var authors []Author
+	for rows.Next() {
+		var author Author
+		if err := rows.Scan(&author.ID, &author.Name, &author.Slug, &author.BookCount); err != nil {
+			return []Author{}, err
+		}
+		authors = append(authors, author)
+	}
+
+	return authors, rows.Err()
+}
+
+// groupAuthorsByInitial expects the authors ordered by slug.
+func groupAuthorsByInitial(authors []Author) []AuthorIndexGroup {
+	var groups []AuthorIndexGroup
+	for _, author := range authors {
+		letter := strings.ToUpper(author.Slug[:1])
+		if letter < "A" || letter > "Z" {
+			letter = "#"
+		}
+
+		if len(groups) == 0 || groups[len(groups)-1].Letter != letter {
+			groups = append(groups, AuthorIndexGroup{Letter: letter})
+		}
+		groups[len(groups)-1].Authors = append(groups[len(groups)-1].Authors, author)
+	}
+
+	return groups
+}
+
+func getAuthorBySlug(db *sql.DB, slug string) (Author, error) {
+	var author Author
+	err := db.QueryRow(`SELECT a.id, a.name, a.slug, COUNT(DISTINCT ba.book_id)
+		FROM authors a
+		LEFT JOIN (book_authors ba JOIN books b ON b.id = ba.book_id AND b.deleted_at IS NULL) ON ba.author_id = a.id
+		WHERE a.slug = $1
+		GROUP BY a.id`, slug).Scan(&author.ID, &author.Name, &author.Slug, &author.BookCount)
+
+	return author, err
+}
+
+func getBooksByAuthorID(db *sql.DB, authorID int) ([]AuthorBook, error) {
+	rows, err := db.Query(`SELECT `+bookColumns+`, ba.role
+		FROM book_authors ba
+		JOIN books b ON b.id = ba.book_id
+		WHERE ba.author_id = $1 AND b.deleted_at IS NULL
+		ORDER BY ba.role, b.published_year NULLS LAST, b.title`, authorID)
+	if err != nil {
+		return []AuthorBook{}, err
+	}
+
+	defer rows.Close()
+
+	var books []AuthorBook
+	for rows.Next() {
+		var role AuthorRole
+		bookInfo, err := scanBookInfo(rows, &role)
+		if err != nil {
+			return []AuthorBook{}, err
+		}
+
+		bookImages, err := getImagesByBookID(db, bookInfo.ID)
+		if err != nil {
+			return []AuthorBook{}, err
+		}
+		bookInfo.Base64Images = bookImages
+
+		books = append(books, AuthorBook{Book: bookInfo, Role: role})
+	}
+
+	return books, rows.Err()
+}
+
+func AuthorPage(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	author, err := getAuthorBySlug(db, mux.Vars(r)["slug"])
+	if errors.Is(err, sql.ErrNoRows) {
+		redirectToErrorPageWithMessageAndStatusCode(w, "Author not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("error getting author: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	books, err := getBooksByAuthorID(db, author.ID)
+	if err != nil {
+		log.Printf("error getting books by author: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	pageVariables := PageAuthorVariables{
+		Year:    now.Format("2006"),
+		SiteKey: captcha.SiteKey,
+		Author:  author,
+		Books:   books,
+	}
+
+	_, err = getCurrentUserID(r)
+	pageVariables.LoggedIn = err == nil
+
+	templateDir := os.Getenv("TEMPLATE_DIR")
+	if templateDir == "" {
+		templateDir = "internal/template" // default value for local development
+	}
+	templatePath := filepath.Join(templateDir, "autor.html")
+
+	t, err := template.ParseFiles(templatePath)
+	if err != nil {
+		log.Printf("template error: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "template error", http.StatusInternalServerError)
+		return
+	}
+
+	err = t.Execute(w, pageVariables)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("template error: %v", err)
+		return
+	}
+}
+
+func BookCredits(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	bookID, err := parseBookIDVar(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	credits, err := getBookAuthors(db, bookID)
+	if err != nil {
+		log.Printf("error getting book credits: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(credits)
+}
+
+// UpdateBookCredits replaces every credit of a book. The author and translator columns of the book are
+// rewritten from the new credits so the search keeps working.
+func UpdateBookCredits(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can change the credits of a book", http.StatusForbidden)
+		return
+	}
+
+	bookID, err := parseBookIDVar(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req []bookCreditRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Error al decodificar el cuerpo de la solicitud", http.StatusBadRequest)
+		return
+	}
+
+	namesByRole := map[AuthorRole][]string{}
+	for _, credit := range req {
+		role, err := parseAuthorRole(credit.Role)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if slugify(credit.Name) == "" {
+			http.Error(w, "name is required", http.StatusBadRequest)
+			return
+		}
+		namesByRole[role] = append(namesByRole[role], strings.TrimSpace(credit.Name))
+	}
+
+	if len(namesByRole[RoleAuthor]) == 0 {
+		http.Error(w, "at least one author is required", http.StatusBadRequest)
+		return
+	}
+
+	before, err := getBookDetails(db, bookID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Book not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeErrorGeneralStatus(w, err)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeErrorGeneralStatus(w, err)
+		return
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	result, err := tx.Exec("UPDATE books SET author = $1, translator = $2 WHERE id = $3",
+		joinAuthorNames(namesByRole[RoleAuthor]), nullableString(joinAuthorNames(namesByRole[RoleTranslator])), bookID)
+	if err != nil {
+		writeErrorGeneralStatus(w, err)
+		return
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		http.Error(w, "Book not found", http.StatusNotFound)
+		return
+	}
+
+	for _, role := range []AuthorRole{RoleAuthor, RoleTranslator, RoleIllustrator, RoleEditor} {
+		if err := replaceBookCredits(tx, bookID, role, namesByRole[role]); err != nil {
+			writeErrorGeneralStatus(w, err)
+			return
+		}
+	}
+
+	if err := recordBookEditIn(tx, auditActor(r), AuditUpdate, before, 0); err != nil {
+		writeErrorGeneralStatus(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeErrorGeneralStatus(w, err)
+		return
+	}
+
+	credits, err := getBookAuthors(db, bookID)
+	if err != nil {
+		writeErrorGeneralStatus(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(credits)
+}
@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitAuthorNames(t *testing.T) {
+	tests := []struct {
+		credit string
+		want   []string
+	}{
+		{"Neil Gaiman & Terry Pratchett", []string{"Neil Gaiman", "Terry Pratchett"}},
+		{"Kathy Sierra, Bert Bates", []string{"Kathy Sierra", "Bert Bates"}},
+		{"Henry S. Warren, JR.", []string{"Henry S. Warren, JR."}},
+		{"Albert Harkness, Jr.; Charles Short", []string{"Albert Harkness, Jr.", "Charles Short"}},
+		{"Rulfo, Juan", []string{"Rulfo, Juan"}},
+		{"García Márquez, Gabriel / Borges, Jorge Luis", []string{"García Márquez, Gabriel", "Borges, Jorge Luis"}},
+		{"A. Aberastury, M. Knobel", []string{"A. Aberastury", "M. Knobel"}},
+		{"Thomas H. Cormen, Charles E. Leiserson, Ronald L. Rivest",
+			[]string{"Thomas H. Cormen", "Charles E. Leiserson", "Ronald L. Rivest"}},
+		{" , ", nil},
+	}
+
+	for _, test := range tests {
+		got := splitAuthorNames(test.credit)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitAuthorNames(%q) = %q, want %q", test.credit, got, test.want)
+		}
+
+		if len(got) > 0 {
+			if again := splitAuthorNames(joinAuthorNames(got)); !reflect.DeepEqual(again, got) {
+				t.Errorf("splitAuthorNames(joinAuthorNames(%q)) = %q", got, again)
+			}
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"leonlib/internal/isbn"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// bookISBN is the normalized pair stored in books.isbn_10 and books.isbn_13.
+type bookISBN struct {
+	ISBN10 sql.NullString
+	ISBN13 sql.NullString
+}
+
+// parseBookISBN accepts an ISBN-10 or ISBN-13 and returns both forms; ISBN-13 codes with a 979 prefix have no ISBN-10.
+func parseBookISBN(input string) (bookISBN, error) {
+	if strings.TrimSpace(input) == "" {
+		return bookISBN{}, nil
+	}
+
+	isbn13, err := isbn.Normalize(input)
+	if err != nil {
+		return bookISBN{}, err
+	}
+
+	result := bookISBN{ISBN13: sql.NullString{String: isbn13, Valid: true}}
+	if isbn10, err := isbn.ToISBN10(isbn13); err == nil {
+		result.ISBN10 = sql.NullString{String: isbn10, Valid: true}
+	}
+
+	return result, nil
+}
+
+// resolveBookISBN picks the ISBN to store from the ISBN-13 and ISBN-10 values of a book, checking both agree.
+func resolveBookISBN(isbn13, isbn10 string) (bookISBN, error) {
+	from13, err := parseBookISBN(isbn13)
+	if err != nil {
+		return bookISBN{}, err
+	}
+
+	from10, err := parseBookISBN(isbn10)
+	if err != nil {
+		return bookISBN{}, err
+	}
+
+	if from13.ISBN13.Valid && from10.ISBN13.Valid && from13.ISBN13.String != from10.ISBN13.String {
+		return bookISBN{}, errors.New("isbn: ISBN-10 and ISBN-13 refer to different books")
+	}
+
+	if from13.ISBN13.Valid {
+		return from13, nil
+	}
+
+	return from10, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func getBookIDByISBN(db *sql.DB, isbn13 string) (int, error) {
+	var bookID int
+	err := db.QueryRow("SELECT id FROM books WHERE isbn_13 = $1 AND deleted_at IS NULL", isbn13).Scan(&bookID)
+
+	return bookID, err
+}
+
+func BookByISBN(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	isbn13, err := isbn.Normalize(mux.Vars(r)["isbn"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bookID, err := getBookIDByISBN(db, isbn13)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Book not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("error getting book by isbn: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	book, err := getBookByID(db, bookID)
+	if err != nil {
+		log.Printf("error getting book by id: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	type BookDetail struct {
+		ID            int             `json:"id"`
+		Title         string          `json:"title"`
+		Author        string          `json:"author"`
+		Description   string          `json:"description"`
+		ISBN10        string          `json:"isbn_10"`
+		ISBN13        string          `json:"isbn_13"`
+		ReadingStatus ReadingStatus   `json:"reading_status"`
+		AddedOn       string          `json:"added_on"`
+		GoodreadsLink string          `json:"goodreads_link"`
+		Base64Images  []BookImageInfo `json:"images"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(BookDetail{
+		ID:            book.ID,
+		Title:         book.Title,
+		Author:        book.Author,
+		Description:   book.Description,
+		ISBN10:        book.ISBN10,
+		ISBN13:        book.ISBN13,
+		ReadingStatus: book.ReadingStatus,
+		AddedOn:       book.AddedOn,
+		GoodreadsLink: book.GoodreadsLink,
+		Base64Images:  book.Base64Images,
+	})
+}
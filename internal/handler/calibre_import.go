@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"leonlib/internal/calibre"
+	"leonlib/internal/isbn"
+)
+
+// bookFromCalibre maps a book of a Calibre library to the fields of the import; its cover is read from the directory
+// of the book.
+func bookFromCalibre(book calibre.Book, format string) (BookInfo, error) {
+	info := BookInfo{
+		Title:          strings.TrimSpace(book.Title),
+		Author:         strings.Join(book.Authors, " & "),
+		Description:    book.Description(),
+		Publisher:      book.Publisher,
+		Format:         format,
+		Language:       book.Language,
+		Series:         book.Series,
+		SeriesPosition: SeriesPosition(book.SeriesIndex),
+		ImageNames:     []string{},
+	}
+
+	if book.Series == "" {
+		info.SeriesPosition = 0
+	}
+
+	if !book.Published.IsZero() {
+		info.PublishedYear = book.Published.Year()
+	}
+
+	if !book.Added.IsZero() {
+		info.AddedOn = book.Added.Format("2006-01-02")
+	}
+
+	// Calibre keeps whatever metadata sources return; an ISBN that does not validate is left out rather than
+	// failing the book.
+	if code := isbn.Clean(book.ISBN()); code != "" {
+		if _, err := isbn.Normalize(code); err == nil {
+			if len(code) == 10 {
+				info.ISBN10 = code
+			} else {
+				info.ISBN13 = code
+			}
+		}
+	}
+
+	if goodreadsID := book.Identifiers["goodreads"]; goodreadsID != "" {
+		info.GoodreadsLink = goodreadsBookURL + goodreadsID
+	}
+
+	for _, name := range book.Tags {
+		tag, err := newTag(name)
+		if err != nil {
+			return info, err
+		}
+		info.Tags = append(info.Tags, tag)
+	}
+
+	if cover := book.CoverPath(); cover != "" {
+		info.ImageNames = append(info.ImageNames, filepath.Base(cover))
+	}
+
+	return info, nil
+}
+
+// calibreFields are the catalog fields a Calibre library has for every book. The ISBN and the Goodreads link are
+// only applied to a book already in the catalog when Calibre knows them.
+func calibreFields(info BookInfo) map[string]bool {
+	fields := map[string]bool{}
+	for _, field := range []string{
+		"title", "author", "description", "publisher", "publishedYear", "format", "language", "series",
+		"seriesPosition", "tags", "imageNames", "addedOn",
+	} {
+		fields[field] = true
+	}
+
+	if info.ISBN10 != "" || info.ISBN13 != "" {
+		fields["isbn10"], fields["isbn13"] = true, true
+	}
+	if info.GoodreadsLink != "" {
+		fields["goodreadsLink"] = true
+	}
+
+	return fields
+}
+
+// ImportCalibre imports the books of the Calibre library in libraryDir with the given format, "ebook" for the usual
+// library of EPUB files, reading the covers from the directory of each book. The index of every entry of the report
+// is the id of the book in Calibre.
+func ImportCalibre(db *sql.DB, libraryDir, format string, dryRun bool) (ImportReport, error) {
+	books, err := calibre.ReadLibrary(libraryDir)
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	rows := make([]importRow, 0, len(books))
+	for _, book := range books {
+		info, err := bookFromCalibre(book, format)
+		row := importRow{Index: book.ID, Book: info, Fields: calibreFields(info), Err: err}
+		// The cover is read from the directory of the book, which must be inside the library.
+		if cover := book.CoverPath(); cover != "" {
+			row.ImagesDir = filepath.Join(libraryDir, filepath.Dir(cover))
+			if !filepath.IsLocal(cover) && row.Err == nil {
+				row.Err = fmt.Errorf("invalid book path %q", book.Path)
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	return importLibrary(db, sql.NullString{}, rows, libraryDir, dryRun, func(int) {})
+}
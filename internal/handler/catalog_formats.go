@@ -0,0 +1,591 @@
+package handler
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"leonlib/internal/captcha"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	CatalogCSV  = "csv"
+	CatalogJSON = "json"
+)
+
+// catalogFields are the columns of the CSV and JSON catalogs, in order. id and likes are only exported: the import
+// ignores them.
+var catalogFields = []string{
+	"id", "title", "author", "description", "isbn10", "isbn13", "publisher", "publishedYear", "pageCount",
+	"translator", "format", "language", "series", "seriesPosition", "readingStatus", "startedOn", "finishedOn",
+	"tags", "genres", "location", "imageNames", "addedOn", "goodreadsLink", "purchasedOn", "purchasePrice", "currency", "store",
+	"giftFrom", "likes",
+}
+
+var errUnknownCatalogFormat = errors.New("format must be csv or json")
+
+// ColumnMapping gives the column used in the file for a field of the catalog, e.g. title=Título; the fields that
+// are not mapped use their own name.
+type ColumnMapping map[string]string
+
+// ParseColumnMapping reads a mapping written as field=column pairs separated by commas or new lines.
+func ParseColumnMapping(input string) (ColumnMapping, error) {
+	mapping := ColumnMapping{}
+	for _, pair := range strings.FieldsFunc(input, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		field, column, found := strings.Cut(pair, "=")
+		field, column = strings.TrimSpace(field), strings.TrimSpace(column)
+		if !found || column == "" {
+			return ColumnMapping{}, fmt.Errorf("invalid column mapping %q, expected field=column", pair)
+		}
+
+		known := ""
+		for _, catalogField := range catalogFields {
+			if strings.EqualFold(catalogField, field) {
+				known = catalogField
+			}
+		}
+		if known == "" {
+			return ColumnMapping{}, fmt.Errorf("unknown field %q in the column mapping", field)
+		}
+
+		mapping[known] = column
+	}
+
+	return mapping, nil
+}
+
+func (cm ColumnMapping) column(field string) string {
+	if column, ok := cm[field]; ok {
+		return column
+	}
+
+	return field
+}
+
+// field returns the field a column of the file holds, or an empty string for the columns that are not imported.
+func (cm ColumnMapping) field(column string) string {
+	column = strings.TrimSpace(column)
+	for field, mapped := range cm {
+		if strings.EqualFold(mapped, column) {
+			return field
+		}
+	}
+
+	for _, field := range catalogFields {
+		if _, renamed := cm[field]; !renamed && strings.EqualFold(field, column) {
+			return field
+		}
+	}
+
+	return ""
+}
+
+func parseCatalogFormat(input string) (string, error) {
+	format := strings.ToLower(strings.TrimSpace(input))
+	if format != CatalogCSV && format != CatalogJSON {
+		return "", errUnknownCatalogFormat
+	}
+
+	return format, nil
+}
+
+// catalogRecord returns the values of the book by field; the numbers that are not set are nil.
+func catalogRecord(book exportBook) map[string]interface{} {
+	optionalInt := func(value int) interface{} {
+		if value == 0 {
+			return nil
+		}
+		return value
+	}
+	optionalFloat := func(value float64) interface{} {
+		if value == 0 {
+			return nil
+		}
+		return value
+	}
+
+	tags := book.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	genres := book.Genres
+	if genres == nil {
+		genres = []string{}
+	}
+
+	return map[string]interface{}{
+		"id":             book.ID,
+		"title":          book.Title,
+		"author":         book.Author,
+		"description":    book.Description,
+		"isbn10":         book.ISBN10,
+		"isbn13":         book.ISBN13,
+		"publisher":      book.Publisher,
+		"publishedYear":  optionalInt(book.PublishedYear),
+		"pageCount":      optionalInt(book.PageCount),
+		"translator":     book.Translator,
+		"format":         book.Format,
+		"language":       book.Language,
+		"series":         book.Series,
+		"seriesPosition": optionalFloat(book.SeriesPosition),
+		"readingStatus":  book.ReadingStatus,
+		"startedOn":      book.StartedOn,
+		"finishedOn":     book.FinishedOn,
+		"tags":           tags,
+		"genres":         genres,
+		"location":       book.Location,
+		"imageNames":     book.ImageNames,
+		"addedOn":        book.AddedOn,
+		"goodreadsLink":  book.GoodreadsLink,
+		"purchasedOn":    book.PurchasedOn,
+		"purchasePrice":  optionalFloat(book.PurchasePrice),
+		"currency":       book.Currency,
+		"store":          book.Store,
+		"giftFrom":       book.GiftFrom,
+		"likes":          book.Likes,
+	}
+}
+
+// formatCatalogValue writes a value in a CSV cell; lists are separated by commas.
+func formatCatalogValue(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case int:
+		return strconv.Itoa(value)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	case []string:
+		return strings.Join(value, ", ")
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			values = append(values, formatCatalogValue(item))
+		}
+		return strings.Join(values, ", ")
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+func writeCatalogCSV(out io.Writer, books []exportBook, mapping ColumnMapping) error {
+	writer := csv.NewWriter(out)
+
+	header := make([]string, 0, len(catalogFields))
+	for _, field := range catalogFields {
+		header = append(header, mapping.column(field))
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, book := range books {
+		record := catalogRecord(book)
+		row := make([]string, 0, len(catalogFields))
+		for _, field := range catalogFields {
+			row = append(row, formatCatalogValue(record[field]))
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func writeCatalogJSON(out io.Writer, books []exportBook, mapping ColumnMapping) error {
+	records := make([]map[string]interface{}, 0, len(books))
+	for _, book := range books {
+		record := map[string]interface{}{}
+		for field, value := range catalogRecord(book) {
+			record[mapping.column(field)] = value
+		}
+		records = append(records, record)
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(records)
+}
+
+// ExportCatalog writes the catalog as CSV or JSON, with the likes of each book and the names of its images;
+// saveImage is as in getExportBooks.
+func ExportCatalog(db *sql.DB, out io.Writer, format string, mapping ColumnMapping, saveImage func(name string, image []byte) error) error {
+	format, err := parseCatalogFormat(format)
+	if err != nil {
+		return err
+	}
+
+	books, err := getExportBooks(db, saveImage)
+	if err != nil {
+		return err
+	}
+
+	if format == CatalogCSV {
+		return writeCatalogCSV(out, books, mapping)
+	}
+
+	return writeCatalogJSON(out, books, mapping)
+}
+
+// bookFromRecord reads the values of a row, by field, into a book to import.
+func bookFromRecord(values map[string]string) (BookInfo, error) {
+	value := func(field string) string {
+		return strings.TrimSpace(values[field])
+	}
+
+	book := BookInfo{
+		Title:         value("title"),
+		Author:        value("author"),
+		Description:   value("description"),
+		ISBN10:        value("isbn10"),
+		ISBN13:        value("isbn13"),
+		Publisher:     value("publisher"),
+		Translator:    value("translator"),
+		Format:        value("format"),
+		Language:      value("language"),
+		Series:        value("series"),
+		ReadingStatus: ReadingStatus(value("readingStatus")),
+		StartedOn:     value("startedOn"),
+		FinishedOn:    value("finishedOn"),
+		AddedOn:       value("addedOn"),
+		GoodreadsLink: value("goodreadsLink"),
+		PurchasedOn:   value("purchasedOn"),
+		Currency:      value("currency"),
+		Store:         value("store"),
+		GiftFrom:      value("giftFrom"),
+		Location:      value("location"),
+		ImageNames:    []string{},
+	}
+
+	publishedYear, err := parseOptionalPositiveInt("publishedYear", value("publishedYear"))
+	if err != nil {
+		return book, err
+	}
+	book.PublishedYear = int(publishedYear.Int64)
+
+	pageCount, err := parseOptionalPositiveInt("pageCount", value("pageCount"))
+	if err != nil {
+		return book, err
+	}
+	book.PageCount = int(pageCount.Int64)
+
+	position, err := parseSeriesPosition(value("seriesPosition"))
+	if err != nil {
+		return book, err
+	}
+	book.SeriesPosition = SeriesPosition(position.Float64)
+
+	price, err := parsePrice("purchasePrice", value("purchasePrice"))
+	if err != nil {
+		return book, err
+	}
+	book.PurchasePrice = Price(price.Float64)
+
+	if book.Tags, err = parseTagList(value("tags")); err != nil {
+		return book, err
+	}
+
+	for _, slug := range strings.Split(value("genres"), ",") {
+		if strings.TrimSpace(slug) == "" {
+			continue
+		}
+
+		var genre Genre
+		if err := genre.UnmarshalText([]byte(slug)); err != nil {
+			return book, err
+		}
+		book.Genres = append(book.Genres, genre)
+	}
+
+	for _, name := range strings.Split(value("imageNames"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			book.ImageNames = append(book.ImageNames, name)
+		}
+	}
+
+	return book, nil
+}
+
+func readCatalogCSV(in io.Reader, mapping ColumnMapping) ([]importRow, error) {
+	reader := csv.NewReader(in)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return []importRow{}, errors.New("the file is empty")
+	}
+	if err != nil {
+		return []importRow{}, err
+	}
+
+	// Spreadsheets often start the file with a byte order mark.
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+
+	fields := make([]string, len(header))
+	found := map[string]bool{}
+	for i, column := range header {
+		fields[i] = mapping.field(column)
+		found[fields[i]] = true
+	}
+	for _, required := range []string{"title", "author"} {
+		if !found[required] {
+			return []importRow{}, fmt.Errorf("missing the %s column", mapping.column(required))
+		}
+	}
+
+	rows := []importRow{}
+	rowNumber := 1
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return []importRow{}, err
+		}
+		rowNumber++
+
+		values := map[string]string{}
+		empty := true
+		for i, cell := range record {
+			if i < len(fields) && fields[i] != "" {
+				values[fields[i]] = cell
+			}
+			if strings.TrimSpace(cell) != "" {
+				empty = false
+			}
+		}
+		if empty {
+			continue
+		}
+
+		book, err := bookFromRecord(values)
+		rows = append(rows, importRow{Index: rowNumber, Book: book, Fields: found, Err: err})
+	}
+
+	return rows, nil
+}
+
+// jsonCatalogValue turns a value of a JSON object into the text of a CSV cell.
+func jsonCatalogValue(value interface{}) (string, error) {
+	switch value := value.(type) {
+	case nil, string, float64, bool:
+		return formatCatalogValue(value), nil
+	case []interface{}:
+		for _, item := range value {
+			switch item.(type) {
+			case string, float64:
+			default:
+				return "", errors.New("lists can only hold text and numbers")
+			}
+		}
+		return formatCatalogValue(value), nil
+	default:
+		return "", errors.New("unsupported value")
+	}
+}
+
+func readCatalogJSON(in io.Reader, mapping ColumnMapping) ([]importRow, error) {
+	var objects []map[string]interface{}
+	if err := json.NewDecoder(in).Decode(&objects); err != nil {
+		return []importRow{}, fmt.Errorf("the file must hold a list of books: %v", err)
+	}
+
+	rows := make([]importRow, 0, len(objects))
+	for i, object := range objects {
+		values := map[string]string{}
+		fields := map[string]bool{}
+		var rowErr error
+		for key, value := range object {
+			field := mapping.field(key)
+			if field == "" {
+				continue
+			}
+			fields[field] = true
+
+			text, err := jsonCatalogValue(value)
+			if err != nil {
+				rowErr = fmt.Errorf("%s: %v", key, err)
+				break
+			}
+			values[field] = text
+		}
+
+		book, err := bookFromRecord(values)
+		if rowErr != nil {
+			err = rowErr
+		}
+		rows = append(rows, importRow{Index: i + 1, Book: book, Fields: fields, Err: err})
+	}
+
+	return rows, nil
+}
+
+func readCatalog(in io.Reader, format string, mapping ColumnMapping) ([]importRow, error) {
+	format, err := parseCatalogFormat(format)
+	if err != nil {
+		return []importRow{}, err
+	}
+
+	if format == CatalogCSV {
+		return readCatalogCSV(in, mapping)
+	}
+
+	return readCatalogJSON(in, mapping)
+}
+
+// ImportCatalog imports a CSV or JSON catalog right away, as the app itself; it is what the command line uses.
+func ImportCatalog(db *sql.DB, in io.Reader, format string, mapping ColumnMapping, imagesDir string, dryRun bool) (ImportReport, error) {
+	rows, err := readCatalog(in, format, mapping)
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	return importLibrary(db, sql.NullString{}, rows, imagesDir, dryRun, func(int) {})
+}
+
+// CatalogExport returns the catalog as CSV or JSON, as in ?format=csv&mapping=title=Título,author=Autor.
+func CatalogExport(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can export the library", http.StatusForbidden)
+		return
+	}
+
+	format, err := parseCatalogFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mapping, err := ParseColumnMapping(r.URL.Query().Get("mapping"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var catalog bytes.Buffer
+	if err := ExportCatalog(db, &catalog, format, mapping, nil); err != nil {
+		log.Printf("error exporting the catalog: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if format == CatalogCSV {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="catalogo.%s"`, format))
+	_, _ = w.Write(catalog.Bytes())
+}
+
+// CatalogImport imports an uploaded CSV or JSON file in the background, like CreateDBFromFile. The images the rows
+// name must already be in the images directory.
+func CatalogImport(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can import the library", http.StatusForbidden)
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	input := r.FormValue("format")
+	if input == "" {
+		input = strings.TrimPrefix(filepath.Ext(header.Filename), ".")
+	}
+	format, err := parseCatalogFormat(input)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mapping, err := ParseColumnMapping(r.FormValue("mapping"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dryRun, err := parseDryRun(r)
+	if err != nil {
+		http.Error(w, "invalid dry_run", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := readCatalog(file, format, mapping)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job, err := runImportJob(db, auditActor(r), rows, dryRun)
+	writeImportJob(w, job, err)
+}
+
+type PageCatalogVariables struct {
+	Year     string
+	SiteKey  string
+	Fields   []string
+	LoggedIn bool
+}
+
+func CatalogPage(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		redirectToErrorPageWithMessageAndStatusCode(w, "Only admins can import and export the catalog", http.StatusForbidden)
+		return
+	}
+
+	now := time.Now()
+	pageVariables := PageCatalogVariables{
+		Year:     now.Format("2006"),
+		SiteKey:  captcha.SiteKey,
+		Fields:   catalogFields,
+		LoggedIn: true,
+	}
+
+	templateDir := os.Getenv("TEMPLATE_DIR")
+	if templateDir == "" {
+		templateDir = "internal/template" // default value for local development
+	}
+	templatePath := filepath.Join(templateDir, "admin_catalogo.html")
+
+	t, err := template.ParseFiles(templatePath)
+	if err != nil {
+		log.Printf("template error: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "template error", http.StatusInternalServerError)
+		return
+	}
+
+	err = t.Execute(w, pageVariables)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("template error: %v", err)
+		return
+	}
+}
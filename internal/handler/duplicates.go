@@ -0,0 +1,724 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"leonlib/internal/captcha"
+	"leonlib/internal/imagehash"
+	"leonlib/internal/names"
+)
+
+// duplicateImageDistance is the maximum number of different bits for two cover hashes to be the same picture.
+const duplicateImageDistance = 5
+
+type DuplicateReason string
+
+const (
+	SameISBN        DuplicateReason = "isbn"
+	SameTitleAuthor DuplicateReason = "title_author"
+	SimilarImage    DuplicateReason = "image"
+)
+
+type DuplicateBook struct {
+	ID            int    `json:"id"`
+	Title         string `json:"title"`
+	Author        string `json:"author"`
+	ISBN13        string `json:"isbn_13"`
+	Publisher     string `json:"publisher"`
+	PublishedYear int    `json:"published_year"`
+	Format        string `json:"format"`
+	Language      string `json:"language"`
+}
+
+type DuplicateMatch struct {
+	Book    DuplicateBook     `json:"book"`
+	Reasons []DuplicateReason `json:"reasons"`
+}
+
+type DuplicatePair struct {
+	Book    DuplicateBook     `json:"book"`
+	Other   DuplicateBook     `json:"other"`
+	Reasons []DuplicateReason `json:"reasons"`
+}
+
+type BookMergeReport struct {
+	SurvivorID  int   `json:"survivor_id"`
+	DuplicateID int   `json:"duplicate_id"`
+	Images      int64 `json:"images"`
+	Likes       int64 `json:"likes"`
+	Reviews     int64 `json:"reviews"`
+	UserBooks   int64 `json:"user_books"`
+}
+
+type PageDuplicatesVariables struct {
+	Year     string
+	SiteKey  string
+	Pairs    []DuplicatePair
+	LoggedIn bool
+}
+
+type bookMergeRequest struct {
+	SurvivorID  int `json:"survivor_id"`
+	DuplicateID int `json:"duplicate_id"`
+}
+
+type dismissDuplicateRequest struct {
+	BookID      int `json:"book_id"`
+	OtherBookID int `json:"other_book_id"`
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// sqlExecutor is implemented by both *sql.DB and *sql.Tx, for the helpers that also run inside a transaction.
+type sqlExecutor interface {
+	execer
+	queryRower
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx, for the read helpers that also run inside a transaction.
+type querier interface {
+	queryRower
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+type imageHash struct {
+	BookID int
+	Hash   uint64
+}
+
+func (dr DuplicateReason) Label() string {
+	switch dr {
+	case SameISBN:
+		return "Mismo ISBN"
+	case SameTitleAuthor:
+		return "Mismo título y autor"
+	case SimilarImage:
+		return "Portada parecida"
+	default:
+		return strings.ReplaceAll(string(dr), "_", " ")
+	}
+}
+
+func newDuplicateBook(book BookInfo) DuplicateBook {
+	return DuplicateBook{
+		ID:            book.ID,
+		Title:         book.Title,
+		Author:        book.Author,
+		ISBN13:        book.ISBN13,
+		Publisher:     book.Publisher,
+		PublishedYear: book.PublishedYear,
+		Format:        book.Format,
+		Language:      book.Language,
+	}
+}
+
+// computeImageHash returns a NULL hash for the formats imagehash cannot decode.
+func computeImageHash(image []byte) sql.NullInt64 {
+	hash, err := imagehash.Average(image)
+	if err != nil {
+		return sql.NullInt64{}
+	}
+
+	return sql.NullInt64{Int64: int64(hash), Valid: true}
+}
+
+// insertBookImage stores an image of a book together with its perceptual hash and, for the imported images, the name
+// of the file it was read from.
+func insertBookImage(q execer, bookID int, image []byte, fileName string) error {
+	hash := computeImageHash(image)
+	_, err := q.Exec(`INSERT INTO book_images(book_id, image, image_hash, image_hash_failed, file_name)
+		VALUES($1, $2, $3, $4, $5)`, bookID, image, hash, !hash.Valid, nullableString(fileName))
+
+	return err
+}
+
+func sameTitleAndAuthor(a, b BookInfo) bool {
+	return names.Fold(a.Title) == names.Fold(b.Title) && names.Key(a.Author) == names.Key(b.Author)
+}
+
+// differentEditions reports whether two books with the same title and author are known to be different editions,
+// so they are not reported as duplicates.
+func differentEditions(a, b BookInfo) bool {
+	differ := func(x, y string) bool {
+		return x != "" && y != "" && names.Fold(x) != names.Fold(y)
+	}
+
+	return differ(a.ISBN13, b.ISBN13) || differ(a.Format, b.Format) || differ(a.Language, b.Language) ||
+		differ(a.Publisher, b.Publisher) || (a.PublishedYear != 0 && b.PublishedYear != 0 && a.PublishedYear != b.PublishedYear)
+}
+
+// getBooksWithoutImages is getAllBooks without loading the images, for the comparisons of the duplicate checks.
+func getBooksWithoutImages(db *sql.DB) ([]BookInfo, error) {
+	rows, err := db.Query(`SELECT ` + bookColumns + ` FROM books b WHERE b.deleted_at IS NULL ORDER BY b.id`)
+	if err != nil {
+		return []BookInfo{}, err
+	}
+
+	defer rows.Close()
+
+	var books []BookInfo
+	for rows.Next() {
+		bookInfo, err := scanBookInfo(rows)
+		if err != nil {
+			return []BookInfo{}, err
+		}
+		books = append(books, bookInfo)
+	}
+
+	return books, rows.Err()
+}
+
+func getImageHashes(db *sql.DB) ([]imageHash, error) {
+	// The books in the trash are not duplicates: they can be added again.
+	rows, err := db.Query(`SELECT i.book_id, i.image_hash FROM book_images i
+		JOIN books b ON b.id = i.book_id AND b.deleted_at IS NULL
+		WHERE i.image_hash IS NOT NULL AND i.deleted_at IS NULL
+		ORDER BY i.book_id`)
+	if err != nil {
+		return []imageHash{}, err
+	}
+
+	defer rows.Close()
+
+	var hashes []imageHash
+	for rows.Next() {
+		var hash imageHash
+		var value int64
+		if err := rows.Scan(&hash.BookID, &value); err != nil {
+			return []imageHash{}, err
+		}
+		hash.Hash = uint64(value)
+		hashes = append(hashes, hash)
+	}
+
+	return hashes, rows.Err()
+}
+
+// backfillImageHashes hashes the images stored before image_hash existed. The images that cannot be decoded are
+// marked, so they are only read once.
+func backfillImageHashes(db *sql.DB) (int, error) {
+	rows, err := db.Query("SELECT image_id, image FROM book_images WHERE image_hash IS NULL AND NOT image_hash_failed")
+	if err != nil {
+		return 0, err
+	}
+
+	hashes := map[int]sql.NullInt64{}
+	for rows.Next() {
+		var imageID int
+		var image []byte
+		if err := rows.Scan(&imageID, &image); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		hashes[imageID] = computeImageHash(image)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for imageID, hash := range hashes {
+		_, err := db.Exec("UPDATE book_images SET image_hash = $1, image_hash_failed = $2 WHERE image_id = $3",
+			hash, !hash.Valid, imageID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(hashes), nil
+}
+
+// StartImageHashBackfill hashes the images stored before image_hash existed in the background, so the duplicates
+// report can compare their covers.
+func StartImageHashBackfill(db *sql.DB) {
+	go func() {
+		count, err := backfillImageHashes(db)
+		if err != nil {
+			log.Printf("error hashing the stored images: %v", err)
+			return
+		}
+		if count > 0 {
+			log.Printf("hashed %d stored images", count)
+		}
+	}()
+}
+
+// duplicateReason compares the catalog fields of two books; the covers are compared apart.
+func duplicateReason(book, candidate BookInfo) (DuplicateReason, bool) {
+	switch {
+	case candidate.ISBN13 != "" && book.ISBN13 == candidate.ISBN13:
+		return SameISBN, true
+	case sameTitleAndAuthor(book, candidate) && !differentEditions(book, candidate):
+		return SameTitleAuthor, true
+	default:
+		return "", false
+	}
+}
+
+// findDuplicateIn returns the first book of the list that is a duplicate of the candidate.
+func findDuplicateIn(books []BookInfo, candidate BookInfo) (BookInfo, bool) {
+	for _, book := range books {
+		if _, ok := duplicateReason(book, candidate); ok {
+			return book, true
+		}
+	}
+
+	return BookInfo{}, false
+}
+
+// findDuplicates returns the books that look like the candidate: same ISBN, same title and author (unless the
+// edition details tell them apart) or a cover that looks the same.
+func findDuplicates(db *sql.DB, candidate BookInfo, image []byte) ([]DuplicateMatch, error) {
+	books, err := getBooksWithoutImages(db)
+	if err != nil {
+		return []DuplicateMatch{}, err
+	}
+
+	reasons := map[int][]DuplicateReason{}
+	byID := map[int]BookInfo{}
+	for _, book := range books {
+		if book.ID == candidate.ID {
+			continue
+		}
+		byID[book.ID] = book
+
+		if reason, ok := duplicateReason(book, candidate); ok {
+			reasons[book.ID] = append(reasons[book.ID], reason)
+		}
+	}
+
+	if hash := computeImageHash(image); hash.Valid {
+		hashes, err := getImageHashes(db)
+		if err != nil {
+			return []DuplicateMatch{}, err
+		}
+
+		for _, stored := range hashes {
+			if stored.BookID == candidate.ID || imagehash.Distance(uint64(hash.Int64), stored.Hash) > duplicateImageDistance {
+				continue
+			}
+
+			if last := reasons[stored.BookID]; len(last) == 0 || last[len(last)-1] != SimilarImage {
+				reasons[stored.BookID] = append(reasons[stored.BookID], SimilarImage)
+			}
+		}
+	}
+
+	matches := []DuplicateMatch{}
+	for bookID, bookReasons := range reasons {
+		matches = append(matches, DuplicateMatch{Book: newDuplicateBook(byID[bookID]), Reasons: bookReasons})
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Book.ID < matches[j].Book.ID
+	})
+
+	return matches, nil
+}
+
+func sameISBNOnly(matches []DuplicateMatch) []DuplicateMatch {
+	var sameISBN []DuplicateMatch
+	for _, match := range matches {
+		for _, reason := range match.Reasons {
+			if reason == SameISBN {
+				sameISBN = append(sameISBN, match)
+				break
+			}
+		}
+	}
+
+	return sameISBN
+}
+
+func getDismissedDuplicates(db *sql.DB) (map[[2]int]bool, error) {
+	rows, err := db.Query("SELECT book_id, other_book_id FROM book_duplicate_dismissals")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	dismissed := map[[2]int]bool{}
+	for rows.Next() {
+		var pair [2]int
+		if err := rows.Scan(&pair[0], &pair[1]); err != nil {
+			return nil, err
+		}
+		dismissed[pair] = true
+	}
+
+	return dismissed, rows.Err()
+}
+
+// getDuplicatePairs compares every book of the catalog; the pairs an admin dismissed are left out.
+func getDuplicatePairs(db *sql.DB) ([]DuplicatePair, error) {
+	books, err := getBooksWithoutImages(db)
+	if err != nil {
+		return []DuplicatePair{}, err
+	}
+
+	hashes, err := getImageHashes(db)
+	if err != nil {
+		return []DuplicatePair{}, err
+	}
+
+	dismissed, err := getDismissedDuplicates(db)
+	if err != nil {
+		return []DuplicatePair{}, err
+	}
+
+	byID := map[int]BookInfo{}
+	byTitleAuthor := map[string][]BookInfo{}
+	for _, book := range books {
+		byID[book.ID] = book
+		key := names.Fold(book.Title) + "|" + names.Key(book.Author)
+		byTitleAuthor[key] = append(byTitleAuthor[key], book)
+	}
+
+	reasons := map[[2]int][]DuplicateReason{}
+	for _, group := range byTitleAuthor {
+		for i := range group {
+			for j := i + 1; j < len(group); j++ {
+				if !differentEditions(group[i], group[j]) {
+					pair := [2]int{min(group[i].ID, group[j].ID), max(group[i].ID, group[j].ID)}
+					reasons[pair] = append(reasons[pair], SameTitleAuthor)
+				}
+			}
+		}
+	}
+
+	for i := range hashes {
+		for j := i + 1; j < len(hashes); j++ {
+			if hashes[i].BookID == hashes[j].BookID || imagehash.Distance(hashes[i].Hash, hashes[j].Hash) > duplicateImageDistance {
+				continue
+			}
+
+			pair := [2]int{min(hashes[i].BookID, hashes[j].BookID), max(hashes[i].BookID, hashes[j].BookID)}
+			if last := reasons[pair]; len(last) == 0 || last[len(last)-1] != SimilarImage {
+				reasons[pair] = append(reasons[pair], SimilarImage)
+			}
+		}
+	}
+
+	pairs := []DuplicatePair{}
+	for pair, pairReasons := range reasons {
+		if dismissed[pair] {
+			continue
+		}
+
+		pairs = append(pairs, DuplicatePair{
+			Book:    newDuplicateBook(byID[pair[0]]),
+			Other:   newDuplicateBook(byID[pair[1]]),
+			Reasons: pairReasons,
+		})
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].Book.ID != pairs[j].Book.ID {
+			return pairs[i].Book.ID < pairs[j].Book.ID
+		}
+		return pairs[i].Other.ID < pairs[j].Other.ID
+	})
+
+	return pairs, nil
+}
+
+func writeDuplicatesFound(w http.ResponseWriter, matches []DuplicateMatch) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":    "Parece que el libro ya está en la biblioteca",
+		"duplicates": matches,
+	})
+}
+
+// moveBookRows moves the rows of table from the duplicate to the survivor, except for the users that already have
+// a row for the survivor; those rows are deleted and the survivor keeps its own.
+func moveBookRows(tx *sql.Tx, table string, survivorID, duplicateID int) (int64, error) {
+	result, err := tx.Exec(fmt.Sprintf(`UPDATE %[1]s d SET book_id = $1
+		WHERE d.book_id = $2
+		  AND NOT EXISTS (SELECT 1 FROM %[1]s s WHERE s.book_id = $1 AND s.user_id = d.user_id)`, table), survivorID, duplicateID)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE book_id = $1", table), duplicateID); err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// mergeBooks moves the images, likes, reviews, reading progress and tags of the duplicate onto the survivor, fills the
+// empty fields of the survivor with the duplicate ones and deletes the duplicate, all in one transaction that also
+// records the merge for actor in the history of both books.
+func mergeBooks(db *sql.DB, actor sql.NullString, survivorID, duplicateID int) (BookMergeReport, error) {
+	if survivorID == duplicateID {
+		return BookMergeReport{}, fmt.Errorf("%w: a book cannot be merged with itself", errInvalidMerge)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return BookMergeReport{}, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	report := BookMergeReport{SurvivorID: survivorID, DuplicateID: duplicateID}
+
+	var locked int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM (SELECT id FROM books WHERE id IN ($1, $2) AND deleted_at IS NULL FOR UPDATE) b", survivorID, duplicateID).Scan(&locked); err != nil {
+		return BookMergeReport{}, err
+	}
+	if locked != 2 {
+		return BookMergeReport{}, fmt.Errorf("both books must exist and be out of the trash: %w", sql.ErrNoRows)
+	}
+
+	survivorBefore, err := getBookDetails(tx, survivorID)
+	if err != nil {
+		return BookMergeReport{}, err
+	}
+
+	duplicateBefore, err := getBookDetails(tx, duplicateID)
+	if err != nil {
+		return BookMergeReport{}, err
+	}
+
+	result, err := tx.Exec("UPDATE book_images SET book_id = $1 WHERE book_id = $2", survivorID, duplicateID)
+	if err != nil {
+		return BookMergeReport{}, err
+	}
+	report.Images, _ = result.RowsAffected()
+
+	if report.Likes, err = moveBookRows(tx, "book_likes", survivorID, duplicateID); err != nil {
+		return BookMergeReport{}, err
+	}
+
+	if report.Reviews, err = moveBookRows(tx, "book_reviews", survivorID, duplicateID); err != nil {
+		return BookMergeReport{}, err
+	}
+
+	if report.UserBooks, err = moveBookRows(tx, "user_books", survivorID, duplicateID); err != nil {
+		return BookMergeReport{}, err
+	}
+
+	// Loans that would clash with an active loan or a pending request of the survivor go away with the duplicate.
+	_, err = tx.Exec(`UPDATE loans d SET book_id = $1
+		WHERE d.book_id = $2
+		  AND NOT EXISTS (SELECT 1 FROM loans s
+			WHERE s.book_id = $1 AND s.status = d.status
+			  AND (d.status = 'active' OR (d.status = 'requested' AND s.borrower_user_id = d.borrower_user_id)))`, survivorID, duplicateID)
+	if err != nil {
+		return BookMergeReport{}, err
+	}
+
+	_, err = tx.Exec("UPDATE wishlist_items SET acquired_book_id = $1 WHERE acquired_book_id = $2", survivorID, duplicateID)
+	if err != nil {
+		return BookMergeReport{}, err
+	}
+
+	_, err = tx.Exec(`INSERT INTO book_tags(book_id, tag_id) SELECT $1, tag_id FROM book_tags WHERE book_id = $2
+		ON CONFLICT DO NOTHING`, survivorID, duplicateID)
+	if err != nil {
+		return BookMergeReport{}, err
+	}
+
+	_, err = tx.Exec(`INSERT INTO book_genres(book_id, genre_id) SELECT $1, genre_id FROM book_genres WHERE book_id = $2
+		ON CONFLICT DO NOTHING`, survivorID, duplicateID)
+	if err != nil {
+		return BookMergeReport{}, err
+	}
+
+	// The ISBN is unique, so it is taken away from the duplicate before the survivor can get it.
+	var isbn10, isbn13 sql.NullString
+	var workID int
+	var seriesID sql.NullInt64
+	err = tx.QueryRow(`UPDATE books d SET isbn_10 = NULL, isbn_13 = NULL
+		FROM books o WHERE d.id = o.id AND d.id = $1
+		RETURNING o.isbn_10, o.isbn_13, d.work_id, d.series_id`, duplicateID).Scan(&isbn10, &isbn13, &workID, &seriesID)
+	if err != nil {
+		return BookMergeReport{}, err
+	}
+
+	_, err = tx.Exec(`UPDATE books s SET
+			description = COALESCE(NULLIF(s.description, ''), d.description),
+			isbn_10 = COALESCE(s.isbn_10, $3),
+			isbn_13 = COALESCE(s.isbn_13, $4),
+			publisher = COALESCE(s.publisher, d.publisher),
+			published_year = COALESCE(s.published_year, d.published_year),
+			page_count = COALESCE(s.page_count, d.page_count),
+			translator = COALESCE(s.translator, d.translator),
+			format = COALESCE(s.format, d.format),
+			language = COALESCE(s.language, d.language),
+			location_id = COALESCE(s.location_id, d.location_id),
+			series_id = COALESCE(s.series_id, d.series_id),
+			series_position = CASE WHEN s.series_id IS NULL THEN d.series_position ELSE s.series_position END,
+			purchased_on = COALESCE(s.purchased_on, d.purchased_on),
+			purchase_price = COALESCE(s.purchase_price, d.purchase_price),
+			currency = CASE WHEN s.purchase_price IS NULL THEN COALESCE(d.currency, s.currency) ELSE s.currency END,
+			store = COALESCE(s.store, d.store),
+			gift_from = COALESCE(s.gift_from, d.gift_from),
+			goodreads_link = COALESCE(NULLIF(s.goodreads_link, ''), d.goodreads_link),
+			added_on = LEAST(s.added_on, d.added_on)
+		FROM books d
+		WHERE s.id = $1 AND d.id = $2`, survivorID, duplicateID, isbn10, isbn13)
+	if err != nil {
+		return BookMergeReport{}, err
+	}
+
+	if _, err := tx.Exec("DELETE FROM books WHERE id = $1", duplicateID); err != nil {
+		return BookMergeReport{}, err
+	}
+
+	if _, err := tx.Exec("DELETE FROM works w WHERE w.id = $1 AND NOT EXISTS (SELECT 1 FROM books b WHERE b.work_id = w.id)", workID); err != nil {
+		return BookMergeReport{}, err
+	}
+
+	// Only the series of the duplicate can be left without books.
+	if seriesID.Valid {
+		if _, err := tx.Exec("DELETE FROM series s WHERE s.id = $1 AND NOT EXISTS (SELECT 1 FROM books b WHERE b.series_id = s.id)", seriesID); err != nil {
+			return BookMergeReport{}, err
+		}
+	}
+
+	if err := recordBookEditIn(tx, actor, AuditMerge, survivorBefore, 0); err != nil {
+		return BookMergeReport{}, err
+	}
+	recordAuditAs(tx, actor, AuditMerge, AuditBook, duplicateID, auditBookFromInfo(duplicateBefore),
+		map[string]interface{}{"merged_into": survivorID})
+
+	return report, tx.Commit()
+}
+
+func BookDuplicates(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can see the duplicates report", http.StatusForbidden)
+		return
+	}
+
+	pairs, err := getDuplicatePairs(db)
+	if err != nil {
+		writeErrorGeneralStatus(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(pairs)
+}
+
+func MergeBooks(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can merge books", http.StatusForbidden)
+		return
+	}
+
+	var req bookMergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Error al decodificar el cuerpo de la solicitud", http.StatusBadRequest)
+		return
+	}
+
+	report, err := mergeBooks(db, auditActor(r), req.SurvivorID, req.DuplicateID)
+	if errors.Is(err, errInvalidMerge) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Book not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("error merging books: %v", err)
+		writeErrorGeneralStatus(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+func DismissDuplicate(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can dismiss duplicates", http.StatusForbidden)
+		return
+	}
+
+	var req dismissDuplicateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Error al decodificar el cuerpo de la solicitud", http.StatusBadRequest)
+		return
+	}
+
+	if req.BookID == req.OtherBookID {
+		http.Error(w, "book_id and other_book_id must be different", http.StatusBadRequest)
+		return
+	}
+
+	_, err := db.Exec(`INSERT INTO book_duplicate_dismissals(book_id, other_book_id) VALUES($1, $2)
+		ON CONFLICT DO NOTHING`, min(req.BookID, req.OtherBookID), max(req.BookID, req.OtherBookID))
+	if err != nil {
+		writeErrorGeneralStatus(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "OK"})
+}
+
+func DuplicatesPage(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		redirectToErrorPageWithMessageAndStatusCode(w, "Only admins can see the duplicates report", http.StatusForbidden)
+		return
+	}
+
+	pairs, err := getDuplicatePairs(db)
+	if err != nil {
+		log.Printf("error getting duplicates: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	pageVariables := PageDuplicatesVariables{
+		Year:     now.Format("2006"),
+		SiteKey:  captcha.SiteKey,
+		Pairs:    pairs,
+		LoggedIn: true,
+	}
+
+	templateDir := os.Getenv("TEMPLATE_DIR")
+	if templateDir == "" {
+		templateDir = "internal/template" // default value for local development
+	}
+	templatePath := filepath.Join(templateDir, "admin_duplicados.html")
+
+	t, err := template.ParseFiles(templatePath)
+	if err != nil {
+		log.Printf("template error: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "template error", http.StatusInternalServerError)
+		return
+	}
+
+	err = t.Execute(w, pageVariables)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("template error: %v", err)
+		return
+	}
+}
@@ -0,0 +1,572 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"leonlib/internal/captcha"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const goodreadsBookURL = "https://www.goodreads.com/book/show/"
+
+type GoodreadsMatchReason string
+
+const (
+	MatchGoodreads   GoodreadsMatchReason = "goodreads"
+	MatchISBN        GoodreadsMatchReason = "isbn"
+	MatchTitleAuthor GoodreadsMatchReason = "title_author"
+)
+
+func (gmr GoodreadsMatchReason) Label() string {
+	switch gmr {
+	case MatchGoodreads:
+		return "Enlace de Goodreads"
+	case MatchISBN:
+		return "ISBN"
+	case MatchTitleAuthor:
+		return "Título y autor"
+	default:
+		return string(gmr)
+	}
+}
+
+var (
+	goodreadsLinkPattern = regexp.MustCompile(`/book/show/(\d+)`)
+	// Goodreads adds the series to the title, as in "Patria I (Patria, #1)".
+	goodreadsSeriesPattern = regexp.MustCompile(`\s*\([^()]*#[^()]*\)\s*$`)
+)
+
+// GoodreadsMatch is the book of the catalog a row of the export stands for.
+type GoodreadsMatch struct {
+	BookID int                  `json:"book_id"`
+	Title  string               `json:"title"`
+	Author string               `json:"author"`
+	Reason GoodreadsMatchReason `json:"reason"`
+	Label  string               `json:"label"`
+}
+
+// GoodreadsRow is a book of the Goodreads library export; Row is its row in the file, the header being row 1.
+type GoodreadsRow struct {
+	Row         int             `json:"row"`
+	GoodreadsID string          `json:"goodreads_id"`
+	Title       string          `json:"title"`
+	Author      string          `json:"author"`
+	ISBN13      string          `json:"isbn13,omitempty"`
+	Shelf       string          `json:"shelf"`
+	Status      ReadingStatus   `json:"status"`
+	StatusLabel string          `json:"status_label"`
+	Rating      int             `json:"rating,omitempty"`
+	DateRead    string          `json:"date_read,omitempty"`
+	ReadCount   int             `json:"read_count"`
+	Review      string          `json:"-"`
+	Match       *GoodreadsMatch `json:"match"`
+	Error       string          `json:"error,omitempty"`
+}
+
+func (gr GoodreadsRow) link() string {
+	return goodreadsBookURL + gr.GoodreadsID
+}
+
+// goodreadsStatus maps the exclusive shelf of a book to its reading status. Custom exclusive shelves are taken as
+// abandoned when their name says so, and as to read otherwise.
+func goodreadsStatus(shelf string) ReadingStatus {
+	shelf = strings.ToLower(strings.TrimSpace(shelf))
+	switch shelf {
+	case "read":
+		return Read
+	case "currently-reading":
+		return Reading
+	case "to-read", "":
+		return ToRead
+	}
+
+	for _, abandoned := range []string{"abandon", "dnf", "did-not-finish", "not-finished", "no-terminado"} {
+		if strings.Contains(shelf, abandoned) {
+			return Abandoned
+		}
+	}
+
+	return ToRead
+}
+
+// goodreadsISBN removes the ="..." Goodreads writes around the ISBNs so spreadsheets keep their leading zeros.
+func goodreadsISBN(value string) string {
+	value = strings.TrimSpace(value)
+	value = strings.TrimPrefix(value, "=")
+
+	return strings.Trim(value, `"`)
+}
+
+func goodreadsDate(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+
+	date, err := time.Parse("2006/01/02", value)
+	if err != nil {
+		return "", fmt.Errorf("invalid date: %q", value)
+	}
+
+	return date.Format("2006-01-02"), nil
+}
+
+// goodreadsReview turns the HTML line breaks of a Goodreads review into the new lines of a markdown review.
+func goodreadsReview(value string) string {
+	for _, lineBreak := range []string{"<br/>", "<br />", "<br>"} {
+		value = strings.ReplaceAll(value, lineBreak, "\n")
+	}
+
+	return strings.TrimSpace(value)
+}
+
+func parseGoodreadsRow(row int, value func(column string) string) GoodreadsRow {
+	goodreadsRow := GoodreadsRow{
+		Row:         row,
+		GoodreadsID: strings.TrimSpace(value("Book Id")),
+		Title:       strings.TrimSpace(value("Title")),
+		Author:      strings.TrimSpace(value("Author")),
+		Shelf:       strings.TrimSpace(value("Exclusive Shelf")),
+		Review:      goodreadsReview(value("My Review")),
+	}
+	goodreadsRow.Status = goodreadsStatus(goodreadsRow.Shelf)
+	goodreadsRow.StatusLabel = goodreadsRow.Status.Label()
+
+	fail := func(err error) GoodreadsRow {
+		goodreadsRow.Error = err.Error()
+		return goodreadsRow
+	}
+
+	if _, err := strconv.Atoi(goodreadsRow.GoodreadsID); err != nil {
+		return fail(fmt.Errorf("invalid Book Id: %q", goodreadsRow.GoodreadsID))
+	}
+
+	if goodreadsRow.Title == "" || goodreadsRow.Author == "" {
+		return fail(errors.New("title and author are required"))
+	}
+
+	// A wrong ISBN only means the book is matched by its title.
+	if bookISBN, err := resolveBookISBN(goodreadsISBN(value("ISBN13")), goodreadsISBN(value("ISBN"))); err == nil {
+		goodreadsRow.ISBN13 = bookISBN.ISBN13.String
+	}
+
+	if rating := strings.TrimSpace(value("My Rating")); rating != "" {
+		var err error
+		if goodreadsRow.Rating, err = strconv.Atoi(rating); err != nil || goodreadsRow.Rating < 0 || goodreadsRow.Rating > 5 {
+			return fail(fmt.Errorf("invalid rating: %q", rating))
+		}
+	}
+
+	var err error
+	if goodreadsRow.DateRead, err = goodreadsDate(value("Date Read")); err != nil {
+		return fail(err)
+	}
+
+	if readCount := strings.TrimSpace(value("Read Count")); readCount != "" {
+		if goodreadsRow.ReadCount, err = strconv.Atoi(readCount); err != nil || goodreadsRow.ReadCount < 0 {
+			return fail(fmt.Errorf("invalid read count: %q", readCount))
+		}
+	}
+
+	return goodreadsRow
+}
+
+// readGoodreadsCSV reads the library export of Goodreads (My Books > Import and export).
+func readGoodreadsCSV(in io.Reader) ([]GoodreadsRow, error) {
+	reader := csv.NewReader(in)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return []GoodreadsRow{}, errors.New("the file is empty")
+	}
+	if err != nil {
+		return []GoodreadsRow{}, err
+	}
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+
+	columns := map[string]int{}
+	for i, column := range header {
+		columns[strings.TrimSpace(column)] = i
+	}
+	for _, required := range []string{"Book Id", "Title", "Author", "Exclusive Shelf"} {
+		if _, ok := columns[required]; !ok {
+			return []GoodreadsRow{}, fmt.Errorf("this is not a Goodreads export: the %s column is missing", required)
+		}
+	}
+
+	rows := []GoodreadsRow{}
+	rowNumber := 1
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return []GoodreadsRow{}, err
+		}
+		rowNumber++
+
+		rows = append(rows, parseGoodreadsRow(rowNumber, func(column string) string {
+			if i := columns[column]; i < len(record) {
+				return record[i]
+			}
+			return ""
+		}))
+	}
+
+	return rows, nil
+}
+
+func goodreadsIDFromLink(link string) string {
+	match := goodreadsLinkPattern.FindStringSubmatch(link)
+	if match == nil {
+		return ""
+	}
+
+	return match[1]
+}
+
+// findGoodreadsMatch looks for the book first by the Goodreads link it already has, then by ISBN and last by title
+// and author, ignoring the series Goodreads adds to the title. The books in claimed were taken by earlier rows.
+func findGoodreadsMatch(books []BookInfo, row GoodreadsRow, claimed map[int]bool) *GoodreadsMatch {
+	match := func(book BookInfo, reason GoodreadsMatchReason) *GoodreadsMatch {
+		return &GoodreadsMatch{BookID: book.ID, Title: book.Title, Author: book.Author, Reason: reason, Label: reason.Label()}
+	}
+
+	var unclaimed []BookInfo
+	for _, book := range books {
+		if !claimed[book.ID] {
+			unclaimed = append(unclaimed, book)
+		}
+	}
+	books = unclaimed
+
+	for _, book := range books {
+		if goodreadsIDFromLink(book.GoodreadsLink) == row.GoodreadsID {
+			return match(book, MatchGoodreads)
+		}
+	}
+
+	if row.ISBN13 != "" {
+		for _, book := range books {
+			if book.ISBN13 == row.ISBN13 {
+				return match(book, MatchISBN)
+			}
+		}
+	}
+
+	candidate := BookInfo{
+		Title:  goodreadsSeriesPattern.ReplaceAllString(row.Title, ""),
+		Author: row.Author,
+		ISBN13: row.ISBN13,
+	}
+	for _, book := range books {
+		if sameTitleAndAuthor(book, candidate) && !differentEditions(book, candidate) {
+			return match(book, MatchTitleAuthor)
+		}
+	}
+
+	return nil
+}
+
+// previewGoodreadsImport reads the export and finds the book of the catalog each row stands for.
+func previewGoodreadsImport(db *sql.DB, in io.Reader) ([]GoodreadsRow, error) {
+	rows, err := readGoodreadsCSV(in)
+	if err != nil {
+		return []GoodreadsRow{}, err
+	}
+
+	books, err := getBooksWithoutImages(db)
+	if err != nil {
+		return []GoodreadsRow{}, err
+	}
+
+	// Each book of the catalog stands for one row at most.
+	claimed := map[int]bool{}
+	for i := range rows {
+		if rows[i].Error == "" {
+			rows[i].Match = findGoodreadsMatch(books, rows[i], claimed)
+		}
+		if rows[i].Match != nil {
+			claimed[rows[i].Match.BookID] = true
+		}
+	}
+
+	return rows, nil
+}
+
+// applyGoodreadsRow saves the reading history and the rating of the user for the matched book. For admins it also
+// links the book to Goodreads and saves the Goodreads ISBN when the book has none yet.
+func applyGoodreadsRow(tx *sql.Tx, r *http.Request, userID string, row GoodreadsRow, admin bool) error {
+	finishedOn, err := parseOptionalDate(row.DateRead)
+	if err != nil {
+		return err
+	}
+
+	var progress sql.NullFloat64
+	if row.Status == Read {
+		progress = sql.NullFloat64{Float64: 100, Valid: true}
+	}
+
+	rereadCount := 0
+	if row.ReadCount > 1 {
+		rereadCount = row.ReadCount - 1
+	}
+
+	// The history only fills in: a finish date or a reread count already recorded here is kept, and so is a status
+	// further along than the one of the export.
+	_, err = tx.Exec(`INSERT INTO user_books AS ub (user_id, book_id, status, progress_percent, finished_on, reread_count, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		ON CONFLICT (user_id, book_id) DO UPDATE SET
+			status = CASE
+				WHEN array_position(`+readingProgressOrder+`, EXCLUDED.status) > array_position(`+readingProgressOrder+`, ub.status)
+				THEN EXCLUDED.status ELSE ub.status END,
+			progress_percent = COALESCE(EXCLUDED.progress_percent, ub.progress_percent),
+			finished_on = COALESCE(EXCLUDED.finished_on, ub.finished_on),
+			reread_count = GREATEST(EXCLUDED.reread_count, ub.reread_count),
+			updated_at = EXCLUDED.updated_at`,
+		userID, row.Match.BookID, row.Status, progress, finishedOn, rereadCount)
+	if err != nil {
+		return err
+	}
+
+	if row.Rating > 0 {
+		review := reviewRequest{Rating: float64(row.Rating), Body: row.Review}
+		if err := validateReview(review); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`INSERT INTO book_reviews(book_id, user_id, rating, body)
+			VALUES($1, $2, $3, $4)
+			ON CONFLICT(book_id, user_id) DO UPDATE
+			SET rating = EXCLUDED.rating,
+				body = CASE WHEN EXCLUDED.body = '' THEN book_reviews.body ELSE EXCLUDED.body END,
+				updated_at = NOW()`, row.Match.BookID, userID, review.Rating, review.Body)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The catalog is only written by admins.
+	if !admin {
+		return nil
+	}
+
+	return updateGoodreadsBook(tx, auditActor(r), row)
+}
+
+// updateGoodreadsBook links the matched book to Goodreads and saves the ISBN of the row when the book has none and no
+// other book of the catalog already uses it. The change is saved as a revision of the book.
+func updateGoodreadsBook(tx *sql.Tx, actor sql.NullString, row GoodreadsRow) error {
+	before, err := getBookDetails(tx, row.Match.BookID)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	if before.GoodreadsLink == "" {
+		if _, err := tx.Exec("UPDATE books SET goodreads_link = $1 WHERE id = $2", row.link(), before.ID); err != nil {
+			return err
+		}
+		changed = true
+	}
+
+	if isbns, err := parseBookISBN(row.ISBN13); err == nil && isbns.ISBN13.Valid && before.ISBN13 == "" {
+		result, err := tx.Exec(`UPDATE books SET isbn_10 = $1, isbn_13 = $2
+			WHERE id = $3 AND NOT EXISTS (SELECT 1 FROM books other WHERE other.isbn_13 = $2)`,
+			isbns.ISBN10, isbns.ISBN13, before.ID)
+		if err != nil {
+			return err
+		}
+		if saved, _ := result.RowsAffected(); saved > 0 {
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+
+	return recordBookEditIn(tx, actor, AuditImport, before, 0)
+}
+
+// importGoodreads applies the matched rows in a single transaction, each one in its own savepoint; the rows in skip
+// are left out.
+func importGoodreads(db *sql.DB, r *http.Request, userID string, rows []GoodreadsRow, skip map[int]bool) (ImportReport, error) {
+	report := newImportReport(false)
+	admin := isAdmin(db, r)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return ImportReport{}, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	for _, row := range rows {
+		entry := ImportEntry{Index: row.Row, Title: row.Title, Author: row.Author}
+		switch {
+		case row.Error != "":
+			entry.Outcome, entry.Reason = ImportFailed, row.Error
+		case row.Match == nil:
+			entry.Outcome, entry.Reason = ImportSkipped, "not in the catalog"
+		case skip[row.Row]:
+			entry.Outcome, entry.Reason, entry.BookID = ImportSkipped, "left out", row.Match.BookID
+		default:
+			entry.BookID = row.Match.BookID
+			entry.Outcome = ImportUpdated
+
+			if _, err := tx.Exec("SAVEPOINT goodreads_row"); err != nil {
+				return ImportReport{}, err
+			}
+
+			if err := applyGoodreadsRow(tx, r, userID, row, admin); err != nil {
+				if _, rollbackErr := tx.Exec("ROLLBACK TO SAVEPOINT goodreads_row"); rollbackErr != nil {
+					return ImportReport{}, rollbackErr
+				}
+				entry.Outcome, entry.Reason = ImportFailed, err.Error()
+			} else if _, err := tx.Exec("RELEASE SAVEPOINT goodreads_row"); err != nil {
+				return ImportReport{}, err
+			}
+		}
+
+		report.add(entry)
+	}
+
+	return report, tx.Commit()
+}
+
+func parseSkippedRows(input string) (map[int]bool, error) {
+	skip := map[int]bool{}
+	for _, value := range strings.Split(input, ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+
+		row, err := strconv.Atoi(value)
+		if err != nil {
+			return map[int]bool{}, fmt.Errorf("invalid row: %q", value)
+		}
+		skip[row] = true
+	}
+
+	return skip, nil
+}
+
+// GoodreadsPreview shows which book of the catalog each row of the uploaded export stands for, without saving
+// anything.
+func GoodreadsPreview(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if _, err := getCurrentUserID(r); err != nil {
+		writeUnauthenticated(w)
+		return
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	rows, err := previewGoodreadsImport(db, file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(rows)
+}
+
+// GoodreadsImport saves the history of the uploaded export for the current user; skip lists the rows of the preview
+// that were unchecked.
+func GoodreadsImport(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	userID, err := getCurrentUserID(r)
+	if err != nil {
+		writeUnauthenticated(w)
+		return
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	skip, err := parseSkippedRows(r.FormValue("skip"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := previewGoodreadsImport(db, file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := importGoodreads(db, r, userID, rows, skip)
+	if err != nil {
+		log.Printf("error importing from Goodreads: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(report)
+}
+
+type PageGoodreadsVariables struct {
+	Year     string
+	SiteKey  string
+	LoggedIn bool
+}
+
+func GoodreadsPage(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if _, err := getCurrentUserID(r); err != nil {
+		redirectToErrorPageWithMessageAndStatusCode(w, "You need to log in to import from Goodreads", http.StatusUnauthorized)
+		return
+	}
+
+	now := time.Now()
+	pageVariables := PageGoodreadsVariables{
+		Year:     now.Format("2006"),
+		SiteKey:  captcha.SiteKey,
+		LoggedIn: true,
+	}
+
+	templateDir := os.Getenv("TEMPLATE_DIR")
+	if templateDir == "" {
+		templateDir = "internal/template" // default value for local development
+	}
+	templatePath := filepath.Join(templateDir, "goodreads.html")
+
+	t, err := template.ParseFiles(templatePath)
+	if err != nil {
+		log.Printf("template error: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "template error", http.StatusInternalServerError)
+		return
+	}
+
+	err = t.Execute(w, pageVariables)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("template error: %v", err)
+		return
+	}
+}
@@ -0,0 +1,40 @@
+package handler
+
+import "testing"
+
+func TestFindGoodreadsMatch(t *testing.T) {
+	books := []BookInfo{
+		{ID: 1, Title: "Pedro Páramo", Author: "Juan Rulfo"},
+		{ID: 2, Title: "Aura", Author: "Carlos Fuentes", ISBN13: "9789684110010"},
+		{ID: 3, Title: "Rayuela", Author: "Julio Cortázar", GoodreadsLink: "https://www.goodreads.com/book/show/53413"},
+	}
+
+	tests := []struct {
+		row    GoodreadsRow
+		want   int
+		reason GoodreadsMatchReason
+	}{
+		{GoodreadsRow{GoodreadsID: "53413", Title: "Hopscotch", Author: "Julio Cortázar"}, 3, MatchGoodreads},
+		{GoodreadsRow{GoodreadsID: "1", Title: "Aura", Author: "Carlos Fuentes", ISBN13: "9789684110010"}, 2, MatchISBN},
+		{GoodreadsRow{GoodreadsID: "2", Title: "Pedro Páramo (Clásicos, #12)", Author: "Juan Rulfo"}, 1, MatchTitleAuthor},
+		{GoodreadsRow{GoodreadsID: "3", Title: "El llano en llamas", Author: "Juan Rulfo"}, 0, ""},
+	}
+
+	for _, tt := range tests {
+		got := findGoodreadsMatch(books, tt.row, map[int]bool{})
+		if tt.want == 0 {
+			if got != nil {
+				t.Errorf("findGoodreadsMatch(%q) = book %d, want none", tt.row.Title, got.BookID)
+			}
+			continue
+		}
+		if got == nil || got.BookID != tt.want || got.Reason != tt.reason {
+			t.Errorf("findGoodreadsMatch(%q) = %+v, want book %d by %s", tt.row.Title, got, tt.want, tt.reason)
+		}
+	}
+
+	claimed := map[int]bool{1: true}
+	if got := findGoodreadsMatch(books, tests[2].row, claimed); got != nil {
+		t.Errorf("findGoodreadsMatch() matched book %d, which an earlier row took", got.BookID)
+	}
+}
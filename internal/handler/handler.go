@@ -11,8 +11,8 @@ import (
 	"io"
 	"leonlib/internal/auth"
 	"leonlib/internal/captcha"
+	"leonlib/internal/isbn"
 	"log"
-	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -21,27 +21,65 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
-
-	"github.com/BurntSushi/toml"
 )
 
 const (
 	Unknown BookSearchType = iota
 	ByTitle
 	ByAuthor
+	ByISBN
 )
 
 type BookInfo struct {
-	ID            int
-	Title         string
-	Author        string
-	Description   string
-	HasBeenRead   bool
-	ImageNames    []string
-	Image         []byte
-	Base64Images  []BookImageInfo
-	AddedOn       string
-	GoodreadsLink string
+	ID             int
+	WorkID         int
+	Title          string
+	Author         string
+	Authors        []BookAuthor
+	Tags           []Tag
+	Genres         []Genre
+	Series         string
+	SeriesSlug     string
+	SeriesPosition SeriesPosition
+	LocationID     int
+	Location       string
+	OnLoan         bool
+	ActiveLoan     *Loan
+	Loans          []Loan
+	Revisions      []BookRevision
+	Proposal       *MetadataProposal
+	LoanRequested  bool
+	Description    string
+	ISBN10         string
+	ISBN13         string
+	Publisher      string
+	PublishedYear  int
+	PageCount      int
+	Translator     string
+	Format         string
+	Language       string
+	HasBeenRead    bool
+	ReadingStatus  ReadingStatus
+	StartedOn      string
+	FinishedOn     string
+	ImageNames     []string
+	Image          []byte
+	Base64Images   []BookImageInfo
+	AddedOn        string
+	AddedAt        time.Time
+	GoodreadsLink  string
+	PurchasedOn    string
+	PurchasePrice  Price
+	Currency       string
+	Store          string
+	GiftFrom       string
+	UserBook       *UserBook
+	Rating         RatingSummary
+	Reviews        []Review
+	OtherEditions  []BookInfo
+	WorkLikes      int
+	WorkRating     RatingSummary
+	NextInSeries   []BookInfo
 }
 
 type BookImageInfo struct {
@@ -65,7 +103,7 @@ type PageVariables struct {
 type PageVariablesForAuthors struct {
 	Year     string
 	SiteKey  string
-	Authors  []string
+	Groups   []AuthorIndexGroup
 	LoggedIn bool
 }
 
@@ -74,6 +112,7 @@ type PageResultsVariables struct {
 	SiteKey  string
 	Results  []BookInfo
 	LoggedIn bool
+	IsAdmin  bool
 }
 
 type UserInfo struct {
@@ -108,6 +147,8 @@ func (bt BookSearchType) String() string {
 		return "ByTitle"
 	case ByAuthor:
 		return "ByAuthor"
+	case ByISBN:
+		return "ByISBN"
 	default:
 		return "Unknown"
 	}
@@ -149,6 +190,8 @@ func parseBookSearchType(input string) BookSearchType {
 		return ByTitle
 	case "byauthor":
 		return ByAuthor
+	case "byisbn":
+		return ByISBN
 	default:
 		return Unknown
 	}
@@ -271,31 +314,74 @@ func getCurrentUserID(r *http.Request) (string, error) {
 	return userID, nil
 }
 
-func getAllAuthors(db *sql.DB) ([]string, error) {
-	var err error
+// isAdmin reports whether the logged-in user is the main app user.
+func isAdmin(db *sql.DB, r *http.Request) bool {
+	userID, err := getCurrentUserID(r)
+	if err != nil {
+		return false
+	}
 
-	allAuthorsRows, err := db.Query("SELECT DISTINCT author FROM books ORDER BY author")
+	email, err := getDatabaseEmailFromSessionID(db, userID)
 	if err != nil {
-		return []string{}, err
+		log.Printf("error getting email for user_id=(%s): %v", userID, err)
+		return false
 	}
 
-	defer allAuthorsRows.Close()
+	return email != "" && strings.EqualFold(email, auth.AdminEmail)
+}
+
+// bookColumns is the column list expected by scanBookInfo.
+const bookColumns = `b.id, b.work_id, b.title, b.author, b.description, b.isbn_10, b.isbn_13, b.publisher, b.published_year, b.page_count, b.translator, b.format, b.language, b.reading_status, b.started_on, b.finished_on, b.added_on, b.goodreads_link,
+	EXISTS (SELECT 1 FROM loans active_loan WHERE active_loan.book_id = b.id AND active_loan.status = 'active')`
 
-	var authors []string
-	for allAuthorsRows.Next() {
-		var author string
-		if err := allAuthorsRows.Scan(&author); err != nil {
-			return []string{}, err
-		}
-		authors = append(authors, author)
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanBookInfo reads a row selected with bookColumns, followed by any extra columns in extra.
+func scanBookInfo(row rowScanner, extra ...interface{}) (BookInfo, error) {
+	var bookInfo BookInfo
+	var description sql.NullString
+	var isbn10 sql.NullString
+	var isbn13 sql.NullString
+	var publisher sql.NullString
+	var publishedYear sql.NullInt64
+	var pageCount sql.NullInt64
+	var translator sql.NullString
+	var format sql.NullString
+	var language sql.NullString
+	var startedOn sql.NullTime
+	var finishedOn sql.NullTime
+	var addedOn time.Time
+	var goodreadsLink sql.NullString
+
+	dest := []interface{}{&bookInfo.ID, &bookInfo.WorkID, &bookInfo.Title, &bookInfo.Author, &description, &isbn10, &isbn13, &publisher, &publishedYear, &pageCount, &translator, &format, &language, &bookInfo.ReadingStatus, &startedOn, &finishedOn, &addedOn, &goodreadsLink, &bookInfo.OnLoan}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return BookInfo{}, err
 	}
 
-	return authors, nil
+	bookInfo.Description = description.String
+	bookInfo.ISBN10 = isbn10.String
+	bookInfo.ISBN13 = isbn13.String
+	bookInfo.Publisher = publisher.String
+	bookInfo.PublishedYear = int(publishedYear.Int64)
+	bookInfo.PageCount = int(pageCount.Int64)
+	bookInfo.Translator = translator.String
+	bookInfo.Format = format.String
+	bookInfo.Language = language.String
+	bookInfo.HasBeenRead = bookInfo.ReadingStatus.HasBeenRead()
+	bookInfo.StartedOn = formatOptionalDate(startedOn)
+	bookInfo.FinishedOn = formatOptionalDate(finishedOn)
+	bookInfo.AddedOn = addedOn.Format("2006-01-02")
+	bookInfo.AddedAt = addedOn
+	bookInfo.GoodreadsLink = goodreadsLink.String
+
+	return bookInfo, nil
 }
 
 func getAllBooks(db *sql.DB) ([]BookInfo, error) {
 	var err error
-	var queryStr = `SELECT b.id, b.title, b.author, b.description, b.read, b.added_on, b.goodreads_link FROM books b ORDER BY b.author`
+	var queryStr = `SELECT ` + bookColumns + ` FROM books b WHERE b.deleted_at IS NULL ORDER BY b.author`
 
 	booksRows, err := db.Query(queryStr)
 	if err != nil {
@@ -305,39 +391,26 @@ func getAllBooks(db *sql.DB) ([]BookInfo, error) {
 	defer booksRows.Close()
 
 	var books []BookInfo
-	var id int
-	var title string
-	var author string
-	var description string
-	var hasBeenRead bool
-	var addedOn time.Time
-	var goodreadsLink string
 	for booksRows.Next() {
-		var bookInfo BookInfo
-		if err := booksRows.Scan(&id, &title, &author, &description, &hasBeenRead, &addedOn, &goodreadsLink); err != nil {
+		bookInfo, err := scanBookInfo(booksRows)
+		if err != nil {
 			return []BookInfo{}, err
 		}
 
-		bookInfo.ID = id
-		bookInfo.Title = title
-		bookInfo.Author = author
-		bookImages, err := getImagesByBookID(db, id)
+		bookImages, err := getImagesByBookID(db, bookInfo.ID)
 		if err != nil {
 			return []BookInfo{}, err
 		}
 
 		bookInfo.Base64Images = bookImages
-		bookInfo.Description = description
-		bookInfo.HasBeenRead = hasBeenRead
-		bookInfo.AddedOn = addedOn.Format("2006-01-02")
 		books = append(books, bookInfo)
 	}
 
 	return books, nil
 }
 
-func getImagesByBookID(db *sql.DB, bookID int) ([]BookImageInfo, error) {
-	bookImagesRows, err := db.Query(`SELECT i.image_id, i.book_id, i.image FROM book_images i WHERE i.book_id=$1`, bookID)
+func getImagesByBookID(db querier, bookID int) ([]BookImageInfo, error) {
+	bookImagesRows, err := db.Query(`SELECT i.image_id, i.book_id, i.image FROM book_images i WHERE i.book_id=$1 AND i.deleted_at IS NULL`, bookID)
 	if err != nil {
 		return []BookImageInfo{}, err
 	}
@@ -370,43 +443,23 @@ func getImagesByBookID(db *sql.DB, bookID int) ([]BookImageInfo, error) {
 	return images, nil
 }
 
-func getBookByID(db *sql.DB, id int) (BookInfo, error) {
+func getBookByID(db querier, id int) (BookInfo, error) {
 	var err error
-	var queryStr = `SELECT b.id, b.title, b.author, b.description, b.read, b.added_on, b.goodreads_link FROM books b WHERE b.id=$1`
+	var queryStr = `SELECT ` + bookColumns + ` FROM books b WHERE b.id=$1 AND b.deleted_at IS NULL`
 
 	bookRows, err := db.Query(queryStr, id)
 	if err != nil {
 		return BookInfo{}, err
 	}
 
-	defer func() {
-		bookRows.Close()
-	}()
-
 	var bookInfo BookInfo
-	var bookID int
-	var title string
-	var author string
-	var description string
-	var hasBeenRead bool
-	var addedOn time.Time
-	var goodreadsLink sql.NullString
 	if bookRows.Next() {
-		if err := bookRows.Scan(&bookID, &title, &author, &description, &hasBeenRead, &addedOn, &goodreadsLink); err != nil {
-			return BookInfo{}, err
-		}
-
-		bookInfo.ID = bookID
-		bookInfo.Title = title
-		bookInfo.Author = author
-		bookInfo.Description = description
-		bookInfo.HasBeenRead = hasBeenRead
-		bookInfo.AddedOn = addedOn.Format("2006-01-02")
-		if goodreadsLink.Valid {
-			bookInfo.GoodreadsLink = goodreadsLink.String
-		} else {
-			bookInfo.GoodreadsLink = "" // o cualquier valor predeterminado
-		}
+		bookInfo, err = scanBookInfo(bookRows)
+	}
+	// Inside a transaction the rows must be closed before the next query.
+	bookRows.Close()
+	if err != nil {
+		return BookInfo{}, err
 	}
 
 	bookImages, err := getImagesByBookID(db, id)
@@ -419,15 +472,74 @@ func getBookByID(db *sql.DB, id int) (BookInfo, error) {
 	return bookInfo, nil
 }
 
-func getBooksBySearchTypeCoincidence(db *sql.DB, titleSearchText string, bookSearchType BookSearchType) ([]BookInfo, error) {
+// bookFilter narrows a search; empty fields match any book. Genre also matches the subgenres.
+type bookFilter struct {
+	Status ReadingStatus
+	Tag    string
+	Genre  string
+}
+
+// bookFilterConditions skips the books in the trash and uses the placeholder number first for the reading status,
+// first+1 for the tag slug and first+2 for the genre slug, in the order of bookFilter.args.
+func bookFilterConditions(first int) string {
+	status, tag, genre := fmt.Sprintf("$%d", first), fmt.Sprintf("$%d", first+1), fmt.Sprintf("$%d", first+2)
+
+	return `b.deleted_at IS NULL
+	AND (` + status + ` = '' OR b.reading_status::text = ` + status + `)
+	AND (` + tag + ` = '' OR EXISTS (SELECT 1 FROM book_tags bt JOIN tags t ON t.id = bt.tag_id WHERE bt.book_id = b.id AND t.slug = ` + tag + `))
+	AND (` + genre + ` = '' OR EXISTS (SELECT 1 FROM book_genres bg WHERE bg.book_id = b.id AND bg.genre_id IN (` + genreSubtree(genre) + `)))`
+}
+
+func (bf bookFilter) args() []interface{} {
+	return []interface{}{string(bf.Status), bf.Tag, bf.Genre}
+}
+
+func parseBookFilter(r *http.Request) (bookFilter, error) {
+	var filter bookFilter
+	if statusParam := r.URL.Query().Get("status"); statusParam != "" {
+		readingStatus, err := parseReadingStatus(statusParam)
+		if err != nil {
+			return bookFilter{}, err
+		}
+		filter.Status = readingStatus
+	}
+
+	if tagParam := r.URL.Query().Get("tag"); tagParam != "" {
+		filter.Tag = slugify(tagParam)
+	}
+
+	if genreParam := r.URL.Query().Get("genre"); genreParam != "" {
+		filter.Genre = slugify(genreParam)
+	}
+
+	return filter, nil
+}
+
+// getBooksBySearchTypeCoincidence searches by title, author or ISBN, narrowed by the filter.
+func getBooksBySearchTypeCoincidence(db *sql.DB, titleSearchText string, bookSearchType BookSearchType, filter bookFilter) ([]BookInfo, error) {
 	var err error
-	var queryStr = `SELECT b.id, b.title, b.author, b.description, b.read, b.added_on, b.goodreads_link FROM books b WHERE b.title ILIKE $1 ORDER BY b.title`
+	var queryStr = `SELECT ` + bookColumns + ` FROM books b WHERE b.title ILIKE $1 AND ` + bookFilterConditions(2) + ` ORDER BY b.title`
+	var searchParam = "%" + titleSearchText + "%"
 
-	if bookSearchType == ByAuthor {
-		queryStr = `SELECT b.id, b.title, b.author, b.description, b.read, b.added_on, b.goodreads_link FROM books b WHERE b.author ILIKE $1 ORDER BY b.title`
+	switch bookSearchType {
+	case ByAuthor:
+		queryStr = `SELECT ` + bookColumns + ` FROM books b
+			WHERE (b.author ILIKE $1 OR EXISTS (
+				SELECT 1 FROM book_authors ba
+				JOIN author_aliases aa ON aa.author_id = ba.author_id
+				WHERE ba.book_id = b.id AND aa.alias ILIKE $1))
+			  AND ` + bookFilterConditions(2) + `
+			ORDER BY b.title`
+	case ByISBN:
+		isbn13, err := isbn.Normalize(titleSearchText)
+		if err != nil {
+			return []BookInfo{}, nil
+		}
+		queryStr = `SELECT ` + bookColumns + ` FROM books b WHERE b.isbn_13 = $1 AND ` + bookFilterConditions(2) + ` ORDER BY b.title`
+		searchParam = isbn13
 	}
 
-	booksByTitleRows, err := db.Query(queryStr, "%"+titleSearchText+"%")
+	booksByTitleRows, err := db.Query(queryStr, append([]interface{}{searchParam}, filter.args()...)...)
 	if err != nil {
 		return []BookInfo{}, err
 	}
@@ -435,31 +547,18 @@ func getBooksBySearchTypeCoincidence(db *sql.DB, titleSearchText string, bookSea
 	defer booksByTitleRows.Close()
 
 	var books []BookInfo
-	var id int
-	var title string
-	var author string
-	var description string
-	var hasBeenRead bool
-	var addedOn time.Time
-	var goodreadsLink string
 	for booksByTitleRows.Next() {
-		var bookInfo BookInfo
-		if err := booksByTitleRows.Scan(&id, &title, &author, &description, &hasBeenRead, &addedOn, &goodreadsLink); err != nil {
+		bookInfo, err := scanBookInfo(booksByTitleRows)
+		if err != nil {
 			return []BookInfo{}, err
 		}
 
-		bookInfo.ID = id
-		bookInfo.Title = title
-		bookInfo.Author = author
-		bookImages, err := getImagesByBookID(db, id)
+		bookImages, err := getImagesByBookID(db, bookInfo.ID)
 		if err != nil {
 			return []BookInfo{}, err
 		}
 
 		bookInfo.Base64Images = bookImages
-		bookInfo.Description = description
-		bookInfo.HasBeenRead = hasBeenRead
-		bookInfo.AddedOn = addedOn.Format("2006-01-02")
 		books = append(books, bookInfo)
 	}
 
@@ -543,7 +642,7 @@ func BooksByAuthorPage(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		pageVariables.LoggedIn = true
 	}
 
-	pageVariables.Authors = authors
+	pageVariables.Groups = groupAuthorsByInitial(authors)
 
 	templateDir := os.Getenv("TEMPLATE_DIR")
 	if templateDir == "" {
@@ -633,7 +732,13 @@ func AllBooksPage(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 func BooksList(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	authorParam := r.URL.Query().Get("start_with")
 
-	booksByAuthor, err := getBooksBySearchTypeCoincidence(db, authorParam, ByAuthor)
+	filter, err := parseBookFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	booksByAuthor, err := getBooksBySearchTypeCoincidence(db, authorParam, ByAuthor, filter)
 	if err != nil {
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
@@ -644,6 +749,7 @@ func BooksList(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		Title        string          `json:"title"`
 		Author       string          `json:"author"`
 		Description  string          `json:"description"`
+		OnLoan       bool            `json:"on_loan"`
 		Base64Images []BookImageInfo `json:"images"`
 	}
 
@@ -655,6 +761,7 @@ func BooksList(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		bookDetail.Title = book.Title
 		bookDetail.Author = book.Author
 		bookDetail.Description = book.Description
+		bookDetail.OnLoan = book.OnLoan
 		bookDetail.Base64Images = book.Base64Images
 
 		results = append(results, bookDetail)
@@ -665,7 +772,7 @@ func BooksList(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 }
 
 func BooksCount(db *sql.DB, w http.ResponseWriter) {
-	queryStr := `SELECT count(*) FROM books`
+	queryStr := `SELECT count(*) FROM books WHERE deleted_at IS NULL`
 	rows, err := db.Query(queryStr)
 	if err != nil {
 		http.Error(w, "Database error", http.StatusInternalServerError)
@@ -697,16 +804,21 @@ func SearchBooksPage(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		searchTypesParams = []string{"byTitle"}
 	}
 
-	fmt.Printf("debug:x textSearch=(%s), searchTypesParams=(%s)\n", bookQuery, searchTypesParams)
-
 	var results []BookInfo
 	var err error
 
+	filter, err := parseBookFilter(r)
+	if err != nil {
+		log.Printf("error: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "Wrong search", http.StatusBadRequest)
+		return
+	}
+
 	for _, searchTypeParam := range searchTypesParams {
 		searchType := parseBookSearchType(searchTypeParam)
 		switch searchType {
 		case ByTitle:
-			booksByTitle, err := getBooksBySearchTypeCoincidence(db, bookQuery, ByTitle)
+			booksByTitle, err := getBooksBySearchTypeCoincidence(db, bookQuery, ByTitle, filter)
 			if err != nil {
 				redirectToErrorPageWithMessageAndStatusCode(w, "Error getting information from the database", http.StatusInternalServerError)
 
@@ -715,7 +827,7 @@ func SearchBooksPage(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 			results = append(results, booksByTitle...)
 
 		case ByAuthor:
-			booksByAuthor, err := getBooksBySearchTypeCoincidence(db, bookQuery, ByAuthor)
+			booksByAuthor, err := getBooksBySearchTypeCoincidence(db, bookQuery, ByAuthor, filter)
 			if err != nil {
 				log.Printf("error getting info from the database: %v", err)
 				redirectToErrorPageWithMessageAndStatusCode(w, "error getting info from the database", http.StatusInternalServerError)
@@ -723,6 +835,15 @@ func SearchBooksPage(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 			}
 			results = append(results, booksByAuthor...)
 
+		case ByISBN:
+			booksByISBN, err := getBooksBySearchTypeCoincidence(db, bookQuery, ByISBN, filter)
+			if err != nil {
+				log.Printf("error getting info from the database: %v", err)
+				redirectToErrorPageWithMessageAndStatusCode(w, "error getting info from the database", http.StatusInternalServerError)
+				return
+			}
+			results = append(results, booksByISBN...)
+
 		case Unknown:
 			log.Printf("Tipo de búsqueda en libros desconocido.")
 			redirectToErrorPageWithMessageAndStatusCode(w, "Wrong search", http.StatusInternalServerError)
@@ -924,6 +1045,11 @@ func LikeBook(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 }
 
 func AddBook(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can add books", http.StatusForbidden)
+		return
+	}
+
 	err := r.ParseMultipartForm(2 << 20) // Por ejemplo, 10 MB
 	if err != nil {
 		log.Printf("1) error: %v", err)
@@ -934,9 +1060,68 @@ func AddBook(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	title := r.FormValue("title")
 	author := r.FormValue("author")
 	description := r.FormValue("description")
-	read := r.FormValue("read") == "on"
 	goodreadsLink := r.FormValue("goodreadsLink")
 
+	readingStatus, err := parseReadingStatusForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bookISBN, err := parseBookISBN(r.FormValue("isbn"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	edition, err := parseEditionForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tags, err := parseTagList(r.FormValue("tags"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	seriesPosition, err := parseSeriesPosition(r.FormValue("series_position"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	locationID, err := parseLocationID(r.FormValue("location_id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	acquisition, err := parseAcquisitionForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	wishlistID, err := parseOptionalPositiveInt("wishlist_id", r.FormValue("wishlist_id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	author, err = resolveAuthorAliases(db, author)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	edition.Translator.String, err = resolveAuthorAliases(db, edition.Translator.String)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	var imageData []byte
 	file, _, err := r.FormFile("image")
 	if err == nil {
@@ -951,18 +1136,117 @@ func AddBook(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	stmt, err := db.Prepare("INSERT INTO books (title, author, image, description, read, goodreads_link) VALUES ($1, $2, $3, $4, $5, $6)")
+	if coverURL := r.FormValue("cover_url"); len(imageData) == 0 && coverURL != "" && MetadataProvider != nil {
+		imageData, err = MetadataProvider.Cover(r.Context(), coverURL)
+		if err != nil {
+			log.Printf("error downloading cover %s: %v", coverURL, err)
+			imageData = nil
+		}
+	}
+
+	candidate := BookInfo{
+		Title:         title,
+		Author:        author,
+		ISBN13:        bookISBN.ISBN13.String,
+		Publisher:     edition.Publisher.String,
+		PublishedYear: int(edition.Year.Int64),
+		Format:        edition.Format.String,
+		Language:      edition.Language.String,
+	}
+
+	duplicates, err := findDuplicates(db, candidate, imageData)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer stmt.Close()
 
-	_, err = stmt.Exec(title, author, imageData, description, read, goodreadsLink)
+	// The same ISBN is never allowed; the other matches can be confirmed by the user.
+	if r.FormValue("allow_duplicate") == "true" {
+		duplicates = sameISBNOnly(duplicates)
+	}
+
+	if len(duplicates) > 0 {
+		writeDuplicatesFound(w, duplicates)
+		return
+	}
+
+	// The book is written all at once, so a failure does not leave half of it behind.
+	tx, err := db.Begin()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	workID, err := findOrCreateWork(tx, title, author)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var bookID int
+	err = tx.QueryRow("INSERT INTO books (work_id, title, author, description, isbn_10, isbn_13, publisher, published_year, page_count, translator, format, language, reading_status, started_on, finished_on, goodreads_link) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16) RETURNING id",
+		workID, title, author, description, bookISBN.ISBN10, bookISBN.ISBN13, edition.Publisher, edition.Year, edition.PageCount, edition.Translator, edition.Format, edition.Language, readingStatus.Status, readingStatus.StartedOn, readingStatus.FinishedOn, goodreadsLink).Scan(&bookID)
+	if isUniqueViolation(err) {
+		http.Error(w, "Ya existe un libro con ese ISBN", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(imageData) > 0 {
+		err = insertBookImage(tx, bookID, imageData, "")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := replaceAuthorAndTranslatorCredits(tx, bookID, author, edition.Translator.String); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := replaceBookTags(tx, bookID, tags); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := setBookSeries(tx, bookID, r.FormValue("series"), seriesPosition); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := setBookLocation(tx, bookID, locationID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := setBookAcquisition(tx, bookID, acquisition); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if wishlistID.Valid {
+		if err := markWishlistAcquired(tx, int(wishlistID.Int64), bookID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := recordBookAudit(tx, r, AuditCreate, bookID, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	w.Write([]byte("Libro agregado con éxito"))
 }
@@ -984,8 +1268,6 @@ func UnlikeBook(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 
 	bookID := requestData.BookID
 
-	fmt.Printf("debug:x trying to unlike book_id=(%s), user_id=(%s)\n", bookID, userID)
-
 	_, err = db.Exec("DELETE FROM book_likes WHERE book_id=$1 AND user_id=$2", bookID, userID)
 	if err != nil {
 		http.Error(w, "Error al quitar el like en la base de datos", http.StatusInternalServerError)
@@ -1023,94 +1305,189 @@ func LikesCount(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
-func CreateDBFromFile(db *sql.DB, w http.ResponseWriter) {
-	libraryDir := "library"
-	libraryDirPath := filepath.Join(libraryDir, "books_db.toml")
+func InfoBook(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	idQueryParam := r.URL.Query().Get("id")
 
-	var library Library
+	id, err := strconv.Atoi(idQueryParam)
+	if err != nil {
+		redirectToErrorPage(w, r)
+		return
+	}
 
-	if _, err := toml.DecodeFile(libraryDirPath, &library); err != nil {
-		writeErrorGeneralStatus(w, err)
+	bookByID, err := getBookByID(db, id)
+	if err != nil {
+		log.Printf("error: getting information from the database")
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+	if bookByID.ID == 0 {
+		redirectToErrorPageWithMessageAndStatusCode(w, "book not found", http.StatusNotFound)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	now := time.Now()
 
-	startTime := time.Now()
+	pageVariables := PageResultsVariables{
+		Year:    now.Format("2006"),
+		SiteKey: captcha.SiteKey,
+		Results: []BookInfo{bookByID},
+	}
 
-	for _, book := range library.Book {
-		log.Printf("Reading: (%s)", book)
+	userID, err := getCurrentUserID(r)
+	if err != nil {
+		pageVariables.LoggedIn = false
+	} else {
+		pageVariables.LoggedIn = true
 
-		var bookID int
-		stmt, err := db.Prepare("INSERT INTO books(title, author, description, read, added_on, goodreads_link) VALUES($1, $2, $3, $4, $5, $6) RETURNING id")
+		userBook, err := getUserBook(db, userID, id)
 		if err != nil {
-			writeErrorGeneralStatus(w, err)
+			log.Printf("error getting user book: %v", err)
+			redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
 			return
 		}
+		pageVariables.Results[0].UserBook = userBook
+	}
 
-		err = stmt.QueryRow(book.Title, book.Author, book.Description, book.HasBeenRead, book.AddedOn, book.GoodreadsLink).Scan(&bookID)
-		if err != nil {
-			writeErrorGeneralStatus(w, err)
-			return
-		}
+	pageVariables.IsAdmin = isAdmin(db, r)
 
-		for _, imageName := range book.ImageNames {
-			imgBytes, err := os.ReadFile(filepath.Join("images", imageName))
-			if err != nil {
-				writeErrorGeneralStatus(w, err)
-				return
-			}
+	reviews, err := getReviewsByBookID(db, id, userID, pageVariables.IsAdmin)
+	if err != nil {
+		log.Printf("error getting reviews: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+	pageVariables.Results[0].Reviews = reviews
 
-			imgStmt, err := db.Prepare("INSERT INTO book_images(book_id, image) VALUES($1, $2)")
-			if err != nil {
-				writeErrorGeneralStatus(w, err)
-				return
-			}
+	rating, err := getRatingSummary(db, id)
+	if err != nil {
+		log.Printf("error getting rating summary: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+	pageVariables.Results[0].Rating = rating
 
-			_, err = imgStmt.Exec(bookID, imgBytes)
-			if err != nil {
-				writeErrorGeneralStatus(w, err)
-				return
-			}
+	credits, err := getBookAuthors(db, id)
+	if err != nil {
+		log.Printf("error getting book credits: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+	pageVariables.Results[0].Authors = credits
+
+	tags, err := getBookTags(db, id)
+	if err != nil {
+		log.Printf("error getting book tags: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+	pageVariables.Results[0].Tags = tags
+
+	genres, err := getBookGenres(db, id)
+	if err != nil {
+		log.Printf("error getting book genres: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+	pageVariables.Results[0].Genres = genres
+
+	if err := getBookSeries(db, &pageVariables.Results[0]); err != nil {
+		log.Printf("error getting book series: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	if err := getBookLocation(db, &pageVariables.Results[0]); err != nil {
+		log.Printf("error getting book location: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	if err := getBookAcquisition(db, &pageVariables.Results[0]); err != nil {
+		log.Printf("error getting book acquisition: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	if bookByID.OnLoan {
+		activeLoan, err := getActiveLoan(db, id)
+		if err != nil {
+			log.Printf("error getting active loan: %v", err)
+			redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+			return
 		}
+		pageVariables.Results[0].ActiveLoan = activeLoan
 	}
 
-	elapsedTime := time.Since(startTime)
+	if pageVariables.IsAdmin {
+		loans, err := getBookLoans(db, id)
+		if err != nil {
+			log.Printf("error getting book loans: %v", err)
+			redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+			return
+		}
+		pageVariables.Results[0].Loans = loans
 
-	log.Printf("Books loaded in: %.2f seconds\n", elapsedTime.Seconds())
+		revisions, err := getBookRevisions(db, id)
+		if err != nil {
+			log.Printf("error getting book revisions: %v", err)
+			redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+			return
+		}
+		pageVariables.Results[0].Revisions = revisions
 
-	json.NewEncoder(w).Encode(map[string]string{"status": "OK"})
-}
+		proposals, err := getMetadataProposals(db, id, 0)
+		if err != nil {
+			log.Printf("error getting metadata proposals: %v", err)
+			redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+			return
+		}
+		if len(proposals) > 0 {
+			pageVariables.Results[0].Proposal = &proposals[0]
+		}
+	}
 
-func InfoBook(db *sql.DB, w http.ResponseWriter, r *http.Request) {
-	idQueryParam := r.URL.Query().Get("id")
+	if pageVariables.LoggedIn {
+		loanRequested, err := hasPendingLoanRequest(db, id, userID)
+		if err != nil {
+			log.Printf("error getting loan requests: %v", err)
+			redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+			return
+		}
+		pageVariables.Results[0].LoanRequested = loanRequested
+	}
 
-	id, err := strconv.Atoi(idQueryParam)
+	nextInSeries, err := getNextInSeries(db, pageVariables.Results[0], userID)
 	if err != nil {
-		redirectToErrorPage(w, r)
+		log.Printf("error getting next in series: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
 		return
 	}
+	pageVariables.Results[0].NextInSeries = nextInSeries
 
-	bookByID, err := getBookByID(db, id)
+	otherEditions, err := getOtherEditions(db, bookByID.WorkID, id)
 	if err != nil {
-		log.Printf("error: getting information from the database")
+		log.Printf("error getting other editions: %v", err)
 		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
 		return
 	}
+	pageVariables.Results[0].OtherEditions = otherEditions
 
-	now := time.Now()
-
-	pageVariables := PageResultsVariables{
-		Year:    now.Format("2006"),
-		SiteKey: captcha.SiteKey,
-		Results: []BookInfo{bookByID},
-	}
+	if len(otherEditions) > 0 {
+		workLikes, err := getWorkLikesCount(db, bookByID.WorkID)
+		if err != nil {
+			log.Printf("error getting work likes: %v", err)
+			redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+			return
+		}
+		pageVariables.Results[0].WorkLikes = workLikes
 
-	_, err = getCurrentUserID(r)
-	if err != nil {
-		pageVariables.LoggedIn = false
-	} else {
-		pageVariables.LoggedIn = true
+		workRating, err := getWorkRatingSummary(db, bookByID.WorkID)
+		if err != nil {
+			log.Printf("error getting work rating: %v", err)
+			redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+			return
+		}
+		pageVariables.Results[0].WorkRating = workRating
 	}
 
 	templateDir := os.Getenv("TEMPLATE_DIR")
@@ -1134,7 +1511,12 @@ func InfoBook(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 }
 
 func ModifyBook(db *sql.DB, w http.ResponseWriter, r *http.Request) {
-	// TODO: check auth here
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can modify books", http.StatusForbidden)
+
+		return
+	}
+
 	err := r.ParseMultipartForm(2 << 20)
 	if err != nil {
 		writeErrorGeneralStatus(w, err)
@@ -1146,11 +1528,77 @@ func ModifyBook(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	title := r.FormValue("title")
 	author := r.FormValue("author")
 	description := r.FormValue("description")
-	read := r.FormValue("read") == "on"
 	goodreadsLink := r.FormValue("goodreadsLink")
 
-	fmt.Printf("debug:x bookID=(%s), title=(%s), author=(%s), description=(%s), read=(%t), goodreadsLink=(%s)\n",
-		bookIDParam, title, author, description, read, goodreadsLink)
+	readingStatus, err := parseReadingStatusForm(r)
+	if err != nil {
+		writeErrorGeneralStatus(w, err)
+
+		return
+	}
+
+	bookISBN, err := parseBookISBN(r.FormValue("isbn"))
+	if err != nil {
+		writeErrorGeneralStatus(w, err)
+
+		return
+	}
+
+	edition, err := parseEditionForm(r)
+	if err != nil {
+		writeErrorGeneralStatus(w, err)
+
+		return
+	}
+
+	tags, err := parseTagList(r.FormValue("tags"))
+	if err != nil {
+		writeErrorGeneralStatus(w, err)
+
+		return
+	}
+
+	genreIDs, err := parseGenreIDs(r.Form["genres"])
+	if err != nil {
+		writeErrorGeneralStatus(w, err)
+
+		return
+	}
+
+	seriesPosition, err := parseSeriesPosition(r.FormValue("series_position"))
+	if err != nil {
+		writeErrorGeneralStatus(w, err)
+
+		return
+	}
+
+	locationID, err := parseLocationID(r.FormValue("location_id"))
+	if err != nil {
+		writeErrorGeneralStatus(w, err)
+
+		return
+	}
+
+	acquisition, err := parseAcquisitionForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	author, err = resolveAuthorAliases(db, author)
+	if err != nil {
+		writeErrorGeneralStatus(w, err)
+
+		return
+	}
+
+	edition.Translator.String, err = resolveAuthorAliases(db, edition.Translator.String)
+	if err != nil {
+		writeErrorGeneralStatus(w, err)
+
+		return
+	}
 
 	id, err := strconv.Atoi(bookIDParam)
 	if err != nil {
@@ -1159,34 +1607,122 @@ func ModifyBook(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	file, _, err := r.FormFile("image")
-	err = addImageToBook(db, id, r, file)
+	// The book is written all at once, so a failure does not leave half of it behind.
+	tx, err := db.Begin()
+	if err != nil {
+		writeErrorGeneralStatus(w, err)
+
+		return
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	before, err := getBookDetails(tx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Book not found", http.StatusNotFound)
+
+		return
+	}
 	if err != nil {
 		writeErrorGeneralStatus(w, err)
 
 		return
 	}
 
-	bookUpdate, err := db.Prepare(`
+	workID, err := resolveWorkID(tx, r.FormValue("work_id"), title, author)
+	if err != nil {
+		writeErrorGeneralStatus(w, err)
+
+		return
+	}
+
+	if err := addImageToBook(tx, id, r); err != nil {
+		writeErrorGeneralStatus(w, err)
+
+		return
+	}
+
+	result, err := tx.Exec(`
 		UPDATE books SET 
 			title = $1,
 			author = $2,
 			description = $3,
-			read = $4,
-			goodreads_link = $5
-		WHERE id = $6
-	`)
+			isbn_10 = $4,
+			isbn_13 = $5,
+			publisher = $6,
+			published_year = $7,
+			page_count = $8,
+			translator = $9,
+			format = $10,
+			language = $11,
+			reading_status = $12,
+			started_on = $13,
+			finished_on = $14,
+			goodreads_link = $15,
+			work_id = $16
+		WHERE id = $17 AND deleted_at IS NULL
+	`, title, author, description, bookISBN.ISBN10, bookISBN.ISBN13, edition.Publisher, edition.Year, edition.PageCount, edition.Translator, edition.Format, edition.Language, readingStatus.Status, readingStatus.StartedOn, readingStatus.FinishedOn, goodreadsLink, workID, id)
 	if err != nil {
 		writeErrorGeneralStatus(w, err)
 
 		return
 	}
-	defer func() {
-		_ = bookUpdate.Close()
-	}()
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		http.Error(w, "Book not found", http.StatusNotFound)
 
-	_, err = bookUpdate.Exec(title, author, description, read, goodreadsLink, id)
-	if err != nil {
+		return
+	}
+
+	if err := replaceAuthorAndTranslatorCredits(tx, id, author, edition.Translator.String); err != nil {
+		writeErrorGeneralStatus(w, err)
+
+		return
+	}
+
+	if err := replaceBookTags(tx, id, tags); err != nil {
+		writeErrorGeneralStatus(w, err)
+
+		return
+	}
+
+	if err := replaceBookGenres(tx, id, genreIDs); err != nil {
+		writeErrorGeneralStatus(w, err)
+
+		return
+	}
+
+	if err := setBookSeries(tx, id, r.FormValue("series"), seriesPosition); err != nil {
+		writeErrorGeneralStatus(w, err)
+
+		return
+	}
+
+	if err := setBookLocation(tx, id, locationID); err != nil {
+		writeErrorGeneralStatus(w, err)
+
+		return
+	}
+
+	if err := setBookAcquisition(tx, id, acquisition); err != nil {
+		writeErrorGeneralStatus(w, err)
+
+		return
+	}
+
+	if err := deleteOrphanWorks(tx); err != nil {
+		writeErrorGeneralStatus(w, err)
+
+		return
+	}
+
+	if err := recordBookEditIn(tx, auditActor(r), AuditUpdate, before, 0); err != nil {
+		writeErrorGeneralStatus(w, err)
+
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
 		writeErrorGeneralStatus(w, err)
 
 		return
@@ -1195,7 +1731,7 @@ func ModifyBook(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("Libro modificado con exito"))
 }
 
-func addImageToBook(db *sql.DB, id int, r *http.Request, file multipart.File) error {
+func addImageToBook(q execer, id int, r *http.Request) error {
 	var imageData []byte
 	file, _, err := r.FormFile("image")
 	if err == nil {
@@ -1212,17 +1748,7 @@ func addImageToBook(db *sql.DB, id int, r *http.Request, file multipart.File) er
 		return nil
 	}
 
-	imgStmt, err := db.Prepare("INSERT INTO book_images(book_id, image) VALUES($1, $2)")
-	if err != nil {
-		return err
-	}
-
-	_, err = imgStmt.Exec(id, imageData)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return insertBookImage(q, id, imageData, "")
 }
 
 func ModifyBookPage(db *sql.DB, w http.ResponseWriter, r *http.Request) {
@@ -1239,6 +1765,43 @@ func ModifyBookPage(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
 		return
 	}
+	if bookByID.ID == 0 {
+		redirectToErrorPageWithMessageAndStatusCode(w, "book not found", http.StatusNotFound)
+		return
+	}
+
+	tags, err := getBookTags(db, id)
+	if err != nil {
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	genres, err := getGenreTree(db, id)
+	if err != nil {
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	if err := getBookSeries(db, &bookByID); err != nil {
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	if err := getBookLocation(db, &bookByID); err != nil {
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	if err := getBookAcquisition(db, &bookByID); err != nil {
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	locations, err := getLocationTree(db, bookByID.LocationID)
+	if err != nil {
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
 
 	now := time.Now()
 
@@ -1248,6 +1811,14 @@ func ModifyBookPage(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		Book          BookInfo
 		LoggedIn      bool
 		GoodreadsLink template.URL
+		Tags          string
+		Genres        []Genre
+		Locations     []Location
+	}
+
+	tagNames := make([]string, len(tags))
+	for i, tag := range tags {
+		tagNames[i] = tag.Name
 	}
 
 	pageVariables := BookToModifyVariables{
@@ -1255,6 +1826,9 @@ func ModifyBookPage(db *sql.DB, w http.ResponseWriter, r *http.Request) {
 		SiteKey:       captcha.SiteKey,
 		Book:          bookByID,
 		GoodreadsLink: template.URL(bookByID.GoodreadsLink),
+		Tags:          strings.Join(tagNames, ", "),
+		Genres:        genres,
+		Locations:     locations,
 	}
 
 	//_, err = getCurrentUserID(r)
@@ -1357,8 +1931,6 @@ func AddBookPage(w http.ResponseWriter, r *http.Request) {
 
 			return
 		}
-
-		fmt.Printf("debug:x email=(%s)\n", email)
 	*/
 
 	templateDir := os.Getenv("TEMPLATE_DIR")
@@ -1391,18 +1963,37 @@ func AddBookPage(w http.ResponseWriter, r *http.Request) {
 }
 
 func RemoveImage(db *sql.DB, w http.ResponseWriter, r *http.Request) {
-	// TODO: check auth
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can remove images", http.StatusForbidden)
+		return
+	}
 
 	r.ParseForm()
 	imageID := r.PostFormValue("image_id")
 
-	log.Printf("debug:x about to remove=(%s)", imageID)
+	id, err := strconv.Atoi(imageID)
+	if err != nil {
+		http.Error(w, "Invalid image_id", http.StatusBadRequest)
+		return
+	}
 
-	_, err := db.Exec("DELETE FROM book_images WHERE image_id=$1", imageID)
+	subject, err := getTrashSubject(db, AuditImage, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.Write([]byte("Image removed OK..."))
+		return
+	}
 	if err != nil {
 		http.Error(w, "Error removing image", http.StatusInternalServerError)
 		return
 	}
 
+	// The image goes to the trash, where an admin can restore it.
+	if err := trashImage(db, id); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Error removing image", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(db, r, AuditDelete, AuditImage, id, subject, nil)
+
 	w.Write([]byte("Image removed OK..."))
 }
@@ -0,0 +1,466 @@
+package handler
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"path"
+
+	"github.com/BurntSushi/toml"
+)
+
+// exportBook is a book as written in books_db.toml; the keys are the ones CreateDBFromFile reads back.
+type exportBook struct {
+	ID             int      `toml:"-"`
+	Likes          int      `toml:"-"`
+	Title          string   `toml:"title"`
+	Author         string   `toml:"author"`
+	Description    string   `toml:"description,omitempty"`
+	ISBN10         string   `toml:"isbn10,omitempty"`
+	ISBN13         string   `toml:"isbn13,omitempty"`
+	Publisher      string   `toml:"publisher,omitempty"`
+	PublishedYear  int      `toml:"publishedYear,omitzero"`
+	PageCount      int      `toml:"pageCount,omitzero"`
+	Translator     string   `toml:"translator,omitempty"`
+	Format         string   `toml:"format,omitempty"`
+	Language       string   `toml:"language,omitempty"`
+	Series         string   `toml:"series,omitempty"`
+	SeriesPosition float64  `toml:"seriesPosition,omitzero"`
+	HasBeenRead    bool     `toml:"hasBeenRead"`
+	ReadingStatus  string   `toml:"readingStatus,omitempty"`
+	StartedOn      string   `toml:"startedOn,omitempty"`
+	FinishedOn     string   `toml:"finishedOn,omitempty"`
+	Tags           []string `toml:"tags,omitempty"`
+	Genres         []string `toml:"genres,omitempty"`
+	Location       string   `toml:"location,omitempty"`
+	ImageNames     []string `toml:"imageNames"`
+	AddedOn        string   `toml:"addedOn"`
+	GoodreadsLink  string   `toml:"goodreadsLink,omitempty"`
+	PurchasedOn    string   `toml:"purchasedOn,omitempty"`
+	PurchasePrice  float64  `toml:"purchasePrice,omitzero"`
+	Currency       string   `toml:"currency,omitempty"`
+	Store          string   `toml:"store,omitempty"`
+	GiftFrom       string   `toml:"giftFrom,omitempty"`
+}
+
+type exportLibrary struct {
+	Book []exportBook `toml:"book"`
+}
+
+// addedOnLayout keeps the whole added_on timestamp, so an imported export keeps the order the books were added in.
+const addedOnLayout = "2006-01-02T15:04:05.999999"
+
+// exportImage is an image of a book with the name of the file it was imported from, if any.
+type exportImage struct {
+	FileName string
+	Data     []byte
+}
+
+// imageExtensions maps the detected content type of an image to the extension of its file.
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// exportImageName names an image without a file name after its content, so exporting the same catalog again gives
+// the same files.
+func exportImageName(image []byte) string {
+	sum := sha256.Sum256(image)
+
+	extension, ok := imageExtensions[http.DetectContentType(image)]
+	if !ok {
+		extension = ".jpg"
+	}
+
+	return hex.EncodeToString(sum[:8]) + extension
+}
+
+func getBookImageData(db *sql.DB, bookID int) ([]exportImage, error) {
+	rows, err := db.Query(`SELECT image, COALESCE(file_name, '') FROM book_images
+		WHERE book_id = $1 AND deleted_at IS NULL
+		ORDER BY image_id`, bookID)
+	if err != nil {
+		return []exportImage{}, err
+	}
+
+	defer rows.Close()
+
+	var images []exportImage
+	for rows.Next() {
+		var image exportImage
+		if err := rows.Scan(&image.Data, &image.FileName); err != nil {
+			return []exportImage{}, err
+		}
+		if len(image.Data) > 0 {
+			images = append(images, image)
+		}
+	}
+
+	return images, rows.Err()
+}
+
+func exportBookFromInfo(book BookInfo) exportBook {
+	exported := exportBook{
+		ID:             book.ID,
+		Title:          book.Title,
+		Author:         book.Author,
+		Description:    book.Description,
+		ISBN10:         book.ISBN10,
+		ISBN13:         book.ISBN13,
+		Publisher:      book.Publisher,
+		PublishedYear:  book.PublishedYear,
+		PageCount:      book.PageCount,
+		Translator:     book.Translator,
+		Format:         book.Format,
+		Language:       book.Language,
+		Series:         book.Series,
+		SeriesPosition: float64(book.SeriesPosition),
+		HasBeenRead:    book.ReadingStatus.HasBeenRead(),
+		ReadingStatus:  string(book.ReadingStatus),
+		StartedOn:      book.StartedOn,
+		FinishedOn:     book.FinishedOn,
+		Location:       book.Location,
+		ImageNames:     []string{},
+		AddedOn:        book.AddedAt.Format(addedOnLayout),
+		GoodreadsLink:  book.GoodreadsLink,
+		PurchasedOn:    book.PurchasedOn,
+		PurchasePrice:  float64(book.PurchasePrice),
+		Currency:       book.Currency,
+		Store:          book.Store,
+		GiftFrom:       book.GiftFrom,
+	}
+
+	for _, tag := range book.Tags {
+		exported.Tags = append(exported.Tags, tag.Name)
+	}
+	for _, genre := range book.Genres {
+		exported.Genres = append(exported.Genres, genre.Slug)
+	}
+
+	return exported
+}
+
+func getLikesCounts(db *sql.DB) (map[int]int, error) {
+	rows, err := db.Query("SELECT book_id, COUNT(*) FROM book_likes GROUP BY book_id")
+	if err != nil {
+		return map[int]int{}, err
+	}
+
+	defer rows.Close()
+
+	counts := map[int]int{}
+	for rows.Next() {
+		var bookID, count int
+		if err := rows.Scan(&bookID, &count); err != nil {
+			return map[int]int{}, err
+		}
+		counts[bookID] = count
+	}
+
+	return counts, rows.Err()
+}
+
+func getAllBookTags(db *sql.DB) (map[int][]Tag, error) {
+	rows, err := db.Query(`SELECT bt.book_id, t.id, t.name, t.slug
+		FROM book_tags bt
+		JOIN tags t ON t.id = bt.tag_id
+		ORDER BY bt.book_id, t.slug`)
+	if err != nil {
+		return map[int][]Tag{}, err
+	}
+
+	defer rows.Close()
+
+	tags := map[int][]Tag{}
+	for rows.Next() {
+		var bookID int
+		var tag Tag
+		if err := rows.Scan(&bookID, &tag.ID, &tag.Name, &tag.Slug); err != nil {
+			return map[int][]Tag{}, err
+		}
+		tags[bookID] = append(tags[bookID], tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// getAllBookGenres returns the genres of every book in the order of the genre tree, like getBookGenres.
+func getAllBookGenres(db *sql.DB) (map[int][]Genre, error) {
+	tree, err := getGenreTree(db, 0)
+	if err != nil {
+		return map[int][]Genre{}, err
+	}
+
+	byID := map[int]Genre{}
+	for _, genre := range tree {
+		byID[genre.ID] = genre
+	}
+
+	rows, err := db.Query("SELECT book_id, genre_id FROM book_genres")
+	if err != nil {
+		return map[int][]Genre{}, err
+	}
+
+	defer rows.Close()
+
+	selected := map[int]map[int]bool{}
+	for rows.Next() {
+		var bookID, genreID int
+		if err := rows.Scan(&bookID, &genreID); err != nil {
+			return map[int][]Genre{}, err
+		}
+		if selected[bookID] == nil {
+			selected[bookID] = map[int]bool{}
+		}
+		selected[bookID][genreID] = true
+	}
+	if err := rows.Err(); err != nil {
+		return map[int][]Genre{}, err
+	}
+
+	genres := map[int][]Genre{}
+	for bookID, ids := range selected {
+		for _, genre := range tree {
+			if ids[genre.ID] {
+				genre.Selected = true
+				genres[bookID] = append(genres[bookID], genre)
+			}
+		}
+	}
+
+	return genres, nil
+}
+
+// fillExportDetails fills the tags, genres, location, series and acquisition of the books with a few queries over the
+// whole catalog, instead of several queries per book.
+func fillExportDetails(db *sql.DB, books []BookInfo) error {
+	tags, err := getAllBookTags(db)
+	if err != nil {
+		return err
+	}
+
+	genres, err := getAllBookGenres(db)
+	if err != nil {
+		return err
+	}
+
+	locations, err := getLocationTree(db, 0)
+	if err != nil {
+		return err
+	}
+
+	paths := map[int]string{}
+	for _, location := range locations {
+		paths[location.ID] = location.Path
+	}
+
+	rows, err := db.Query(`SELECT b.id, b.location_id, COALESCE(s.name, ''), COALESCE(s.slug, ''), b.series_position,
+			b.purchased_on, b.purchase_price, b.currency, b.store, b.gift_from
+		FROM books b
+		LEFT JOIN series s ON s.id = b.series_id
+		WHERE b.deleted_at IS NULL`)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	byID := map[int]*BookInfo{}
+	for i := range books {
+		books[i].Tags = tags[books[i].ID]
+		books[i].Genres = genres[books[i].ID]
+		byID[books[i].ID] = &books[i]
+	}
+
+	for rows.Next() {
+		var bookID int
+		var locationID sql.NullInt64
+		var series, seriesSlug string
+		var position, price sql.NullFloat64
+		var purchasedOn sql.NullTime
+		var currency, store, giftFrom sql.NullString
+		if err := rows.Scan(&bookID, &locationID, &series, &seriesSlug, &position,
+			&purchasedOn, &price, &currency, &store, &giftFrom); err != nil {
+			return err
+		}
+
+		book, ok := byID[bookID]
+		if !ok {
+			continue
+		}
+
+		if locationID.Valid {
+			book.LocationID = int(locationID.Int64)
+			book.Location = paths[book.LocationID]
+		}
+		if series != "" {
+			book.Series = series
+			book.SeriesSlug = seriesSlug
+			book.SeriesPosition = SeriesPosition(position.Float64)
+		}
+		book.PurchasedOn = formatOptionalDate(purchasedOn)
+		book.PurchasePrice = Price(price.Float64)
+		book.Currency = currency.String
+		book.Store = store.String
+		book.GiftFrom = giftFrom.String
+	}
+
+	return rows.Err()
+}
+
+// getExportBooks returns the catalog in the order the books were added, leaving out the books in the trash.
+// saveImage receives every image with the name used for it in imageNames: the name of the file it was imported from,
+// or one made from its content when it has none or another image already took it. saveImage can be nil when the
+// images are not wanted.
+func getExportBooks(db *sql.DB, saveImage func(name string, image []byte) error) ([]exportBook, error) {
+	books, err := getBooksWithoutImages(db)
+	if err != nil {
+		return []exportBook{}, err
+	}
+
+	likes, err := getLikesCounts(db)
+	if err != nil {
+		return []exportBook{}, err
+	}
+
+	if err := fillExportDetails(db, books); err != nil {
+		return []exportBook{}, err
+	}
+
+	exportedBooks := []exportBook{}
+	usedNames := map[string]bool{}
+	for _, book := range books {
+		images, err := getBookImageData(db, book.ID)
+		if err != nil {
+			return []exportBook{}, err
+		}
+
+		exported := exportBookFromInfo(book)
+		exported.Likes = likes[book.ID]
+		for _, image := range images {
+			name := image.FileName
+			if name == "" || usedNames[name] {
+				name = exportImageName(image.Data)
+			}
+			usedNames[name] = true
+			exported.ImageNames = append(exported.ImageNames, name)
+
+			if saveImage != nil {
+				if err := saveImage(name, image.Data); err != nil {
+					return []exportBook{}, err
+				}
+			}
+		}
+
+		exportedBooks = append(exportedBooks, exported)
+	}
+
+	return exportedBooks, nil
+}
+
+// encodeLibrary writes the books in the format of library/books_db.toml.
+func encodeLibrary(out io.Writer, books []exportBook) error {
+	// Without indentation, like the hand-written books_db.toml.
+	encoder := toml.NewEncoder(out)
+	encoder.Indent = ""
+
+	return encoder.Encode(exportLibrary{Book: books})
+}
+
+// ExportLibrary writes the catalog to out in the format of library/books_db.toml; saveImage is as in getExportBooks.
+func ExportLibrary(db *sql.DB, out io.Writer, saveImage func(name string, image []byte) error) error {
+	books, err := getExportBooks(db, saveImage)
+	if err != nil {
+		return err
+	}
+
+	return encodeLibrary(out, books)
+}
+
+// ExportLibraryZip writes a zip with the same layout as the repository: library/books_db.toml and the images in
+// images/. The images are written as they are read, so the archive is never held in memory.
+func ExportLibraryZip(db *sql.DB, out io.Writer) error {
+	archive := zip.NewWriter(out)
+
+	books, err := getExportBooks(db, func(name string, image []byte) error {
+		file, err := archive.Create(path.Join(libraryImagesDir, name))
+		if err != nil {
+			return err
+		}
+
+		_, err = file.Write(image)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	file, err := archive.Create(libraryFilePath)
+	if err != nil {
+		return err
+	}
+
+	if err := encodeLibrary(file, books); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+// startedWriter records whether anything was written, after which an error can no longer change the response.
+type startedWriter struct {
+	w       io.Writer
+	started bool
+}
+
+func (s *startedWriter) Write(p []byte) (int, error) {
+	s.started = true
+	return s.w.Write(p)
+}
+
+// ExportTOML returns the catalog as books_db.toml, without the images.
+func ExportTOML(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can export the library", http.StatusForbidden)
+		return
+	}
+
+	books, err := getExportBooks(db, nil)
+	if err != nil {
+		log.Printf("error exporting the library: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/toml; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="books_db.toml"`)
+	if err := encodeLibrary(w, books); err != nil {
+		log.Printf("error writing the library: %v", err)
+	}
+}
+
+// ExportZip returns the catalog and its images in a zip that can be unpacked over the repository.
+func ExportZip(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can export the library", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="leonlib.zip"`)
+
+	out := &startedWriter{w: w}
+	if err := ExportLibraryZip(db, out); err != nil {
+		log.Printf("error exporting the library: %v", err)
+		if !out.started {
+			w.Header().Del("Content-Disposition")
+			http.Error(w, "Database error", http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,901 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/gorilla/mux"
+)
+
+const (
+	libraryFilePath  = "library/books_db.toml"
+	libraryImagesDir = "images"
+
+	// maxImportJobs is how many imports are kept in memory to be queried once finished.
+	maxImportJobs = 10
+)
+
+type ImportOutcome string
+
+const (
+	ImportCreated ImportOutcome = "created"
+	ImportUpdated ImportOutcome = "updated"
+	ImportSkipped ImportOutcome = "skipped"
+	ImportFailed  ImportOutcome = "failed"
+)
+
+type ImportJobStatus string
+
+const (
+	ImportRunning  ImportJobStatus = "running"
+	ImportFinished ImportJobStatus = "finished"
+	ImportAborted  ImportJobStatus = "aborted"
+)
+
+var errImportRunning = errors.New("an import is already running")
+
+// ImportEntry is what happened to one book of the file. Index is its position in the file, starting at 1; for a CSV
+// file it is the row of the spreadsheet, the header being row 1.
+type ImportEntry struct {
+	Index   int           `json:"index"`
+	Title   string        `json:"title"`
+	Author  string        `json:"author"`
+	BookID  int           `json:"book_id,omitempty"`
+	Outcome ImportOutcome `json:"outcome"`
+	Reason  string        `json:"reason,omitempty"`
+}
+
+type ImportReport struct {
+	DryRun  bool          `json:"dry_run"`
+	Created []ImportEntry `json:"created"`
+	Updated []ImportEntry `json:"updated"`
+	Skipped []ImportEntry `json:"skipped"`
+	Failed  []ImportEntry `json:"failed"`
+}
+
+func newImportReport(dryRun bool) ImportReport {
+	return ImportReport{
+		DryRun:  dryRun,
+		Created: []ImportEntry{},
+		Updated: []ImportEntry{},
+		Skipped: []ImportEntry{},
+		Failed:  []ImportEntry{},
+	}
+}
+
+func (ir *ImportReport) add(entry ImportEntry) {
+	switch entry.Outcome {
+	case ImportCreated:
+		ir.Created = append(ir.Created, entry)
+	case ImportUpdated:
+		ir.Updated = append(ir.Updated, entry)
+	case ImportSkipped:
+		ir.Skipped = append(ir.Skipped, entry)
+	default:
+		ir.Failed = append(ir.Failed, entry)
+	}
+}
+
+// ImportJob is an import running in the background. The report is filled when the import finishes; until then
+// Processed tells how far it is.
+type ImportJob struct {
+	ID         string          `json:"id"`
+	Status     ImportJobStatus `json:"status"`
+	DryRun     bool            `json:"dry_run"`
+	Total      int             `json:"total"`
+	Processed  int             `json:"processed"`
+	StartedAt  time.Time       `json:"started_at"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Report     *ImportReport   `json:"report,omitempty"`
+}
+
+var importJobs = struct {
+	sync.Mutex
+	jobs  map[string]*ImportJob
+	order []string
+}{jobs: map[string]*ImportJob{}}
+
+// startImportJob registers a new job; only one import can run at a time.
+func startImportJob(total int, dryRun bool) (ImportJob, error) {
+	importJobs.Lock()
+	defer importJobs.Unlock()
+
+	for _, job := range importJobs.jobs {
+		if job.Status == ImportRunning {
+			return ImportJob{}, errImportRunning
+		}
+	}
+
+	job := &ImportJob{
+		ID:        generateRandomString(12),
+		Status:    ImportRunning,
+		DryRun:    dryRun,
+		Total:     total,
+		StartedAt: time.Now(),
+	}
+	importJobs.jobs[job.ID] = job
+	importJobs.order = append(importJobs.order, job.ID)
+
+	for len(importJobs.order) > maxImportJobs {
+		delete(importJobs.jobs, importJobs.order[0])
+		importJobs.order = importJobs.order[1:]
+	}
+
+	return *job, nil
+}
+
+func getImportJob(id string) (ImportJob, bool) {
+	importJobs.Lock()
+	defer importJobs.Unlock()
+
+	job, ok := importJobs.jobs[id]
+	if !ok {
+		return ImportJob{}, false
+	}
+
+	return *job, true
+}
+
+func updateImportJob(id string, update func(job *ImportJob)) {
+	importJobs.Lock()
+	defer importJobs.Unlock()
+
+	if job, ok := importJobs.jobs[id]; ok {
+		update(job)
+	}
+}
+
+// importRow is a book read from the file, or the error that kept it from being read. Fields holds the catalog fields
+// the file has for the book, as named in catalogFields; nil means all of them. ImagesDir is the directory its images
+// are read from when it is not the one of the whole import.
+type importRow struct {
+	Index     int
+	Book      BookInfo
+	Fields    map[string]bool
+	ImagesDir string
+	Err       error
+}
+
+// importRowsFromLibrary takes the fields of each book from the keys written for it in books_db.toml; keys holds
+// the same books decoded as plain tables.
+func importRowsFromLibrary(library Library, keys []map[string]interface{}) []importRow {
+	rows := make([]importRow, 0, len(library.Book))
+	for i, book := range library.Book {
+		row := importRow{Index: i + 1, Book: book}
+		if i < len(keys) {
+			row.Fields = map[string]bool{}
+			for key := range keys[i] {
+				field := ColumnMapping{}.field(key)
+				if strings.EqualFold(key, "hasBeenRead") {
+					field = "readingStatus"
+				}
+				row.Fields[field] = true
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+// decodeLibrary reads books_db.toml with the keys each book has.
+func decodeLibrary(data string) ([]importRow, error) {
+	var library Library
+	if _, err := toml.Decode(data, &library); err != nil {
+		return []importRow{}, err
+	}
+
+	var keys struct {
+		Book []map[string]interface{}
+	}
+	if _, err := toml.Decode(data, &keys); err != nil {
+		return []importRow{}, err
+	}
+
+	return importRowsFromLibrary(library, keys.Book), nil
+}
+
+// importCandidate is a book of the file once its fields have been validated and normalized.
+type importCandidate struct {
+	Index     int
+	Book      BookInfo
+	Fields    map[string]bool
+	ImagesDir string
+}
+
+// has tells whether the file has the field, so it is applied to a book already in the database.
+func (ic importCandidate) has(fields ...string) bool {
+	if ic.Fields == nil {
+		return true
+	}
+
+	for _, field := range fields {
+		if ic.Fields[field] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (ic importCandidate) entry(outcome ImportOutcome, bookID int, reason string) ImportEntry {
+	return ImportEntry{
+		Index:   ic.Index,
+		Title:   ic.Book.Title,
+		Author:  ic.Book.Author,
+		BookID:  bookID,
+		Outcome: outcome,
+		Reason:  reason,
+	}
+}
+
+// validateImportBook checks every field of the book and that its images can be read, so nothing is written for a
+// book that would fail half-way.
+func validateImportBook(db *sql.DB, row importRow, imagesDir string) (importCandidate, error) {
+	book := row.Book
+	candidate := importCandidate{Index: row.Index, Book: book, Fields: row.Fields, ImagesDir: imagesDir}
+	if row.ImagesDir != "" {
+		candidate.ImagesDir = row.ImagesDir
+	}
+	if book.Title == "" || book.Author == "" {
+		return candidate, errors.New("title and author are required")
+	}
+
+	status, err := resolveReadingStatus(string(book.ReadingStatus), book.HasBeenRead)
+	if err != nil {
+		return candidate, err
+	}
+
+	startedOn, err := parseOptionalDate(book.StartedOn)
+	if err != nil {
+		return candidate, err
+	}
+
+	finishedOn, err := parseOptionalDate(book.FinishedOn)
+	if err != nil {
+		return candidate, err
+	}
+
+	isbns, err := resolveBookISBN(book.ISBN13, book.ISBN10)
+	if err != nil {
+		return candidate, err
+	}
+
+	format, err := parseBookFormat(book.Format)
+	if err != nil {
+		return candidate, err
+	}
+
+	language, err := parseLanguage(book.Language)
+	if err != nil {
+		return candidate, err
+	}
+
+	acquisition, err := acquisitionFromBook(book)
+	if err != nil {
+		return candidate, err
+	}
+
+	location, err := parseLocationPath(book.Location)
+	if err != nil {
+		return candidate, err
+	}
+
+	if candidate.Book.Genres, err = resolveImportGenres(db, book.Genres); err != nil {
+		return candidate, err
+	}
+
+	if book.Series == "" && book.SeriesPosition != 0 {
+		return candidate, errors.New("seriesPosition requires a series")
+	}
+
+	if err := checkImportImages(candidate.ImagesDir, book.ImageNames); err != nil {
+		return candidate, err
+	}
+
+	if candidate.Book.Author, err = resolveAuthorAliases(db, book.Author); err != nil {
+		return candidate, err
+	}
+
+	if candidate.Book.Translator, err = resolveAuthorAliases(db, book.Translator); err != nil {
+		return candidate, err
+	}
+
+	// The normalized values are the ones compared with the books already in the database and written.
+	candidate.Book.ISBN10 = isbns.ISBN10.String
+	candidate.Book.ISBN13 = isbns.ISBN13.String
+	candidate.Book.Format = format.String
+	candidate.Book.Language = language.String
+	candidate.Book.Publisher = nullableString(book.Publisher).String
+	candidate.Book.Translator = nullableString(candidate.Book.Translator).String
+	candidate.Book.ReadingStatus = status
+	candidate.Book.StartedOn = formatOptionalDate(startedOn)
+	candidate.Book.FinishedOn = formatOptionalDate(finishedOn)
+	candidate.Book.PurchasedOn = formatOptionalDate(acquisition.PurchasedOn)
+	candidate.Book.PurchasePrice = Price(acquisition.Price.Float64)
+	candidate.Book.Currency = acquisition.Currency.String
+	candidate.Book.Store = acquisition.Store.String
+	candidate.Book.GiftFrom = acquisition.GiftFrom.String
+	candidate.Book.Location = strings.Join(location, " > ")
+
+	return candidate, nil
+}
+
+// checkImportImages checks the images are files of imagesDir. The names come from the uploaded file: a path could
+// read any file of the server into the public images.
+func checkImportImages(imagesDir string, imageNames []string) error {
+	for _, imageName := range imageNames {
+		if !filepath.IsLocal(imageName) || filepath.Base(imageName) != imageName {
+			return fmt.Errorf("invalid image name %q", imageName)
+		}
+
+		info, err := os.Stat(filepath.Join(imagesDir, imageName))
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("image %s is not a file", imageName)
+		}
+	}
+
+	return nil
+}
+
+// resolveImportGenres looks up the genres of the file by slug. The taxonomy is curated, so unknown genres are an
+// error instead of being created.
+func resolveImportGenres(db *sql.DB, genres []Genre) ([]Genre, error) {
+	var resolved []Genre
+	seen := map[string]bool{}
+	for _, genre := range genres {
+		if seen[genre.Slug] {
+			continue
+		}
+		seen[genre.Slug] = true
+
+		err := db.QueryRow("SELECT id, name FROM genres WHERE slug = $1", genre.Slug).Scan(&genre.ID, &genre.Name)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("unknown genre %q", genre.Slug)
+		}
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, genre)
+	}
+
+	return resolved, nil
+}
+
+func sameGenres(a, b []Genre) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	slugs := map[string]bool{}
+	for _, genre := range a {
+		slugs[genre.Slug] = true
+	}
+	for _, genre := range b {
+		if !slugs[genre.Slug] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// importedBook is the existing book with the fields the file has applied; the fields the file does not have keep
+// their value.
+func importedBook(existing BookInfo, candidate importCandidate) BookInfo {
+	book := existing
+	from := candidate.Book
+	book.Title = from.Title
+	book.Author = from.Author
+	if candidate.has("description") {
+		book.Description = from.Description
+	}
+	if candidate.has("isbn10", "isbn13") {
+		book.ISBN10 = from.ISBN10
+		book.ISBN13 = from.ISBN13
+	}
+	if candidate.has("publisher") {
+		book.Publisher = from.Publisher
+	}
+	if candidate.has("publishedYear") {
+		book.PublishedYear = from.PublishedYear
+	}
+	if candidate.has("pageCount") {
+		book.PageCount = from.PageCount
+	}
+	if candidate.has("translator") {
+		book.Translator = from.Translator
+	}
+	if candidate.has("format") {
+		book.Format = from.Format
+	}
+	if candidate.has("language") {
+		book.Language = from.Language
+	}
+	if candidate.has("readingStatus") {
+		book.ReadingStatus = from.ReadingStatus
+	}
+	if candidate.has("startedOn") {
+		book.StartedOn = from.StartedOn
+	}
+	if candidate.has("finishedOn") {
+		book.FinishedOn = from.FinishedOn
+	}
+	if candidate.has("goodreadsLink") {
+		book.GoodreadsLink = from.GoodreadsLink
+	}
+	if candidate.has("series") {
+		book.Series = from.Series
+	}
+	if candidate.has("seriesPosition") {
+		book.SeriesPosition = from.SeriesPosition
+	}
+	if candidate.has("purchasedOn") {
+		book.PurchasedOn = from.PurchasedOn
+	}
+	if candidate.has("purchasePrice") {
+		book.PurchasePrice = from.PurchasePrice
+	}
+	if candidate.has("currency") {
+		book.Currency = from.Currency
+	}
+	if candidate.has("store") {
+		book.Store = from.Store
+	}
+	if candidate.has("giftFrom") {
+		book.GiftFrom = from.GiftFrom
+	}
+
+	if candidate.has("tags") {
+		// Tags keep the name already stored for their slug, and the order they are read back in.
+		storedNames := map[string]string{}
+		for _, tag := range existing.Tags {
+			storedNames[tag.Slug] = tag.Name
+		}
+		book.Tags = []Tag{}
+		for _, tag := range from.Tags {
+			if name, ok := storedNames[tag.Slug]; ok {
+				tag.Name = name
+			}
+			book.Tags = append(book.Tags, tag)
+		}
+		sort.Slice(book.Tags, func(i, j int) bool {
+			return book.Tags[i].Slug < book.Tags[j].Slug
+		})
+	}
+
+	if candidate.has("genres") && !sameGenres(existing.Genres, from.Genres) {
+		book.Genres = from.Genres
+	}
+
+	if candidate.has("location") && !strings.EqualFold(existing.Location, from.Location) {
+		book.Location = from.Location
+	}
+
+	return book
+}
+
+// writeImportedBook inserts the book when bookID is 0 and updates it otherwise, returning its id. The book holds the
+// normalized values of validateImportBook, merged by importedBook for the books already in the database.
+func writeImportedBook(tx *sql.Tx, bookID int, book BookInfo, workID int) (int, error) {
+	startedOn, err := parseOptionalDate(book.StartedOn)
+	if err != nil {
+		return 0, err
+	}
+
+	finishedOn, err := parseOptionalDate(book.FinishedOn)
+	if err != nil {
+		return 0, err
+	}
+
+	acquisition, err := acquisitionFromBook(book)
+	if err != nil {
+		return 0, err
+	}
+
+	location, err := parseLocationPath(book.Location)
+	if err != nil {
+		return 0, err
+	}
+
+	if bookID == 0 {
+		err := tx.QueryRow(`INSERT INTO books(work_id, title, author, description, isbn_10, isbn_13, publisher,
+				published_year, page_count, translator, format, language, reading_status, started_on, finished_on,
+				added_on, goodreads_link)
+			VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15,
+				COALESCE(NULLIF($16, '')::TIMESTAMP, CURRENT_TIMESTAMP), $17) RETURNING id`,
+			workID, book.Title, book.Author, book.Description, nullableString(book.ISBN10), nullableString(book.ISBN13),
+			nullableString(book.Publisher), nullableInt(book.PublishedYear), nullableInt(book.PageCount),
+			nullableString(book.Translator), nullableString(book.Format), nullableString(book.Language),
+			book.ReadingStatus, startedOn, finishedOn, book.AddedOn, book.GoodreadsLink).Scan(&bookID)
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		_, err := tx.Exec(`UPDATE books SET work_id = $1, title = $2, author = $3, description = $4, isbn_10 = $5,
+				isbn_13 = $6, publisher = $7, published_year = $8, page_count = $9, translator = $10, format = $11,
+				language = $12, reading_status = $13, started_on = $14, finished_on = $15, goodreads_link = $16
+			WHERE id = $17`,
+			workID, book.Title, book.Author, book.Description, nullableString(book.ISBN10), nullableString(book.ISBN13),
+			nullableString(book.Publisher), nullableInt(book.PublishedYear), nullableInt(book.PageCount),
+			nullableString(book.Translator), nullableString(book.Format), nullableString(book.Language),
+			book.ReadingStatus, startedOn, finishedOn, book.GoodreadsLink, bookID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err := replaceAuthorAndTranslatorCredits(tx, bookID, book.Author, book.Translator); err != nil {
+		return 0, err
+	}
+
+	if err := replaceBookTags(tx, bookID, book.Tags); err != nil {
+		return 0, err
+	}
+
+	position := sql.NullFloat64{Float64: float64(book.SeriesPosition), Valid: book.SeriesPosition != 0}
+	if err := setBookSeries(tx, bookID, book.Series, position); err != nil {
+		return 0, err
+	}
+
+	if err := setBookAcquisition(tx, bookID, acquisition); err != nil {
+		return 0, err
+	}
+
+	var genreIDs []int
+	for _, genre := range book.Genres {
+		genreIDs = append(genreIDs, genre.ID)
+	}
+	if err := replaceBookGenres(tx, bookID, genreIDs); err != nil {
+		return 0, err
+	}
+
+	var locationID sql.NullInt64
+	if len(location) > 0 {
+		id, err := findOrCreateLocationPath(tx, location)
+		if err != nil {
+			return 0, err
+		}
+		locationID = sql.NullInt64{Int64: int64(id), Valid: true}
+	}
+	if err := setBookLocation(tx, bookID, locationID); err != nil {
+		return 0, err
+	}
+
+	return bookID, nil
+}
+
+func insertImportImages(tx *sql.Tx, bookID int, imagesDir string, imageNames []string) error {
+	for _, imageName := range imageNames {
+		image, err := os.ReadFile(filepath.Join(imagesDir, imageName))
+		if err != nil {
+			return err
+		}
+
+		if err := insertBookImage(tx, bookID, image, imageName); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// findImportMatch returns the book the candidate stands for: a duplicate that no earlier book of the file took,
+// preferring the one with the same description, as some editions are only told apart by it.
+func findImportMatch(books []BookInfo, candidate BookInfo, claimed map[int]bool) (BookInfo, bool) {
+	var match BookInfo
+	found := false
+	for _, book := range books {
+		if claimed[book.ID] {
+			continue
+		}
+		if _, ok := duplicateReason(book, candidate); !ok {
+			continue
+		}
+
+		if book.Description == candidate.Description {
+			return book, true
+		}
+		if !found {
+			match, found = book, true
+		}
+	}
+
+	return match, found
+}
+
+// findDuplicateRow returns the earlier row of the file that is the same book as the candidate.
+func findDuplicateRow(candidates []importCandidate, candidate importCandidate) (importCandidate, bool) {
+	for _, earlier := range candidates {
+		if _, ok := duplicateReason(earlier.Book, candidate.Book); ok {
+			return earlier, true
+		}
+	}
+
+	return importCandidate{}, false
+}
+
+// importOneBook writes one book inside its own savepoint, so a failure only undoes that book.
+func importOneBook(tx *sql.Tx, actor sql.NullString, candidate importCandidate, existing []BookInfo,
+	claimed map[int]bool) (ImportEntry, error) {
+	var before BookInfo
+	bookID := 0
+	if match, found := findImportMatch(existing, candidate.Book, claimed); found {
+		var err error
+		if before, err = getBookDetails(tx, match.ID); err != nil {
+			return ImportEntry{}, err
+		}
+		bookID = match.ID
+	}
+
+	after := candidate.Book
+	addImages := len(candidate.Book.ImageNames) > 0
+	if bookID != 0 {
+		after = importedBook(before, candidate)
+		// Images are only added to the books that have none, so running the import again does not repeat them.
+		addImages = addImages && len(before.Base64Images) == 0
+		if addImages {
+			after.ImageNames = candidate.Book.ImageNames
+		}
+
+		if !addImages && auditDiffIsEmpty(auditBookFromInfo(before), auditBookFromInfo(after)) {
+			return candidate.entry(ImportSkipped, bookID, "unchanged"), nil
+		}
+	}
+
+	if _, err := tx.Exec("SAVEPOINT import_book"); err != nil {
+		return ImportEntry{}, err
+	}
+
+	fail := func(err error) (ImportEntry, error) {
+		if _, rollbackErr := tx.Exec("ROLLBACK TO SAVEPOINT import_book"); rollbackErr != nil {
+			return ImportEntry{}, rollbackErr
+		}
+
+		return candidate.entry(ImportFailed, bookID, err.Error()), nil
+	}
+
+	workID := before.WorkID
+	if bookID == 0 || before.Title != after.Title || before.Author != after.Author {
+		var err error
+		if workID, err = findOrCreateWork(tx, after.Title, after.Author); err != nil {
+			return fail(err)
+		}
+	}
+
+	writtenID, err := writeImportedBook(tx, bookID, after, workID)
+	if err != nil {
+		return fail(err)
+	}
+
+	if addImages {
+		if err := insertImportImages(tx, writtenID, candidate.ImagesDir, candidate.Book.ImageNames); err != nil {
+			return fail(err)
+		}
+	}
+
+	if bookID == 0 {
+		recordAuditAs(tx, actor, AuditImport, AuditBook, writtenID, nil, auditBookFromInfo(after))
+	} else if err := recordBookEditIn(tx, actor, AuditImport, before, 0); err != nil {
+		return fail(err)
+	}
+
+	if _, err := tx.Exec("RELEASE SAVEPOINT import_book"); err != nil {
+		return ImportEntry{}, err
+	}
+
+	if bookID != 0 {
+		return candidate.entry(ImportUpdated, writtenID, ""), nil
+	}
+
+	return candidate.entry(ImportCreated, writtenID, ""), nil
+}
+
+func auditDiffIsEmpty(before, after auditBook) bool {
+	changes, err := auditDiff(before, after)
+
+	return err == nil && len(changes) == 0
+}
+
+// importLibrary upserts the books of the library in a single transaction. Each book is matched with the books already
+// in the database by ISBN, or by title and author when the edition details do not tell them apart, so running the
+// same file twice does not duplicate the library. With dryRun the transaction is rolled back and the report tells
+// what the import would do. actor is the user the changes are recorded for in the audit log. progress is called after
+// each book.
+func importLibrary(db *sql.DB, actor sql.NullString, rows []importRow, imagesDir string, dryRun bool, progress func(processed int)) (ImportReport, error) {
+	report := newImportReport(dryRun)
+
+	// Everything is checked before the first write.
+	var candidates []importCandidate
+	for _, row := range rows {
+		if row.Err != nil {
+			report.add(importCandidate{Index: row.Index, Book: row.Book}.entry(ImportFailed, 0, row.Err.Error()))
+			continue
+		}
+
+		candidate, err := validateImportBook(db, row, imagesDir)
+		if err != nil {
+			report.add(candidate.entry(ImportFailed, 0, err.Error()))
+			continue
+		}
+
+		// The rows of the file are not in existing yet, so a book repeated in the file would be added twice.
+		if earlier, found := findDuplicateRow(candidates, candidate); found {
+			report.add(candidate.entry(ImportFailed, 0, fmt.Sprintf("duplicate of row %d", earlier.Index)))
+			continue
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	existing, err := getBooksWithoutImages(db)
+	if err != nil {
+		return ImportReport{}, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return ImportReport{}, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	// Each book of the database stands for one book of the file at most.
+	claimed := map[int]bool{}
+	processed := len(rows) - len(candidates)
+	progress(processed)
+
+	for _, candidate := range candidates {
+		entry, err := importOneBook(tx, actor, candidate, existing, claimed)
+		if err != nil {
+			return ImportReport{}, err
+		}
+		if entry.BookID != 0 {
+			claimed[entry.BookID] = true
+		}
+		report.add(entry)
+
+		processed++
+		progress(processed)
+	}
+
+	if err := deleteOrphanWorks(tx); err != nil {
+		return ImportReport{}, err
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	return report, tx.Commit()
+}
+
+// CreateDBFromFile imports library/books_db.toml in the background and answers right away with the job, which can
+// be followed at /api/imports/{job_id}. With dry_run=true nothing is saved.
+func CreateDBFromFile(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can import the library", http.StatusForbidden)
+		return
+	}
+
+	dryRun, err := parseDryRun(r)
+	if err != nil {
+		http.Error(w, "invalid dry_run", http.StatusBadRequest)
+		return
+	}
+
+	data, err := os.ReadFile(libraryFilePath)
+	if err != nil {
+		writeErrorGeneralStatus(w, err)
+		return
+	}
+
+	rows, err := decodeLibrary(string(data))
+	if err != nil {
+		writeErrorGeneralStatus(w, err)
+		return
+	}
+
+	job, err := runImportJob(db, auditActor(r), rows, dryRun)
+	writeImportJob(w, job, err)
+}
+
+func parseDryRun(r *http.Request) (bool, error) {
+	input := r.FormValue("dry_run")
+	if input == "" {
+		return false, nil
+	}
+
+	return strconv.ParseBool(input)
+}
+
+// runImportJob imports the rows in the background; the job it returns can be followed at /api/imports/{job_id}.
+// Everything the import needs from the request is passed in, since the request is done before the import.
+func runImportJob(db *sql.DB, actor sql.NullString, rows []importRow, dryRun bool) (ImportJob, error) {
+	job, err := startImportJob(len(rows), dryRun)
+	if err != nil {
+		return ImportJob{}, err
+	}
+
+	go func() {
+		startTime := time.Now()
+
+		report, err := importLibrary(db, actor, rows, libraryImagesDir, dryRun, func(processed int) {
+			updateImportJob(job.ID, func(job *ImportJob) {
+				job.Processed = processed
+			})
+		})
+
+		finishedAt := time.Now()
+		updateImportJob(job.ID, func(job *ImportJob) {
+			job.FinishedAt = &finishedAt
+			if err != nil {
+				job.Status = ImportAborted
+				job.Error = err.Error()
+				return
+			}
+			job.Status = ImportFinished
+			job.Report = &report
+		})
+
+		if err != nil {
+			log.Printf("error importing the library: %v", err)
+			return
+		}
+
+		log.Printf("Books imported in: %.2f seconds (created=%d, updated=%d, skipped=%d, failed=%d, dry_run=%t)\n",
+			time.Since(startTime).Seconds(), len(report.Created), len(report.Updated), len(report.Skipped),
+			len(report.Failed), dryRun)
+	}()
+
+	return job, nil
+}
+
+func writeImportJob(w http.ResponseWriter, job ImportJob, err error) {
+	if errors.Is(err, errImportRunning) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeErrorGeneralStatus(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/imports/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(job)
+}
+
+// ImportStatus returns the progress of an import, and its report once it finished.
+func ImportStatus(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can see the imports", http.StatusForbidden)
+		return
+	}
+
+	job, ok := getImportJob(mux.Vars(r)["job_id"])
+	if !ok {
+		http.Error(w, "Import not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(job)
+}
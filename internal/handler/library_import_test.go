@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestImportedBook(t *testing.T) {
+	existing := BookInfo{
+		ID:            7,
+		Title:         "Pedro Páramo",
+		Author:        "Juan Rulfo",
+		Description:   "Primera edición de bolsillo",
+		ISBN13:        "9788437604183",
+		Publisher:     "Cátedra",
+		PageCount:     128,
+		ReadingStatus: Read,
+		FinishedOn:    "2023-01-15",
+		Series:        "Clásicos",
+		PurchasePrice: 199,
+		Currency:      "MXN",
+		Tags:          []Tag{{Name: "México", Slug: "mexico"}},
+		Location:      "Estudio > Librero blanco",
+	}
+
+	candidate := importCandidate{
+		Book: BookInfo{
+			Title:         "Pedro Páramo",
+			Author:        "Juan Rulfo",
+			PageCount:     136,
+			ReadingStatus: ToRead,
+			Tags:          []Tag{{Name: "mexico", Slug: "mexico"}, {Name: "Novela", Slug: "novela"}},
+		},
+		Fields: map[string]bool{"title": true, "author": true, "pageCount": true, "tags": true},
+	}
+
+	got := importedBook(existing, candidate)
+
+	want := existing
+	want.PageCount = 136
+	want.Tags = []Tag{{Name: "México", Slug: "mexico"}, {Name: "Novela", Slug: "novela"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("importedBook() with some fields =\n%+v\nwant\n%+v", got, want)
+	}
+
+	candidate.Fields = nil
+	got = importedBook(existing, candidate)
+	if got.Description != "" || got.ISBN13 != "" || got.ReadingStatus != ToRead || got.PurchasePrice != 0 || got.Location != "" {
+		t.Errorf("importedBook() with every field should take the values of the file, got %+v", got)
+	}
+}
+
+func TestDecodeLibrary(t *testing.T) {
+	rows, err := decodeLibrary(`
+[[book]]
+title = "Pedro Páramo"
+author = "Juan Rulfo"
+hasBeenRead = true
+ISBN13 = "9788437604183"
+
+[[book]]
+title = "El llano en llamas"
+author = "Juan Rulfo"
+genres = [ "cuento" ]
+location = "Estudio > Librero blanco"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []map[string]bool{
+		{"title": true, "author": true, "readingStatus": true, "isbn13": true},
+		{"title": true, "author": true, "genres": true, "location": true},
+	}
+
+	if len(rows) != len(tests) {
+		t.Fatalf("decodeLibrary() returned %d rows, want %d", len(rows), len(tests))
+	}
+
+	for i, want := range tests {
+		if !reflect.DeepEqual(rows[i].Fields, want) {
+			t.Errorf("row %d fields = %v, want %v", rows[i].Index, rows[i].Fields, want)
+		}
+	}
+
+	if genres := rows[1].Book.Genres; len(genres) != 1 || genres[0].Slug != "cuento" {
+		t.Errorf("genres = %+v, want the cuento slug", genres)
+	}
+}
+
+func TestCheckImportImages(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "cover.jpg"), []byte("jpeg"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "covers"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkImportImages(dir, []string{"cover.jpg"}); err != nil {
+		t.Errorf("checkImportImages(cover.jpg) = %v", err)
+	}
+
+	for _, name := range []string{"../.env", "../../proc/self/environ", "/etc/passwd", "covers/../cover.jpg", "covers", "missing.jpg", ""} {
+		if err := checkImportImages(dir, []string{name}); err == nil {
+			t.Errorf("checkImportImages(%q) accepted the name", name)
+		}
+	}
+}
+
+func TestFindDuplicateRow(t *testing.T) {
+	candidates := []importCandidate{
+		{Index: 1, Book: BookInfo{Title: "Pedro Páramo", Author: "Juan Rulfo", Format: "paperback"}},
+		{Index: 2, Book: BookInfo{Title: "Aura", Author: "Carlos Fuentes", ISBN13: "9789684110010"}},
+	}
+
+	tests := []struct {
+		book BookInfo
+		want int
+	}{
+		{BookInfo{Title: "pedro paramo", Author: "Rulfo, Juan"}, 1},
+		{BookInfo{Title: "Aura (edición de bolsillo)", Author: "Fuentes", ISBN13: "9789684110010"}, 2},
+		{BookInfo{Title: "Pedro Páramo", Author: "Juan Rulfo", Format: "hardcover"}, 0},
+		{BookInfo{Title: "El llano en llamas", Author: "Juan Rulfo"}, 0},
+	}
+
+	for _, tt := range tests {
+		earlier, found := findDuplicateRow(candidates, importCandidate{Index: 3, Book: tt.book})
+		if tt.want == 0 && found {
+			t.Errorf("findDuplicateRow(%q) = row %d, want none", tt.book.Title, earlier.Index)
+		}
+		if tt.want != 0 && (!found || earlier.Index != tt.want) {
+			t.Errorf("findDuplicateRow(%q) = row %d (%v), want row %d", tt.book.Title, earlier.Index, found, tt.want)
+		}
+	}
+}
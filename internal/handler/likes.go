@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"leonlib/internal/captcha"
+)
+
+// likedBooksSortColumns maps the "sort" query parameter to the column used in the ORDER BY clause.
+var likedBooksSortColumns = map[string]string{
+	"liked_on": "l.created_at",
+	"title":    "b.title",
+	"author":   "b.author",
+}
+
+type LikedBook struct {
+	Book    BookInfo
+	LikedOn time.Time
+}
+
+type PageLikedBooksVariables struct {
+	Year       string
+	SiteKey    string
+	Results    []LikedBook
+	Sort       string
+	Order      string
+	Pagination Pagination
+	LoggedIn   bool
+}
+
+func parseLikedBooksSort(input string) string {
+	if _, ok := likedBooksSortColumns[input]; ok {
+		return input
+	}
+
+	return "liked_on"
+}
+
+func countLikedBooksByUser(db *sql.DB, userID string) (int, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM book_likes l JOIN books b ON b.id = l.book_id WHERE l.user_id = $1 AND b.deleted_at IS NULL", userID).Scan(&count)
+
+	return count, err
+}
+
+func getLikedBooksByUser(db *sql.DB, userID, sort, order string, pagination Pagination) ([]LikedBook, error) {
+	queryStr := fmt.Sprintf(`SELECT `+bookColumns+`, l.created_at
+		FROM book_likes l
+		JOIN books b ON b.id = l.book_id
+		WHERE l.user_id = $1 AND b.deleted_at IS NULL
+		ORDER BY %s %s, b.id
+		LIMIT $2 OFFSET $3`, likedBooksSortColumns[sort], order)
+
+	rows, err := db.Query(queryStr, userID, pagination.PerPage, pagination.Offset())
+	if err != nil {
+		return []LikedBook{}, err
+	}
+
+	defer rows.Close()
+
+	var likedBooks []LikedBook
+	for rows.Next() {
+		var likedOn time.Time
+		bookInfo, err := scanBookInfo(rows, &likedOn)
+		if err != nil {
+			return []LikedBook{}, err
+		}
+
+		bookImages, err := getImagesByBookID(db, bookInfo.ID)
+		if err != nil {
+			return []LikedBook{}, err
+		}
+		bookInfo.Base64Images = bookImages
+
+		likedBooks = append(likedBooks, LikedBook{Book: bookInfo, LikedOn: likedOn})
+	}
+
+	return likedBooks, rows.Err()
+}
+
+func MyLikedBooksPage(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	userID, err := getCurrentUserID(r)
+	if err != nil {
+		log.Printf("(MyLikedBooksPage) User is not logged in: %v", err)
+		http.Redirect(w, r, "/ingresar", http.StatusSeeOther)
+		return
+	}
+
+	sort := parseLikedBooksSort(r.URL.Query().Get("sort"))
+	order := parseSortOrder(r.URL.Query().Get("order"))
+	pagination := parsePagination(r)
+
+	total, err := countLikedBooksByUser(db, userID)
+	if err != nil {
+		log.Printf("error counting liked books: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+	pagination.setTotal(total)
+
+	likedBooks, err := getLikedBooksByUser(db, userID, sort, order, pagination)
+	if err != nil {
+		log.Printf("error getting liked books: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	pageVariables := PageLikedBooksVariables{
+		Year:       now.Format("2006"),
+		SiteKey:    captcha.SiteKey,
+		Results:    likedBooks,
+		Sort:       sort,
+		Order:      order,
+		Pagination: pagination,
+		LoggedIn:   true,
+	}
+
+	templateDir := os.Getenv("TEMPLATE_DIR")
+	if templateDir == "" {
+		templateDir = "internal/template" // default value for local development
+	}
+	templatePath := filepath.Join(templateDir, "mis_libros.html")
+
+	t, err := template.ParseFiles(templatePath)
+	if err != nil {
+		log.Printf("template error: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "template error", http.StatusInternalServerError)
+		return
+	}
+
+	err = t.Execute(w, pageVariables)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("template error: %v", err)
+		return
+	}
+}
+
+func MyLikedBooks(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	userID, err := getCurrentUserID(r)
+	if err != nil {
+		writeUnauthenticated(w)
+		return
+	}
+
+	sort := parseLikedBooksSort(r.URL.Query().Get("sort"))
+	order := parseSortOrder(r.URL.Query().Get("order"))
+	pagination := parsePagination(r)
+
+	total, err := countLikedBooksByUser(db, userID)
+	if err != nil {
+		log.Printf("error counting liked books: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	pagination.setTotal(total)
+
+	likedBooks, err := getLikedBooksByUser(db, userID, sort, order, pagination)
+	if err != nil {
+		log.Printf("error getting liked books: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	type LikedBookDetail struct {
+		ID            int           `json:"id"`
+		Title         string        `json:"title"`
+		Author        string        `json:"author"`
+		Description   string        `json:"description"`
+		HasBeenRead   bool          `json:"has_been_read"`
+		ReadingStatus ReadingStatus `json:"reading_status"`
+		GoodreadsLink string        `json:"goodreads_link"`
+		LikedOn       time.Time     `json:"liked_on"`
+	}
+
+	results := []LikedBookDetail{}
+	for _, likedBook := range likedBooks {
+		results = append(results, LikedBookDetail{
+			ID:            likedBook.Book.ID,
+			Title:         likedBook.Book.Title,
+			Author:        likedBook.Book.Author,
+			Description:   likedBook.Book.Description,
+			HasBeenRead:   likedBook.Book.HasBeenRead,
+			ReadingStatus: likedBook.Book.ReadingStatus,
+			GoodreadsLink: likedBook.Book.GoodreadsLink,
+			LikedOn:       likedBook.LikedOn,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"sort":       sort,
+		"order":      order,
+		"pagination": pagination,
+		"books":      results,
+	})
+}
@@ -0,0 +1,560 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"leonlib/internal/captcha"
+
+	"github.com/gorilla/mux"
+)
+
+// LoanStatus mirrors the loan_status enum. A request becomes active when an admin approves it, and an active loan
+// becomes returned when the book is back on its shelf.
+type LoanStatus string
+
+const (
+	LoanRequested LoanStatus = "requested"
+	LoanRejected  LoanStatus = "rejected"
+	LoanActive    LoanStatus = "active"
+	LoanReturned  LoanStatus = "returned"
+)
+
+type Loan struct {
+	ID             int        `json:"id"`
+	BookID         int        `json:"book_id"`
+	BookTitle      string     `json:"book_title"`
+	BorrowerUserID string     `json:"borrower_user_id,omitempty"`
+	Borrower       string     `json:"borrower"`
+	Status         LoanStatus `json:"status"`
+	RequestedAt    *time.Time `json:"requested_at,omitempty"`
+	LoanedOn       string     `json:"loaned_on,omitempty"`
+	DueOn          string     `json:"due_on,omitempty"`
+	ReturnedOn     string     `json:"returned_on,omitempty"`
+	Notes          string     `json:"notes,omitempty"`
+}
+
+type PageLoansVariables struct {
+	Year     string
+	SiteKey  string
+	Requests []Loan
+	Active   []Loan
+	Overdue  []Loan
+	LoggedIn bool
+}
+
+var (
+	errInvalidLoan = errors.New("invalid loan")
+	errBookOnLoan  = errors.New("the book is already on loan")
+)
+
+// lendRequest is the body of a loan recorded by an admin; the borrower is a registered user, found by email,
+// or a free-text name.
+type lendRequest struct {
+	BorrowerEmail string `json:"borrower_email"`
+	BorrowerName  string `json:"borrower_name"`
+	LoanedOn      string `json:"loaned_on"`
+	DueOn         string `json:"due_on"`
+	Notes         string `json:"notes"`
+}
+
+type loanDatesRequest struct {
+	Date  string `json:"date"`
+	Notes string `json:"notes"`
+}
+
+const loanColumns = `l.id, l.book_id, b.title, COALESCE(l.borrower_user_id, ''),
+	COALESCE(l.borrower_name, u.name, u.email, ''), l.status, l.requested_at, l.loaned_on, l.due_on, l.returned_on,
+	COALESCE(l.notes, '')`
+
+const loanJoins = `FROM loans l
+	JOIN books b ON b.id = l.book_id AND b.deleted_at IS NULL
+	LEFT JOIN users u ON u.user_id = l.borrower_user_id`
+
+func (ls LoanStatus) Label() string {
+	switch ls {
+	case LoanRequested:
+		return "Solicitado"
+	case LoanRejected:
+		return "Rechazado"
+	case LoanActive:
+		return "Prestado"
+	case LoanReturned:
+		return "Devuelto"
+	default:
+		return "Desconocido"
+	}
+}
+
+// DaysOverdue is the number of days since the due date of an active loan, 0 when it is not overdue.
+func (l Loan) DaysOverdue() int {
+	if l.Status != LoanActive || l.DueOn == "" {
+		return 0
+	}
+
+	dueOn, err := time.Parse("2006-01-02", l.DueOn)
+	if err != nil {
+		return 0
+	}
+
+	today, _ := time.Parse("2006-01-02", time.Now().Format("2006-01-02"))
+	if !today.After(dueOn) {
+		return 0
+	}
+
+	return int(today.Sub(dueOn).Hours() / 24)
+}
+
+func (l Loan) IsOverdue() bool {
+	return l.DaysOverdue() > 0
+}
+
+func scanLoan(row rowScanner) (Loan, error) {
+	var loan Loan
+	var requestedAt sql.NullTime
+	var loanedOn, dueOn, returnedOn sql.NullTime
+	err := row.Scan(&loan.ID, &loan.BookID, &loan.BookTitle, &loan.BorrowerUserID, &loan.Borrower, &loan.Status,
+		&requestedAt, &loanedOn, &dueOn, &returnedOn, &loan.Notes)
+	if err != nil {
+		return Loan{}, err
+	}
+
+	if requestedAt.Valid {
+		loan.RequestedAt = &requestedAt.Time
+	}
+	loan.LoanedOn = formatOptionalDate(loanedOn)
+	loan.DueOn = formatOptionalDate(dueOn)
+	loan.ReturnedOn = formatOptionalDate(returnedOn)
+
+	return loan, nil
+}
+
+func queryLoans(db *sql.DB, query string, args ...interface{}) ([]Loan, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return []Loan{}, err
+	}
+
+	defer rows.Close()
+
+	loans := []Loan{}
+	for rows.Next() {
+		loan, err := scanLoan(rows)
+		if err != nil {
+			return []Loan{}, err
+		}
+		loans = append(loans, loan)
+	}
+
+	return loans, rows.Err()
+}
+
+// getBookLoans returns the loan history of a book, the most recent first.
+func getBookLoans(db *sql.DB, bookID int) ([]Loan, error) {
+	return queryLoans(db, `SELECT `+loanColumns+` `+loanJoins+`
+		WHERE l.book_id = $1
+		ORDER BY l.created_at DESC`, bookID)
+}
+
+func getActiveLoan(db *sql.DB, bookID int) (*Loan, error) {
+	loan, err := scanLoan(db.QueryRow(`SELECT `+loanColumns+` `+loanJoins+`
+		WHERE l.book_id = $1 AND l.status = 'active'`, bookID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &loan, nil
+}
+
+func getLoansByStatus(db *sql.DB, status LoanStatus) ([]Loan, error) {
+	return queryLoans(db, `SELECT `+loanColumns+` `+loanJoins+`
+		WHERE l.status = $1
+		ORDER BY l.due_on NULLS LAST, l.created_at`, status)
+}
+
+// getOverdueLoans returns the active loans past their due date, the oldest first.
+func getOverdueLoans(db *sql.DB) ([]Loan, error) {
+	return queryLoans(db, `SELECT `+loanColumns+` `+loanJoins+`
+		WHERE l.status = 'active' AND l.due_on < CURRENT_DATE
+		ORDER BY l.due_on`)
+}
+
+func hasPendingLoanRequest(db *sql.DB, bookID int, userID string) (bool, error) {
+	var requested bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM loans
+		WHERE book_id = $1 AND borrower_user_id = $2 AND status = 'requested')`, bookID, userID).Scan(&requested)
+
+	return requested, err
+}
+
+func getLoan(db *sql.DB, loanID int) (Loan, error) {
+	return scanLoan(db.QueryRow(`SELECT `+loanColumns+` `+loanJoins+` WHERE l.id = $1`, loanID))
+}
+
+// parseLoanDate reads an optional YYYY-MM-DD date of a loan request, defaulting to today when it is empty.
+func parseLoanDate(input string) (time.Time, error) {
+	if strings.TrimSpace(input) == "" {
+		return time.Now(), nil
+	}
+
+	date, err := parseOptionalDate(input)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %v", errInvalidLoan, err)
+	}
+
+	return date.Time, nil
+}
+
+func lendBook(db *sql.DB, bookID int, req lendRequest) (Loan, error) {
+	var borrowerUserID, borrowerName sql.NullString
+	if email := strings.TrimSpace(req.BorrowerEmail); email != "" {
+		err := db.QueryRow("SELECT user_id FROM users WHERE lower(email) = lower($1)", email).Scan(&borrowerUserID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return Loan{}, fmt.Errorf("%w: there is no user with email %q", errInvalidLoan, email)
+		}
+		if err != nil {
+			return Loan{}, err
+		}
+	}
+
+	borrowerName = nullableString(req.BorrowerName)
+	if !borrowerUserID.Valid && !borrowerName.Valid {
+		return Loan{}, fmt.Errorf("%w: borrower_email or borrower_name is required", errInvalidLoan)
+	}
+
+	loanedOn, err := parseLoanDate(req.LoanedOn)
+	if err != nil {
+		return Loan{}, err
+	}
+
+	dueOn, err := parseOptionalDate(req.DueOn)
+	if err != nil {
+		return Loan{}, fmt.Errorf("%w: %v", errInvalidLoan, err)
+	}
+	if dueOn.Valid && dueOn.Time.Format("2006-01-02") < loanedOn.Format("2006-01-02") {
+		return Loan{}, fmt.Errorf("%w: due_on cannot be before loaned_on", errInvalidLoan)
+	}
+
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM books WHERE id = $1 AND deleted_at IS NULL)", bookID).Scan(&exists); err != nil {
+		return Loan{}, err
+	}
+	if !exists {
+		return Loan{}, sql.ErrNoRows
+	}
+
+	var loanID int
+	err = db.QueryRow(`INSERT INTO loans(book_id, borrower_user_id, borrower_name, status, loaned_on, due_on, notes)
+		VALUES($1, $2, $3, 'active', $4, $5, $6)
+		RETURNING id`, bookID, borrowerUserID, borrowerName, loanedOn, dueOn, nullableString(req.Notes)).Scan(&loanID)
+	if isUniqueViolation(err) {
+		return Loan{}, errBookOnLoan
+	}
+	if err != nil {
+		return Loan{}, err
+	}
+
+	return getLoan(db, loanID)
+}
+
+// requestLoan records that the user wants to borrow the book; an admin approves or rejects it later.
+func requestLoan(db *sql.DB, bookID int, userID, notes string) (Loan, error) {
+	var loanID int
+	err := db.QueryRow(`INSERT INTO loans(book_id, borrower_user_id, status, requested_at, notes)
+		SELECT id, $2, 'requested', NOW(), $3 FROM books WHERE id = $1 AND deleted_at IS NULL
+		RETURNING id`, bookID, userID, nullableString(notes)).Scan(&loanID)
+	if isUniqueViolation(err) {
+		return Loan{}, fmt.Errorf("%w: you already asked for this book", errInvalidLoan)
+	}
+	if err != nil {
+		return Loan{}, err
+	}
+
+	return getLoan(db, loanID)
+}
+
+// changeLoanStatus moves a loan from one status to another, failing when it is not in the expected status.
+func changeLoanStatus(db *sql.DB, loanID int, from, to LoanStatus, setClause string, args ...interface{}) (Loan, error) {
+	args = append([]interface{}{loanID, from, to}, args...)
+	result, err := db.Exec(`UPDATE loans SET status = $3, updated_at = NOW()`+setClause+`
+		WHERE id = $1 AND status = $2`, args...)
+	if isUniqueViolation(err) {
+		return Loan{}, errBookOnLoan
+	}
+	if err != nil {
+		return Loan{}, err
+	}
+
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		loan, err := getLoan(db, loanID)
+		if err != nil {
+			return Loan{}, err
+		}
+		return Loan{}, fmt.Errorf("%w: the loan is %s", errInvalidLoan, loan.Status.Label())
+	}
+
+	return getLoan(db, loanID)
+}
+
+func approveLoan(db *sql.DB, loanID int, req loanDatesRequest) (Loan, error) {
+	dueOn, err := parseOptionalDate(req.Date)
+	if err != nil {
+		return Loan{}, fmt.Errorf("%w: %v", errInvalidLoan, err)
+	}
+	if dueOn.Valid && dueOn.Time.Format("2006-01-02") < time.Now().Format("2006-01-02") {
+		return Loan{}, fmt.Errorf("%w: the due date is in the past", errInvalidLoan)
+	}
+
+	return changeLoanStatus(db, loanID, LoanRequested, LoanActive, `, loaned_on = CURRENT_DATE, due_on = $4`, dueOn)
+}
+
+func rejectLoan(db *sql.DB, loanID int, req loanDatesRequest) (Loan, error) {
+	return changeLoanStatus(db, loanID, LoanRequested, LoanRejected, `, notes = COALESCE($4, notes)`, nullableString(req.Notes))
+}
+
+func returnLoan(db *sql.DB, loanID int, req loanDatesRequest) (Loan, error) {
+	returnedOn, err := parseLoanDate(req.Date)
+	if err != nil {
+		return Loan{}, err
+	}
+
+	return changeLoanStatus(db, loanID, LoanActive, LoanReturned, `, returned_on = GREATEST($4::DATE, loaned_on)`, returnedOn)
+}
+
+func parseLoanIDVar(r *http.Request) (int, error) {
+	loanID, err := strconv.Atoi(mux.Vars(r)["loan_id"])
+	if err != nil {
+		return 0, fmt.Errorf("invalid loan_id: %v", err)
+	}
+
+	return loanID, nil
+}
+
+func writeLoanError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errInvalidLoan):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errBookOnLoan):
+		http.Error(w, "El libro ya está prestado", http.StatusConflict)
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Not found", http.StatusNotFound)
+	default:
+		log.Printf("error saving loan: %v", err)
+		writeErrorGeneralStatus(w, err)
+	}
+}
+
+func writeLoan(w http.ResponseWriter, loan Loan, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(loan)
+}
+
+func BookLoans(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can see the loans", http.StatusForbidden)
+		return
+	}
+
+	bookID, err := parseBookIDVar(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	loans, err := getBookLoans(db, bookID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(loans)
+}
+
+func LendBook(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can lend books", http.StatusForbidden)
+		return
+	}
+
+	bookID, err := parseBookIDVar(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req lendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Error al decodificar el cuerpo de la solicitud", http.StatusBadRequest)
+		return
+	}
+
+	loan, err := lendBook(db, bookID, req)
+	if err != nil {
+		writeLoanError(w, err)
+		return
+	}
+
+	writeLoan(w, loan, http.StatusCreated)
+}
+
+// RequestLoan lets a logged in user ask to borrow a book.
+func RequestLoan(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	userID, err := getCurrentUserID(r)
+	if err != nil {
+		writeUnauthenticated(w)
+		return
+	}
+
+	bookID, err := parseBookIDVar(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req loanDatesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Error al decodificar el cuerpo de la solicitud", http.StatusBadRequest)
+		return
+	}
+
+	loan, err := requestLoan(db, bookID, userID, req.Notes)
+	if err != nil {
+		writeLoanError(w, err)
+		return
+	}
+
+	writeLoan(w, loan, http.StatusCreated)
+}
+
+// updateLoanHandler decodes the optional date and notes of an admin action on a loan and applies it.
+func updateLoanHandler(db *sql.DB, w http.ResponseWriter, r *http.Request, action func(*sql.DB, int, loanDatesRequest) (Loan, error)) {
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can manage the loans", http.StatusForbidden)
+		return
+	}
+
+	loanID, err := parseLoanIDVar(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req loanDatesRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Error al decodificar el cuerpo de la solicitud", http.StatusBadRequest)
+			return
+		}
+	}
+
+	loan, err := action(db, loanID, req)
+	if err != nil {
+		writeLoanError(w, err)
+		return
+	}
+
+	writeLoan(w, loan, http.StatusOK)
+}
+
+// ApproveLoan turns a request into an active loan starting today; the body may carry the due date.
+func ApproveLoan(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	updateLoanHandler(db, w, r, approveLoan)
+}
+
+func RejectLoan(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	updateLoanHandler(db, w, r, rejectLoan)
+}
+
+// ReturnLoan marks the book as back; the body may carry the return date, today by default.
+func ReturnLoan(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	updateLoanHandler(db, w, r, returnLoan)
+}
+
+func OverdueLoans(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can see the loans", http.StatusForbidden)
+		return
+	}
+
+	loans, err := getOverdueLoans(db)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(loans)
+}
+
+func LoansPage(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		redirectToErrorPageWithMessageAndStatusCode(w, "Only admins can manage the loans", http.StatusForbidden)
+		return
+	}
+
+	requests, err := getLoansByStatus(db, LoanRequested)
+	if err != nil {
+		log.Printf("error getting loan requests: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	active, err := getLoansByStatus(db, LoanActive)
+	if err != nil {
+		log.Printf("error getting active loans: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	overdue, err := getOverdueLoans(db)
+	if err != nil {
+		log.Printf("error getting overdue loans: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	pageVariables := PageLoansVariables{
+		Year:     now.Format("2006"),
+		SiteKey:  captcha.SiteKey,
+		Requests: requests,
+		Active:   active,
+		Overdue:  overdue,
+		LoggedIn: true,
+	}
+
+	templateDir := os.Getenv("TEMPLATE_DIR")
+	if templateDir == "" {
+		templateDir = "internal/template" // default value for local development
+	}
+	templatePath := filepath.Join(templateDir, "admin_prestamos.html")
+
+	t, err := template.ParseFiles(templatePath)
+	if err != nil {
+		log.Printf("template error: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "template error", http.StatusInternalServerError)
+		return
+	}
+
+	err = t.Execute(w, pageVariables)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("template error: %v", err)
+		return
+	}
+}
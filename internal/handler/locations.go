@@ -0,0 +1,683 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"leonlib/internal/captcha"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+const maxLocationNameLength = 100
+
+// LocationKind mirrors the location_kind enum: rooms contain bookcases and bookcases contain shelves.
+type LocationKind string
+
+const (
+	LocationRoom     LocationKind = "room"
+	LocationBookcase LocationKind = "bookcase"
+	LocationShelf    LocationKind = "shelf"
+)
+
+// parentKinds tells which kind of location can contain each kind; rooms are always at the top.
+var parentKinds = map[LocationKind]LocationKind{
+	LocationBookcase: LocationRoom,
+	LocationShelf:    LocationBookcase,
+}
+
+type Location struct {
+	ID        int          `json:"id"`
+	ParentID  *int         `json:"parent_id"`
+	Kind      LocationKind `json:"kind"`
+	Name      string       `json:"name"`
+	Path      string       `json:"path"`
+	Depth     int          `json:"depth"`
+	BookCount int          `json:"book_count"`
+	Selected  bool         `json:"-"`
+}
+
+// LocatedBook is a book listed in the inventory of a location, with the path of the place where it is.
+type LocatedBook struct {
+	Book     BookInfo
+	Location string
+}
+
+type PageLocationsVariables struct {
+	Year      string
+	SiteKey   string
+	Locations []Location
+	LoggedIn  bool
+	IsAdmin   bool
+}
+
+type PageLocationVariables struct {
+	Year     string
+	SiteKey  string
+	Location Location
+	Children []Location
+	Books    []LocatedBook
+	LoggedIn bool
+}
+
+var (
+	errInvalidLocation = errors.New("invalid location")
+	errLocationInUse   = errors.New("location in use")
+)
+
+// auditLocation is the snapshot of a location kept in the audit log; the path shows where it was moved.
+type auditLocation struct {
+	Name string       `json:"name"`
+	Kind LocationKind `json:"kind"`
+	Path string       `json:"path"`
+}
+
+type locationRequest struct {
+	Name     string `json:"name"`
+	Kind     string `json:"kind"`
+	ParentID *int   `json:"parent_id"`
+}
+
+func (lk LocationKind) Label() string {
+	switch lk {
+	case LocationRoom:
+		return "Cuarto"
+	case LocationBookcase:
+		return "Librero"
+	case LocationShelf:
+		return "Repisa"
+	default:
+		return "Desconocido"
+	}
+}
+
+func parseLocationKind(input string) (LocationKind, error) {
+	kind := LocationKind(strings.TrimSpace(strings.ToLower(input)))
+	switch kind {
+	case LocationRoom, LocationBookcase, LocationShelf:
+		return kind, nil
+	default:
+		return "", fmt.Errorf("%w: unknown kind %q", errInvalidLocation, input)
+	}
+}
+
+// IndentedName is used in the location select to show the hierarchy.
+func (l Location) IndentedName() string {
+	return strings.Repeat("— ", l.Depth) + l.Name
+}
+
+// parseLocationID reads the optional location_id field of the add and modify forms.
+func parseLocationID(input string) (sql.NullInt64, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return sql.NullInt64{}, nil
+	}
+
+	locationID, err := strconv.Atoi(input)
+	if err != nil || locationID <= 0 {
+		return sql.NullInt64{}, fmt.Errorf("invalid location_id: %q", input)
+	}
+
+	return sql.NullInt64{Int64: int64(locationID), Valid: true}, nil
+}
+
+// getLocationTree returns every location depth first, so each one comes right after its parent. Path holds the
+// names from the room, e.g. "Estudio > Librero blanco > Repisa 2". The location selectedID is marked as selected.
+func getLocationTree(db querier, selectedID int) ([]Location, error) {
+	rows, err := db.Query(`WITH RECURSIVE tree AS (
+			SELECT l.id, l.parent_id, l.kind, l.name, l.name::TEXT AS path, 0 AS depth, ARRAY[lower(l.name)::TEXT] AS sort_path
+			FROM locations l WHERE l.parent_id IS NULL
+			UNION ALL
+			SELECT l.id, l.parent_id, l.kind, l.name, t.path || ' > ' || l.name, t.depth + 1, t.sort_path || lower(l.name)::TEXT
+			FROM locations l JOIN tree t ON l.parent_id = t.id
+		)
+		SELECT t.id, t.parent_id, t.kind, t.name, t.path, t.depth,
+			(SELECT COUNT(*) FROM books b WHERE b.location_id = t.id AND b.deleted_at IS NULL)
+		FROM tree t
+		ORDER BY t.sort_path`)
+	if err != nil {
+		return []Location{}, err
+	}
+
+	defer rows.Close()
+
+	var locations []Location
+	for rows.Next() {
+		var location Location
+		var parentID sql.NullInt64
+		if err := rows.Scan(&location.ID, &parentID, &location.Kind, &location.Name, &location.Path, &location.Depth, &location.BookCount); err != nil {
+			return []Location{}, err
+		}
+
+		if parentID.Valid {
+			id := int(parentID.Int64)
+			location.ParentID = &id
+		}
+		location.Selected = location.ID == selectedID
+		locations = append(locations, location)
+	}
+
+	return locations, rows.Err()
+}
+
+// getLocation returns the location with its path; sql.ErrNoRows when it does not exist.
+func getLocation(db querier, locationID int) (Location, error) {
+	locations, err := getLocationTree(db, 0)
+	if err != nil {
+		return Location{}, err
+	}
+
+	for _, location := range locations {
+		if location.ID == locationID {
+			return location, nil
+		}
+	}
+
+	return Location{}, sql.ErrNoRows
+}
+
+// getBookLocation fills the location fields of the book, leaving them empty when nobody recorded where it is.
+func getBookLocation(db querier, book *BookInfo) error {
+	var locationID sql.NullInt64
+	if err := db.QueryRow("SELECT location_id FROM books WHERE id = $1", book.ID).Scan(&locationID); err != nil {
+		return err
+	}
+
+	if !locationID.Valid {
+		return nil
+	}
+
+	location, err := getLocation(db, int(locationID.Int64))
+	if err != nil {
+		return err
+	}
+
+	book.LocationID = location.ID
+	book.Location = location.Path
+	return nil
+}
+
+func setBookLocation(db execer, bookID int, locationID sql.NullInt64) error {
+	_, err := db.Exec("UPDATE books SET location_id = $1 WHERE id = $2", locationID, bookID)
+
+	return err
+}
+
+// getBooksInLocation lists the books of the location and of everything inside it, grouped by place.
+func getBooksInLocation(db *sql.DB, location Location) ([]LocatedBook, error) {
+	locations, err := getLocationTree(db, 0)
+	if err != nil {
+		return []LocatedBook{}, err
+	}
+
+	// The tree is depth first, so the parent of every sublocation is already in paths when it is reached.
+	paths := map[int]string{}
+	for _, l := range locations {
+		insideLocation := false
+		if l.ParentID != nil {
+			_, insideLocation = paths[*l.ParentID]
+		}
+		if l.ID == location.ID || insideLocation {
+			paths[l.ID] = l.Path
+		}
+	}
+
+	ids := make([]int, 0, len(paths))
+	for id := range paths {
+		ids = append(ids, id)
+	}
+
+	rows, err := db.Query(`SELECT `+bookColumns+`, b.location_id
+		FROM books b
+		WHERE b.location_id = ANY($1) AND b.deleted_at IS NULL
+		ORDER BY b.title`, pq.Array(ids))
+	if err != nil {
+		return []LocatedBook{}, err
+	}
+
+	defer rows.Close()
+
+	var books []LocatedBook
+	for rows.Next() {
+		var locationID int
+		bookInfo, err := scanBookInfo(rows, &locationID)
+		if err != nil {
+			return []LocatedBook{}, err
+		}
+
+		books = append(books, LocatedBook{Book: bookInfo, Location: paths[locationID]})
+	}
+	if err := rows.Err(); err != nil {
+		return []LocatedBook{}, err
+	}
+
+	sort.SliceStable(books, func(i, j int) bool {
+		return books[i].Location < books[j].Location
+	})
+
+	return books, nil
+}
+
+// checkLocationParent verifies that a location of the given kind can be placed inside parentID.
+func checkLocationParent(db *sql.DB, kind LocationKind, parentID *int) error {
+	expected, needsParent := parentKinds[kind]
+	if !needsParent {
+		if parentID != nil {
+			return fmt.Errorf("%w: a room cannot be inside another location", errInvalidLocation)
+		}
+		return nil
+	}
+
+	if parentID == nil {
+		return fmt.Errorf("%w: a %s must be inside a %s", errInvalidLocation, kind, expected)
+	}
+
+	var parentKind LocationKind
+	err := db.QueryRow("SELECT kind FROM locations WHERE id = $1", *parentID).Scan(&parentKind)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: location %d does not exist", errInvalidLocation, *parentID)
+	}
+	if err != nil {
+		return err
+	}
+
+	if parentKind != expected {
+		return fmt.Errorf("%w: a %s must be inside a %s", errInvalidLocation, kind, expected)
+	}
+
+	return nil
+}
+
+// locationPathKinds is the kind of each name of a location path: a room, a bookcase and a shelf.
+var locationPathKinds = []LocationKind{LocationRoom, LocationBookcase, LocationShelf}
+
+// parseLocationPath reads a path written as in Location.Path, e.g. "Estudio > Librero blanco > Repisa 2".
+func parseLocationPath(input string) ([]string, error) {
+	if strings.TrimSpace(input) == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(input, ">")
+	if len(parts) > len(locationPathKinds) {
+		return nil, fmt.Errorf("%w: a location has at most a room, a bookcase and a shelf", errInvalidLocation)
+	}
+
+	path := make([]string, 0, len(parts))
+	for _, part := range parts {
+		name, err := parseLocationName(part)
+		if err != nil {
+			return nil, err
+		}
+		path = append(path, name)
+	}
+
+	return path, nil
+}
+
+// findOrCreateLocationPath returns the location at the end of the path, creating the ones that are missing.
+func findOrCreateLocationPath(q queryRower, path []string) (int, error) {
+	var parentID sql.NullInt64
+	for i, name := range path {
+		var locationID int
+		err := q.QueryRow("SELECT id FROM locations WHERE COALESCE(parent_id, 0) = COALESCE($1, 0) AND lower(name) = lower($2)",
+			parentID, name).Scan(&locationID)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = q.QueryRow("INSERT INTO locations(parent_id, kind, name) VALUES($1, $2, $3) RETURNING id",
+				parentID, locationPathKinds[i], name).Scan(&locationID)
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		parentID = sql.NullInt64{Int64: int64(locationID), Valid: true}
+	}
+
+	return int(parentID.Int64), nil
+}
+
+func parseLocationName(input string) (string, error) {
+	name := strings.TrimSpace(input)
+	if name == "" || len(name) > maxLocationNameLength {
+		return "", fmt.Errorf("%w: the name is required and must have at most %d characters", errInvalidLocation, maxLocationNameLength)
+	}
+	// The paths are written with " > " between the names, so a name with ">" could not be read back.
+	if strings.Contains(name, ">") {
+		return "", fmt.Errorf("%w: the name cannot contain \">\"", errInvalidLocation)
+	}
+
+	return name, nil
+}
+
+func createLocation(db *sql.DB, req locationRequest) (Location, error) {
+	name, err := parseLocationName(req.Name)
+	if err != nil {
+		return Location{}, err
+	}
+
+	kind, err := parseLocationKind(req.Kind)
+	if err != nil {
+		return Location{}, err
+	}
+
+	if err := checkLocationParent(db, kind, req.ParentID); err != nil {
+		return Location{}, err
+	}
+
+	var locationID int
+	err = db.QueryRow("INSERT INTO locations(parent_id, kind, name) VALUES($1, $2, $3) RETURNING id", req.ParentID, kind, name).Scan(&locationID)
+	if isUniqueViolation(err) {
+		return Location{}, fmt.Errorf("%w: there is already a location named %q there", errInvalidLocation, name)
+	}
+	if err != nil {
+		return Location{}, err
+	}
+
+	return getLocation(db, locationID)
+}
+
+// updateLocation renames a location or moves it to another parent. The kind never changes, and the books and
+// sublocations go along with it.
+func updateLocation(db *sql.DB, locationID int, req locationRequest) (Location, error) {
+	name, err := parseLocationName(req.Name)
+	if err != nil {
+		return Location{}, err
+	}
+
+	var kind LocationKind
+	err = db.QueryRow("SELECT kind FROM locations WHERE id = $1", locationID).Scan(&kind)
+	if err != nil {
+		return Location{}, err
+	}
+
+	if err := checkLocationParent(db, kind, req.ParentID); err != nil {
+		return Location{}, err
+	}
+
+	_, err = db.Exec("UPDATE locations SET name = $1, parent_id = $2 WHERE id = $3", name, req.ParentID, locationID)
+	if isUniqueViolation(err) {
+		return Location{}, fmt.Errorf("%w: there is already a location named %q there", errInvalidLocation, name)
+	}
+	if err != nil {
+		return Location{}, err
+	}
+
+	return getLocation(db, locationID)
+}
+
+// deleteLocation only removes empty locations, so no book loses track of where it is.
+func deleteLocation(db *sql.DB, locationID int) error {
+	var inUse bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM locations WHERE parent_id = $1)
+		OR EXISTS (SELECT 1 FROM books WHERE location_id = $1)`, locationID).Scan(&inUse)
+	if err != nil {
+		return err
+	}
+
+	if inUse {
+		return errLocationInUse
+	}
+
+	result, err := db.Exec("DELETE FROM locations WHERE id = $1", locationID)
+	if err != nil {
+		return err
+	}
+
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func auditLocationFrom(location Location) auditLocation {
+	return auditLocation{Name: location.Name, Kind: location.Kind, Path: location.Path}
+}
+
+func parseLocationIDVar(r *http.Request) (int, error) {
+	locationID, err := strconv.Atoi(mux.Vars(r)["location_id"])
+	if err != nil {
+		return 0, errors.New("invalid location id")
+	}
+
+	return locationID, nil
+}
+
+func writeLocationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errInvalidLocation):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errLocationInUse):
+		http.Error(w, "La ubicación no está vacía", http.StatusConflict)
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Location not found", http.StatusNotFound)
+	default:
+		log.Printf("error saving location: %v", err)
+		writeErrorGeneralStatus(w, err)
+	}
+}
+
+func AllLocations(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	locations, err := getLocationTree(db, 0)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(locations)
+}
+
+func CreateLocation(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can change the locations", http.StatusForbidden)
+		return
+	}
+
+	var req locationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Error al decodificar el cuerpo de la solicitud", http.StatusBadRequest)
+		return
+	}
+
+	location, err := createLocation(db, req)
+	if err != nil {
+		writeLocationError(w, err)
+		return
+	}
+
+	recordAudit(db, r, AuditCreate, AuditLocation, location.ID, nil, auditLocationFrom(location))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(location)
+}
+
+// UpdateLocation renames or moves a location; moving a shelf moves all its books.
+func UpdateLocation(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can change the locations", http.StatusForbidden)
+		return
+	}
+
+	locationID, err := parseLocationIDVar(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req locationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Error al decodificar el cuerpo de la solicitud", http.StatusBadRequest)
+		return
+	}
+
+	before, err := getLocation(db, locationID)
+	if err != nil {
+		writeLocationError(w, err)
+		return
+	}
+
+	location, err := updateLocation(db, locationID, req)
+	if err != nil {
+		writeLocationError(w, err)
+		return
+	}
+
+	recordAudit(db, r, AuditUpdate, AuditLocation, locationID, auditLocationFrom(before), auditLocationFrom(location))
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(location)
+}
+
+func DeleteLocation(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can change the locations", http.StatusForbidden)
+		return
+	}
+
+	locationID, err := parseLocationIDVar(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	before, err := getLocation(db, locationID)
+	if err != nil {
+		writeLocationError(w, err)
+		return
+	}
+
+	if err := deleteLocation(db, locationID); err != nil {
+		writeLocationError(w, err)
+		return
+	}
+
+	recordAudit(db, r, AuditPurge, AuditLocation, locationID, auditLocationFrom(before), nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func LocationsPage(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	locations, err := getLocationTree(db, 0)
+	if err != nil {
+		log.Printf("error getting locations: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	pageVariables := PageLocationsVariables{
+		Year:      now.Format("2006"),
+		SiteKey:   captcha.SiteKey,
+		Locations: locations,
+		IsAdmin:   isAdmin(db, r),
+	}
+
+	_, err = getCurrentUserID(r)
+	pageVariables.LoggedIn = err == nil
+
+	templateDir := os.Getenv("TEMPLATE_DIR")
+	if templateDir == "" {
+		templateDir = "internal/template" // default value for local development
+	}
+	templatePath := filepath.Join(templateDir, "ubicaciones.html")
+
+	t, err := template.ParseFiles(templatePath)
+	if err != nil {
+		log.Printf("template error: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "template error", http.StatusInternalServerError)
+		return
+	}
+
+	err = t.Execute(w, pageVariables)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("template error: %v", err)
+		return
+	}
+}
+
+// LocationPage is the inventory view: every book that should be in the location, to check them against the shelf.
+func LocationPage(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	locationID, err := parseLocationIDVar(r)
+	if err != nil {
+		redirectToErrorPageWithMessageAndStatusCode(w, "wrong ID", http.StatusBadRequest)
+		return
+	}
+
+	location, err := getLocation(db, locationID)
+	if errors.Is(err, sql.ErrNoRows) {
+		redirectToErrorPageWithMessageAndStatusCode(w, "Location not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("error getting location: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	locations, err := getLocationTree(db, 0)
+	if err != nil {
+		log.Printf("error getting locations: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	var children []Location
+	for _, l := range locations {
+		if l.ParentID != nil && *l.ParentID == location.ID {
+			children = append(children, l)
+		}
+	}
+
+	books, err := getBooksInLocation(db, location)
+	if err != nil {
+		log.Printf("error getting books in location: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	pageVariables := PageLocationVariables{
+		Year:     now.Format("2006"),
+		SiteKey:  captcha.SiteKey,
+		Location: location,
+		Children: children,
+		Books:    books,
+	}
+
+	_, err = getCurrentUserID(r)
+	pageVariables.LoggedIn = err == nil
+
+	templateDir := os.Getenv("TEMPLATE_DIR")
+	if templateDir == "" {
+		templateDir = "internal/template" // default value for local development
+	}
+	templatePath := filepath.Join(templateDir, "ubicacion.html")
+
+	t, err := template.ParseFiles(templatePath)
+	if err != nil {
+		log.Printf("template error: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "template error", http.StatusInternalServerError)
+		return
+	}
+
+	err = t.Execute(w, pageVariables)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("template error: %v", err)
+		return
+	}
+}
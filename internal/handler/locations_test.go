@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseLocationName(t *testing.T) {
+	if name, err := parseLocationName("  Librero blanco "); err != nil || name != "Librero blanco" {
+		t.Errorf("parseLocationName() = %q, %v, want \"Librero blanco\"", name, err)
+	}
+
+	for _, input := range []string{"", "   ", "Estudio > Librero", "A>B"} {
+		if _, err := parseLocationName(input); !errors.Is(err, errInvalidLocation) {
+			t.Errorf("parseLocationName(%q) = %v, want errInvalidLocation", input, err)
+		}
+	}
+}
+
+func TestParseLocationPath(t *testing.T) {
+	path, err := parseLocationPath("Estudio > Librero blanco > Repisa 2")
+	if err != nil {
+		t.Fatalf("parseLocationPath() = %v", err)
+	}
+	if want := []string{"Estudio", "Librero blanco", "Repisa 2"}; !reflect.DeepEqual(path, want) {
+		t.Errorf("parseLocationPath() = %q, want %q", path, want)
+	}
+
+	if _, err := parseLocationPath("Estudio > > Repisa"); !errors.Is(err, errInvalidLocation) {
+		t.Errorf("parseLocationPath() with an empty name = %v, want errInvalidLocation", err)
+	}
+}
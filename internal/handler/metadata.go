@@ -0,0 +1,620 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"leonlib/internal/metadata"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultEnrichLimit = 50
+	maxEnrichLimit     = 500
+	enrichDelay        = 500 * time.Millisecond
+	// maxEnrichJobs is how many enrichments are kept in memory to be queried once finished.
+	maxEnrichJobs = 10
+)
+
+var errEnrichRunning = errors.New("an enrichment is already running")
+
+// MetadataProvider proposes book information for the add form and the bulk enrichment; nil disables both.
+var MetadataProvider metadata.Provider
+
+type EnrichReport struct {
+	Updated  []string `json:"updated"`
+	Proposed []string `json:"proposed"`
+	Skipped  []string `json:"skipped"`
+	Failed   []string `json:"failed"`
+}
+
+func nullableString(value string) sql.NullString {
+	value = strings.TrimSpace(value)
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+func nullableInt(value int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(value), Valid: value > 0}
+}
+
+func parseOptionalPositiveInt(name, input string) (sql.NullInt64, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return sql.NullInt64{}, nil
+	}
+
+	value, err := strconv.Atoi(input)
+	if err != nil || value <= 0 {
+		return sql.NullInt64{}, errors.New(name + " must be a positive number")
+	}
+
+	return sql.NullInt64{Int64: int64(value), Valid: true}, nil
+}
+
+func LookupMetadata(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can look up metadata", http.StatusForbidden)
+		return
+	}
+
+	if MetadataProvider == nil {
+		http.Error(w, "Metadata provider not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	query := metadata.Query{
+		ISBN:   r.URL.Query().Get("isbn"),
+		Title:  r.URL.Query().Get("title"),
+		Author: r.URL.Query().Get("author"),
+	}
+
+	if query.IsEmpty() {
+		http.Error(w, "isbn or title is required", http.StatusBadRequest)
+		return
+	}
+
+	book, err := MetadataProvider.Lookup(r.Context(), query)
+	if errors.Is(err, metadata.ErrNotFound) {
+		http.Error(w, "Book not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("error looking up metadata: %v", err)
+		http.Error(w, "Error getting metadata", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(book)
+}
+
+type enrichResult int
+
+const (
+	enrichSkipped enrichResult = iota
+	enrichUpdated
+	enrichProposed
+)
+
+// MetadataProposal is metadata found by title and author for a book without ISBN. It may describe another edition,
+// so an admin accepts or rejects it instead of it being written to the book.
+type MetadataProposal struct {
+	ID            int       `json:"id"`
+	BookID        int       `json:"book_id"`
+	Title         string    `json:"title"`
+	Author        string    `json:"author"`
+	ISBN10        string    `json:"isbn10,omitempty"`
+	ISBN13        string    `json:"isbn13,omitempty"`
+	Publisher     string    `json:"publisher,omitempty"`
+	PublishedYear int       `json:"published_year,omitempty"`
+	PageCount     int       `json:"page_count,omitempty"`
+	CoverURL      string    `json:"cover_url,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// fillEditionFields fills the empty ISBN and edition fields of a book; existing values are never overwritten. The
+// ISBN is left out when another book already has it.
+func fillEditionFields(q execer, bookID int, proposedISBN bookISBN, publisher string, year, pageCount int) error {
+	_, err := q.Exec(`UPDATE books b SET
+			isbn_10 = CASE WHEN b.isbn_13 IS NULL AND NOT EXISTS (SELECT 1 FROM books o WHERE o.id <> b.id AND (o.isbn_10 = $1 OR o.isbn_13 = $2))
+				THEN COALESCE(b.isbn_10, $1) ELSE b.isbn_10 END,
+			isbn_13 = CASE WHEN NOT EXISTS (SELECT 1 FROM books o WHERE o.id <> b.id AND (o.isbn_10 = $1 OR o.isbn_13 = $2))
+				THEN COALESCE(b.isbn_13, $2) ELSE b.isbn_13 END,
+			publisher = COALESCE(b.publisher, $3),
+			published_year = COALESCE(b.published_year, $4),
+			page_count = COALESCE(b.page_count, $5),
+			metadata_checked_at = NOW()
+		WHERE b.id = $6`,
+		proposedISBN.ISBN10, proposedISBN.ISBN13, nullableString(publisher), nullableInt(year), nullableInt(pageCount), bookID)
+
+	return err
+}
+
+// downloadCover returns the cover of the proposal when the book has no images yet, or nil.
+func downloadCover(ctx context.Context, book BookInfo, coverURL string) ([]byte, error) {
+	if coverURL == "" || len(book.Base64Images) > 0 {
+		return nil, nil
+	}
+
+	return MetadataProvider.Cover(ctx, coverURL)
+}
+
+// saveEditionFields fills the empty fields of the book and adds the cover in one transaction, saving the change in
+// the history of the book for actor.
+func saveEditionFields(db *sql.DB, actor sql.NullString, before BookInfo, proposedISBN bookISBN, publisher string,
+	year, pageCount int, cover []byte) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if err := fillEditionFields(tx, before.ID, proposedISBN, publisher, year, pageCount); err != nil {
+		return err
+	}
+
+	if len(cover) > 0 {
+		if err := insertBookImage(tx, before.ID, cover, ""); err != nil {
+			return err
+		}
+	}
+
+	if err := recordBookEditIn(tx, actor, AuditUpdate, before, 0); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// proposesNewValues reports whether the proposal fills at least one empty field of the book.
+func proposesNewValues(book BookInfo, proposedISBN bookISBN, proposal metadata.Book) bool {
+	return (book.ISBN13 == "" && proposedISBN.ISBN13.Valid) || (book.Publisher == "" && proposal.Publisher != "") ||
+		(book.PublishedYear == 0 && proposal.Year > 0) || (book.PageCount == 0 && proposal.PageCount > 0) ||
+		(len(book.Base64Images) == 0 && proposal.CoverURL != "")
+}
+
+// saveMetadataProposal keeps the proposal for an admin to review, replacing an older one for the same book.
+func saveMetadataProposal(db *sql.DB, bookID int, proposedISBN bookISBN, proposal metadata.Book) error {
+	_, err := db.Exec(`INSERT INTO metadata_proposals(book_id, isbn_10, isbn_13, publisher, published_year, page_count, cover_url)
+		VALUES($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (book_id) DO UPDATE SET isbn_10 = EXCLUDED.isbn_10, isbn_13 = EXCLUDED.isbn_13,
+			publisher = EXCLUDED.publisher, published_year = EXCLUDED.published_year, page_count = EXCLUDED.page_count,
+			cover_url = EXCLUDED.cover_url, created_at = NOW()`,
+		bookID, proposedISBN.ISBN10, proposedISBN.ISBN13, nullableString(proposal.Publisher), nullableInt(proposal.Year),
+		nullableInt(proposal.PageCount), nullableString(proposal.CoverURL))
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("UPDATE books SET metadata_checked_at = NOW() WHERE id = $1", bookID)
+	return err
+}
+
+// enrichBook fills the empty fields of a book with the provider proposal; existing values are never overwritten.
+// Only a lookup by ISBN is sure to describe the same edition: what is found by title and author is saved as a
+// proposal for an admin to review. The changes are saved in the history of the book for actor.
+func enrichBook(ctx context.Context, db *sql.DB, actor sql.NullString, book BookInfo) (enrichResult, error) {
+	query := metadata.Query{ISBN: book.ISBN13, Title: book.Title, Author: book.Author}
+
+	proposal, err := MetadataProvider.Lookup(ctx, query)
+	if errors.Is(err, metadata.ErrNotFound) {
+		_, err = db.Exec("UPDATE books SET metadata_checked_at = NOW() WHERE id = $1", book.ID)
+		return enrichSkipped, err
+	}
+	if err != nil {
+		return enrichSkipped, err
+	}
+
+	proposedISBN, err := parseBookISBN(proposal.ISBN)
+	if err != nil {
+		proposedISBN = bookISBN{}
+	}
+
+	if book.ISBN13 == "" {
+		if !proposesNewValues(book, proposedISBN, proposal) {
+			_, err = db.Exec("UPDATE books SET metadata_checked_at = NOW() WHERE id = $1", book.ID)
+			return enrichSkipped, err
+		}
+
+		return enrichProposed, saveMetadataProposal(db, book.ID, proposedISBN, proposal)
+	}
+
+	// The book is updated even when its cover cannot be downloaded.
+	cover, coverErr := downloadCover(ctx, book, proposal.CoverURL)
+	if err := saveEditionFields(db, actor, book, proposedISBN, proposal.Publisher, proposal.Year, proposal.PageCount, cover); err != nil {
+		return enrichSkipped, err
+	}
+
+	return enrichUpdated, coverErr
+}
+
+// EnrichJob is an enrichment running in the background. The report is filled when it finishes; until then Processed
+// tells how far it is.
+type EnrichJob struct {
+	ID         string          `json:"id"`
+	Status     ImportJobStatus `json:"status"`
+	Total      int             `json:"total"`
+	Processed  int             `json:"processed"`
+	StartedAt  time.Time       `json:"started_at"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Report     *EnrichReport   `json:"report,omitempty"`
+}
+
+var enrichJobs = struct {
+	sync.Mutex
+	jobs  map[string]*EnrichJob
+	order []string
+}{jobs: map[string]*EnrichJob{}}
+
+// startEnrichJob registers a new job; only one enrichment can run at a time, as the provider is queried slowly on
+// purpose.
+func startEnrichJob(total int) (EnrichJob, error) {
+	enrichJobs.Lock()
+	defer enrichJobs.Unlock()
+
+	for _, job := range enrichJobs.jobs {
+		if job.Status == ImportRunning {
+			return EnrichJob{}, errEnrichRunning
+		}
+	}
+
+	job := &EnrichJob{
+		ID:        generateRandomString(12),
+		Status:    ImportRunning,
+		Total:     total,
+		StartedAt: time.Now(),
+	}
+	enrichJobs.jobs[job.ID] = job
+	enrichJobs.order = append(enrichJobs.order, job.ID)
+
+	for len(enrichJobs.order) > maxEnrichJobs {
+		delete(enrichJobs.jobs, enrichJobs.order[0])
+		enrichJobs.order = enrichJobs.order[1:]
+	}
+
+	return *job, nil
+}
+
+func getEnrichJob(id string) (EnrichJob, bool) {
+	enrichJobs.Lock()
+	defer enrichJobs.Unlock()
+
+	job, ok := enrichJobs.jobs[id]
+	if !ok {
+		return EnrichJob{}, false
+	}
+
+	return *job, true
+}
+
+func updateEnrichJob(id string, update func(job *EnrichJob)) {
+	enrichJobs.Lock()
+	defer enrichJobs.Unlock()
+
+	if job, ok := enrichJobs.jobs[id]; ok {
+		update(job)
+	}
+}
+
+// getBooksToEnrich returns up to limit books that were never checked and miss some edition field.
+func getBooksToEnrich(db *sql.DB, limit int) ([]int, error) {
+	rows, err := db.Query(`SELECT b.id FROM books b
+		WHERE b.metadata_checked_at IS NULL AND b.deleted_at IS NULL
+		  AND (b.isbn_13 IS NULL OR b.publisher IS NULL OR b.published_year IS NULL OR b.page_count IS NULL)
+		ORDER BY b.id
+		LIMIT $1`, limit)
+	if err != nil {
+		return []int{}, err
+	}
+
+	defer rows.Close()
+
+	var bookIDs []int
+	for rows.Next() {
+		var bookID int
+		if err := rows.Scan(&bookID); err != nil {
+			return []int{}, err
+		}
+		bookIDs = append(bookIDs, bookID)
+	}
+
+	return bookIDs, rows.Err()
+}
+
+// enrichBooks looks up the books one after the other, waiting enrichDelay between them not to flood the provider.
+func enrichBooks(ctx context.Context, db *sql.DB, actor sql.NullString, bookIDs []int, progress func(processed int)) EnrichReport {
+	report := EnrichReport{Updated: []string{}, Proposed: []string{}, Skipped: []string{}, Failed: []string{}}
+	for i, bookID := range bookIDs {
+		if i > 0 {
+			time.Sleep(enrichDelay)
+		}
+
+		book, err := getBookDetails(db, bookID)
+		if err != nil {
+			report.Failed = append(report.Failed, strconv.Itoa(bookID)+": "+err.Error())
+			progress(i + 1)
+			continue
+		}
+
+		result, err := enrichBook(ctx, db, actor, book)
+		switch {
+		case err != nil:
+			log.Printf("error enriching %s: %v", book, err)
+			report.Failed = append(report.Failed, book.String()+": "+err.Error())
+		case result == enrichUpdated:
+			report.Updated = append(report.Updated, book.String())
+		case result == enrichProposed:
+			report.Proposed = append(report.Proposed, book.String())
+		default:
+			report.Skipped = append(report.Skipped, book.String())
+		}
+		progress(i + 1)
+	}
+
+	return report
+}
+
+// runEnrichJob enriches the books in the background; the job it returns can be followed at /api/enrich/{job_id}.
+func runEnrichJob(db *sql.DB, actor sql.NullString, bookIDs []int) (EnrichJob, error) {
+	job, err := startEnrichJob(len(bookIDs))
+	if err != nil {
+		return EnrichJob{}, err
+	}
+
+	go func() {
+		startTime := time.Now()
+
+		// The request is done before the enrichment, so its context cannot be used.
+		report := enrichBooks(context.Background(), db, actor, bookIDs, func(processed int) {
+			updateEnrichJob(job.ID, func(job *EnrichJob) {
+				job.Processed = processed
+			})
+		})
+
+		finishedAt := time.Now()
+		updateEnrichJob(job.ID, func(job *EnrichJob) {
+			job.FinishedAt = &finishedAt
+			job.Status = ImportFinished
+			job.Report = &report
+		})
+
+		log.Printf("Books enriched in: %.2f seconds (updated=%d, proposed=%d, skipped=%d, failed=%d)\n",
+			time.Since(startTime).Seconds(), len(report.Updated), len(report.Proposed), len(report.Skipped),
+			len(report.Failed))
+	}()
+
+	return job, nil
+}
+
+// EnrichBooks looks up metadata in the background for up to "limit" books that were never checked, and answers
+// right away with the job, which can be followed at /api/enrich/{job_id}.
+func EnrichBooks(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can enrich books", http.StatusForbidden)
+		return
+	}
+
+	if MetadataProvider == nil {
+		http.Error(w, "Metadata provider not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 {
+		limit = defaultEnrichLimit
+	}
+	if limit > maxEnrichLimit {
+		limit = maxEnrichLimit
+	}
+
+	bookIDs, err := getBooksToEnrich(db, limit)
+	if err != nil {
+		writeErrorGeneralStatus(w, err)
+		return
+	}
+
+	job, err := runEnrichJob(db, auditActor(r), bookIDs)
+	if errors.Is(err, errEnrichRunning) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeErrorGeneralStatus(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/enrich/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(job)
+}
+
+// EnrichStatus returns the progress of an enrichment, and its report once it finished.
+func EnrichStatus(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can see the enrichments", http.StatusForbidden)
+		return
+	}
+
+	job, ok := getEnrichJob(mux.Vars(r)["job_id"])
+	if !ok {
+		http.Error(w, "Enrichment not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(job)
+}
+
+// getMetadataProposals returns the proposals waiting for review, the oldest first; bookID and proposalID limit them
+// to one book or one proposal when they are not 0.
+func getMetadataProposals(db *sql.DB, bookID, proposalID int) ([]MetadataProposal, error) {
+	rows, err := db.Query(`SELECT p.id, p.book_id, b.title, b.author, p.isbn_10, p.isbn_13, p.publisher,
+			p.published_year, p.page_count, p.cover_url, p.created_at
+		FROM metadata_proposals p
+		JOIN books b ON b.id = p.book_id AND b.deleted_at IS NULL
+		WHERE ($1 = 0 OR p.book_id = $1) AND ($2 = 0 OR p.id = $2)
+		ORDER BY p.created_at, p.id`, bookID, proposalID)
+	if err != nil {
+		return []MetadataProposal{}, err
+	}
+
+	defer rows.Close()
+
+	proposals := []MetadataProposal{}
+	for rows.Next() {
+		var proposal MetadataProposal
+		var isbn10, isbn13, publisher, coverURL sql.NullString
+		var year, pageCount sql.NullInt64
+		err := rows.Scan(&proposal.ID, &proposal.BookID, &proposal.Title, &proposal.Author, &isbn10, &isbn13, &publisher,
+			&year, &pageCount, &coverURL, &proposal.CreatedAt)
+		if err != nil {
+			return []MetadataProposal{}, err
+		}
+
+		proposal.ISBN10 = isbn10.String
+		proposal.ISBN13 = isbn13.String
+		proposal.Publisher = publisher.String
+		proposal.PublishedYear = int(year.Int64)
+		proposal.PageCount = int(pageCount.Int64)
+		proposal.CoverURL = coverURL.String
+		proposals = append(proposals, proposal)
+	}
+
+	return proposals, rows.Err()
+}
+
+func getMetadataProposal(db *sql.DB, proposalID int) (MetadataProposal, error) {
+	proposals, err := getMetadataProposals(db, 0, proposalID)
+	if err != nil {
+		return MetadataProposal{}, err
+	}
+
+	if len(proposals) == 0 {
+		return MetadataProposal{}, sql.ErrNoRows
+	}
+
+	return proposals[0], nil
+}
+
+func parseProposalIDVar(r *http.Request) (int, error) {
+	proposalID, err := strconv.Atoi(mux.Vars(r)["proposal_id"])
+	if err != nil {
+		return 0, fmt.Errorf("invalid proposal_id: %v", err)
+	}
+
+	return proposalID, nil
+}
+
+// MetadataProposals lists the metadata found by title and author that waits for review.
+func MetadataProposals(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can review metadata", http.StatusForbidden)
+		return
+	}
+
+	proposals, err := getMetadataProposals(db, 0, 0)
+	if err != nil {
+		log.Printf("error getting metadata proposals: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(proposals)
+}
+
+// AcceptMetadataProposal fills the empty fields of the book with the proposal, as the enrichment does for a lookup
+// by ISBN.
+func AcceptMetadataProposal(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can review metadata", http.StatusForbidden)
+		return
+	}
+
+	proposalID, err := parseProposalIDVar(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	proposal, err := getMetadataProposal(db, proposalID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Proposal not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeErrorGeneralStatus(w, err)
+		return
+	}
+
+	before, err := getBookDetails(db, proposal.BookID)
+	if err != nil {
+		writeErrorGeneralStatus(w, err)
+		return
+	}
+
+	proposedISBN, err := resolveBookISBN(proposal.ISBN13, proposal.ISBN10)
+	if err != nil {
+		proposedISBN = bookISBN{}
+	}
+
+	var cover []byte
+	if MetadataProvider != nil {
+		if cover, err = downloadCover(r.Context(), before, proposal.CoverURL); err != nil {
+			log.Printf("error downloading the cover of %s: %v", before, err)
+		}
+	}
+
+	err = saveEditionFields(db, auditActor(r), before, proposedISBN, proposal.Publisher, proposal.PublishedYear,
+		proposal.PageCount, cover)
+	if err != nil {
+		writeErrorGeneralStatus(w, err)
+		return
+	}
+
+	if _, err := db.Exec("DELETE FROM metadata_proposals WHERE id = $1", proposalID); err != nil {
+		writeErrorGeneralStatus(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func RejectMetadataProposal(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can review metadata", http.StatusForbidden)
+		return
+	}
+
+	proposalID, err := parseProposalIDVar(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM metadata_proposals WHERE id = $1", proposalID)
+	if err != nil {
+		writeErrorGeneralStatus(w, err)
+		return
+	}
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		http.Error(w, "Proposal not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,399 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	opdsNavigationType  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	opdsAcquisitionType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	opdsTitle           = "Mi Biblioteca"
+	// opdsFeedSize is the number of books of the recently added and popular feeds.
+	opdsFeedSize = 50
+)
+
+// opdsFeed is an OPDS 1.2 catalog: an Atom feed whose entries lead to other feeds (navigation) or are books
+// (acquisition).
+type opdsFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	XmlnsDC string      `xml:"xmlns:dc,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  opdsAuthor  `xml:"author"`
+	Links   []opdsLink  `xml:"link"`
+	Entries []opdsEntry `xml:"entry"`
+}
+
+type opdsAuthor struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type opdsLink struct {
+	Rel   string `xml:"rel,attr"`
+	Href  string `xml:"href,attr"`
+	Type  string `xml:"type,attr"`
+	Title string `xml:"title,attr,omitempty"`
+}
+
+type opdsCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+type opdsContent struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+type opdsEntry struct {
+	ID          string         `xml:"id"`
+	Title       string         `xml:"title"`
+	Updated     string         `xml:"updated"`
+	Authors     []opdsAuthor   `xml:"author"`
+	Language    string         `xml:"dc:language,omitempty"`
+	Publisher   string         `xml:"dc:publisher,omitempty"`
+	Issued      string         `xml:"dc:issued,omitempty"`
+	Identifiers []string       `xml:"dc:identifier"`
+	Categories  []opdsCategory `xml:"category"`
+	Content     *opdsContent   `xml:"content"`
+	Links       []opdsLink     `xml:"link"`
+}
+
+func newOPDSFeed(id, title, self, kind string) opdsFeed {
+	return opdsFeed{
+		Xmlns:   "http://www.w3.org/2005/Atom",
+		XmlnsDC: "http://purl.org/dc/terms/",
+		ID:      "urn:leonlib:opds:" + id,
+		Title:   title,
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Author:  opdsAuthor{Name: opdsTitle, URI: "/"},
+		Links: []opdsLink{
+			{Rel: "self", Href: self, Type: kind},
+			{Rel: "start", Href: "/opds", Type: opdsNavigationType},
+		},
+	}
+}
+
+// navigationEntry is an entry of a navigation feed leading to the feed at href.
+func navigationEntry(id, title, description, href, kind string) opdsEntry {
+	return opdsEntry{
+		ID:      "urn:leonlib:opds:" + id,
+		Title:   title,
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Content: &opdsContent{Type: "text", Text: description},
+		Links:   []opdsLink{{Rel: "subsection", Href: href, Type: kind}},
+	}
+}
+
+func bookCountLabel(count int) string {
+	if count == 1 {
+		return "1 libro"
+	}
+
+	return fmt.Sprintf("%d libros", count)
+}
+
+// imageContentType detects the type of a base64 encoded image from its first bytes.
+func imageContentType(encoded string) string {
+	if len(encoded) > 16 {
+		encoded = encoded[:16]
+	}
+
+	header, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "image/jpeg"
+	}
+
+	return http.DetectContentType(header)
+}
+
+// bookEntry is the acquisition entry of a book, with its cover and a link to its page. The books are the ones on
+// the shelves, so there is no file to download.
+func bookEntry(db *sql.DB, book BookInfo) (opdsEntry, error) {
+	entry := opdsEntry{
+		ID:        fmt.Sprintf("urn:leonlib:book:%d", book.ID),
+		Title:     book.Title,
+		Language:  book.Language,
+		Publisher: book.Publisher,
+		Links: []opdsLink{
+			{Rel: "alternate", Href: fmt.Sprintf("/book_info?id=%d", book.ID), Type: "text/html", Title: "Ver en la biblioteca"},
+		},
+	}
+
+	updated, err := time.Parse("2006-01-02", book.AddedOn)
+	if err != nil {
+		updated = time.Now()
+	}
+	entry.Updated = updated.UTC().Format(time.RFC3339)
+
+	for _, name := range splitAuthorNames(book.Author) {
+		entry.Authors = append(entry.Authors, opdsAuthor{Name: name, URI: "/opds/authors/" + url.PathEscape(slugify(name))})
+	}
+
+	if book.Description != "" {
+		entry.Content = &opdsContent{Type: "text", Text: book.Description}
+	}
+
+	if book.PublishedYear != 0 {
+		entry.Issued = strconv.Itoa(book.PublishedYear)
+	}
+
+	if book.ISBN13 != "" {
+		entry.Identifiers = append(entry.Identifiers, "urn:isbn:"+book.ISBN13)
+	}
+
+	tags, err := getBookTags(db, book.ID)
+	if err != nil {
+		return opdsEntry{}, err
+	}
+	for _, tag := range tags {
+		entry.Categories = append(entry.Categories, opdsCategory{Term: tag.Slug, Label: tag.Name})
+	}
+
+	if len(book.Base64Images) > 0 {
+		cover := book.Base64Images[0]
+		href := fmt.Sprintf("/opds/covers/%d", cover.ImageID)
+		kind := imageContentType(cover.Image)
+		entry.Links = append(entry.Links,
+			opdsLink{Rel: "http://opds-spec.org/image", Href: href, Type: kind},
+			opdsLink{Rel: "http://opds-spec.org/image/thumbnail", Href: href, Type: kind})
+	}
+
+	return entry, nil
+}
+
+// getOPDSBooks returns the books of a feed, selected with the joins, conditions and order given. Instead of the images,
+// only the id and the first bytes of the first cover are read: enough for bookEntry to link it with its type.
+func getOPDSBooks(db *sql.DB, joins, conditions, order string, args ...interface{}) ([]BookInfo, error) {
+	rows, err := db.Query(`SELECT `+bookColumns+`, cover.image_id, cover.header
+		FROM books b
+		`+joins+`
+		LEFT JOIN LATERAL (
+			SELECT i.image_id, substring(i.image FROM 1 FOR 12) AS header
+			FROM book_images i
+			WHERE i.book_id = b.id AND i.deleted_at IS NULL AND length(i.image) > 0
+			ORDER BY i.image_id
+			LIMIT 1
+		) cover ON TRUE
+		WHERE `+conditions+`
+		ORDER BY `+order, args...)
+	if err != nil {
+		return []BookInfo{}, err
+	}
+
+	defer rows.Close()
+
+	var books []BookInfo
+	for rows.Next() {
+		var coverID sql.NullInt64
+		var header []byte
+		book, err := scanBookInfo(rows, &coverID, &header)
+		if err != nil {
+			return []BookInfo{}, err
+		}
+
+		if coverID.Valid {
+			book.Base64Images = []BookImageInfo{{
+				ImageID: int(coverID.Int64),
+				BookID:  book.ID,
+				Image:   base64.StdEncoding.EncodeToString(header),
+			}}
+		}
+		books = append(books, book)
+	}
+
+	return books, rows.Err()
+}
+
+func writeOPDSFeed(w http.ResponseWriter, feed opdsFeed, kind string) {
+	w.Header().Set("Content-Type", kind+";charset=utf-8")
+	_, _ = w.Write([]byte(xml.Header))
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(feed); err != nil {
+		log.Printf("error writing OPDS feed: %v", err)
+	}
+}
+
+// writeAcquisitionFeed writes the books as an acquisition feed with the given id, title and URL.
+func writeAcquisitionFeed(db *sql.DB, w http.ResponseWriter, id, title, self string, books []BookInfo) {
+	feed := newOPDSFeed(id, title, self, opdsAcquisitionType)
+	feed.Links = append(feed.Links, opdsLink{Rel: "up", Href: "/opds", Type: opdsNavigationType})
+
+	for _, book := range books {
+		entry, err := bookEntry(db, book)
+		if err != nil {
+			log.Printf("error getting tags: %v", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	writeOPDSFeed(w, feed, opdsAcquisitionType)
+}
+
+// OPDSRoot is the start of the OPDS catalog, for e-reader apps such as KOReader.
+func OPDSRoot(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	feed := newOPDSFeed("root", opdsTitle, "/opds", opdsNavigationType)
+	feed.Entries = []opdsEntry{
+		navigationEntry("authors", "Por autor", "Los libros de cada autor", "/opds/authors", opdsNavigationType),
+		navigationEntry("tags", "Por etiqueta", "Los libros de cada etiqueta", "/opds/tags", opdsNavigationType),
+		navigationEntry("recent", "Agregados recientemente", "Los últimos libros agregados", "/opds/recent", opdsAcquisitionType),
+		navigationEntry("popular", "Populares", "Los libros con más me gusta", "/opds/popular", opdsAcquisitionType),
+	}
+
+	writeOPDSFeed(w, feed, opdsNavigationType)
+}
+
+func OPDSAuthors(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	authors, err := getAllAuthors(db)
+	if err != nil {
+		log.Printf("error getting authors: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	feed := newOPDSFeed("authors", "Por autor", "/opds/authors", opdsNavigationType)
+	feed.Links = append(feed.Links, opdsLink{Rel: "up", Href: "/opds", Type: opdsNavigationType})
+	for _, author := range authors {
+		feed.Entries = append(feed.Entries, navigationEntry("author:"+author.Slug, author.Name,
+			bookCountLabel(author.BookCount), "/opds/authors/"+url.PathEscape(author.Slug), opdsAcquisitionType))
+	}
+
+	writeOPDSFeed(w, feed, opdsNavigationType)
+}
+
+func OPDSAuthor(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	author, err := getAuthorBySlug(db, mux.Vars(r)["slug"])
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Author not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("error getting author: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	books, err := getOPDSBooks(db, "",
+		"b.deleted_at IS NULL AND EXISTS (SELECT 1 FROM book_authors ba WHERE ba.book_id = b.id AND ba.author_id = $1)",
+		"b.published_year NULLS LAST, b.title", author.ID)
+	if err != nil {
+		log.Printf("error getting books by author: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	writeAcquisitionFeed(db, w, "author:"+author.Slug, author.Name, "/opds/authors/"+url.PathEscape(author.Slug), books)
+}
+
+func OPDSTags(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	tags, err := getAllTags(db)
+	if err != nil {
+		log.Printf("error getting tags: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	feed := newOPDSFeed("tags", "Por etiqueta", "/opds/tags", opdsNavigationType)
+	feed.Links = append(feed.Links, opdsLink{Rel: "up", Href: "/opds", Type: opdsNavigationType})
+	for _, tag := range tags {
+		feed.Entries = append(feed.Entries, navigationEntry("tag:"+tag.Slug, tag.Name, bookCountLabel(tag.BookCount),
+			"/opds/tags/"+url.PathEscape(tag.Slug), opdsAcquisitionType))
+	}
+
+	writeOPDSFeed(w, feed, opdsNavigationType)
+}
+
+func OPDSTag(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	slug := slugify(mux.Vars(r)["tag"])
+
+	var name string
+	err := db.QueryRow("SELECT name FROM tags WHERE slug = $1", slug).Scan(&name)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Tag not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("error getting tag: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	books, err := getOPDSBooks(db, "", bookFilterConditions(1), "b.title", bookFilter{Tag: slug}.args()...)
+	if err != nil {
+		log.Printf("error getting books by tag: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	writeAcquisitionFeed(db, w, "tag:"+slug, name, "/opds/tags/"+url.PathEscape(slug), books)
+}
+
+// OPDSRecent lists the last books added to the library, the newest first.
+func OPDSRecent(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	books, err := getOPDSBooks(db, "", "b.deleted_at IS NULL", "b.added_on DESC, b.id DESC LIMIT $1", opdsFeedSize)
+	if err != nil {
+		log.Printf("error getting recent books: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	writeAcquisitionFeed(db, w, "recent", "Agregados recientemente", "/opds/recent", books)
+}
+
+// OPDSPopular lists the books with the most likes.
+func OPDSPopular(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	books, err := getOPDSBooks(db, "JOIN book_likes_ranking r ON r.book_id = b.id", "b.deleted_at IS NULL",
+		"r.likes_count DESC, b.title LIMIT $1", opdsFeedSize)
+	if err != nil {
+		log.Printf("error getting most liked books: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	writeAcquisitionFeed(db, w, "popular", "Populares", "/opds/popular", books)
+}
+
+// OPDSCover returns an image of a book, as the e-reader apps cannot show the images embedded in the pages.
+func OPDSCover(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	imageID, err := strconv.Atoi(mux.Vars(r)["image_id"])
+	if err != nil {
+		http.Error(w, "Invalid image id", http.StatusBadRequest)
+		return
+	}
+
+	var image []byte
+	err = db.QueryRow(`SELECT i.image FROM book_images i
+		JOIN books b ON b.id = i.book_id AND b.deleted_at IS NULL
+		WHERE i.image_id = $1 AND i.deleted_at IS NULL`, imageID).Scan(&image)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && len(image) == 0) {
+		http.Error(w, "Image not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("error getting image: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", http.DetectContentType(image))
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	_, _ = w.Write(image)
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// Pagination holds the page requested by the client and the totals needed to render the navigation.
+type Pagination struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	Total      int `json:"total"`
+	TotalPages int `json:"total_pages"`
+}
+
+func (p Pagination) Offset() int {
+	return (p.Page - 1) * p.PerPage
+}
+
+func (p Pagination) HasPrev() bool {
+	return p.Page > 1
+}
+
+func (p Pagination) HasNext() bool {
+	return p.Page < p.TotalPages
+}
+
+func (p Pagination) PrevPage() int {
+	return p.Page - 1
+}
+
+func (p Pagination) NextPage() int {
+	return p.Page + 1
+}
+
+func (p *Pagination) setTotal(total int) {
+	p.Total = total
+	p.TotalPages = (total + p.PerPage - 1) / p.PerPage
+}
+
+func parsePagination(r *http.Request) Pagination {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	perPage, err := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if err != nil || perPage < 1 {
+		perPage = defaultPageSize
+	}
+
+	if perPage > maxPageSize {
+		perPage = maxPageSize
+	}
+
+	return Pagination{Page: page, PerPage: perPage}
+}
+
+func parseSortOrder(input string) string {
+	if strings.TrimSpace(strings.ToLower(input)) == "asc" {
+		return "ASC"
+	}
+
+	return "DESC"
+}
@@ -0,0 +1,283 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"leonlib/internal/captcha"
+)
+
+const (
+	defaultRankingLimit = 10
+	maxRankingLimit     = 50
+	maxTrendingDays     = 365
+)
+
+var (
+	// DefaultTrendingDays is the window used for the trending ranking when the request does not specify one.
+	DefaultTrendingDays = 7
+	// RankingRefreshInterval is how often the most liked ranking is recomputed and the trending cache expires.
+	RankingRefreshInterval = 15 * time.Minute
+
+	trendingCache = rankingCache{entries: map[string]rankingCacheEntry{}}
+)
+
+type RankedBook struct {
+	ID           int             `json:"id"`
+	Title        string          `json:"title"`
+	Author       string          `json:"author"`
+	Likes        int             `json:"likes"`
+	Base64Images []BookImageInfo `json:"-"`
+}
+
+type PageRankingVariables struct {
+	Year         string
+	SiteKey      string
+	MostLiked    []RankedBook
+	Trending     []RankedBook
+	TrendingDays int
+	LoggedIn     bool
+}
+
+type rankingCacheEntry struct {
+	books     []RankedBook
+	expiresAt time.Time
+}
+
+type rankingCache struct {
+	mu      sync.Mutex
+	entries map[string]rankingCacheEntry
+}
+
+func (c *rankingCache) get(key string) ([]RankedBook, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+
+	return entry.books, true
+}
+
+func (c *rankingCache) set(key string, books []RankedBook) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = rankingCacheEntry{books: books, expiresAt: time.Now().Add(RankingRefreshInterval)}
+}
+
+func (c *rankingCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = map[string]rankingCacheEntry{}
+}
+
+// StartRankingRefresher recomputes the book_likes_ranking materialized view every interval, so the
+// ranking queries only read precomputed counts.
+func StartRankingRefresher(db *sql.DB, interval time.Duration) {
+	RankingRefreshInterval = interval
+
+	refresh := func() {
+		if _, err := db.Exec("REFRESH MATERIALIZED VIEW CONCURRENTLY book_likes_ranking"); err != nil {
+			log.Printf("error refreshing book_likes_ranking: %v", err)
+			return
+		}
+		trendingCache.clear()
+	}
+
+	refresh()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			refresh()
+		}
+	}()
+}
+
+func parseRankingLimit(input string) int {
+	limit, err := strconv.Atoi(input)
+	if err != nil || limit < 1 {
+		return defaultRankingLimit
+	}
+
+	if limit > maxRankingLimit {
+		return maxRankingLimit
+	}
+
+	return limit
+}
+
+func parseTrendingDays(input string) int {
+	days, err := strconv.Atoi(input)
+	if err != nil || days < 1 {
+		return DefaultTrendingDays
+	}
+
+	if days > maxTrendingDays {
+		return maxTrendingDays
+	}
+
+	return days
+}
+
+func scanRankedBooks(rows *sql.Rows) ([]RankedBook, error) {
+	defer rows.Close()
+
+	books := []RankedBook{}
+	for rows.Next() {
+		var book RankedBook
+		if err := rows.Scan(&book.ID, &book.Title, &book.Author, &book.Likes); err != nil {
+			return []RankedBook{}, err
+		}
+		books = append(books, book)
+	}
+
+	return books, rows.Err()
+}
+
+func getMostLikedBooks(db *sql.DB, limit int) ([]RankedBook, error) {
+	rows, err := db.Query(`SELECT b.id, b.title, b.author, r.likes_count
+		FROM book_likes_ranking r
+		JOIN books b ON b.id = r.book_id
+		WHERE b.deleted_at IS NULL
+		ORDER BY r.likes_count DESC, b.title
+		LIMIT $1`, limit)
+	if err != nil {
+		return []RankedBook{}, err
+	}
+
+	return scanRankedBooks(rows)
+}
+
+func getTrendingBooks(db *sql.DB, days, limit int) ([]RankedBook, error) {
+	cacheKey := fmt.Sprintf("%d:%d", days, limit)
+	if books, ok := trendingCache.get(cacheKey); ok {
+		return books, nil
+	}
+
+	rows, err := db.Query(`SELECT b.id, b.title, b.author, COUNT(*) AS likes_count
+		FROM book_likes l
+		JOIN books b ON b.id = l.book_id
+		WHERE l.created_at >= NOW() - make_interval(days => $1) AND b.deleted_at IS NULL
+		GROUP BY b.id, b.title, b.author
+		ORDER BY likes_count DESC, b.title
+		LIMIT $2`, days, limit)
+	if err != nil {
+		return []RankedBook{}, err
+	}
+
+	books, err := scanRankedBooks(rows)
+	if err != nil {
+		return []RankedBook{}, err
+	}
+
+	trendingCache.set(cacheKey, books)
+
+	return books, nil
+}
+
+func PopularBooksPage(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	limit := parseRankingLimit(r.URL.Query().Get("limit"))
+	days := parseTrendingDays(r.URL.Query().Get("days"))
+
+	mostLiked, err := getMostLikedBooks(db, limit)
+	if err != nil {
+		log.Printf("error getting most liked books: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	trending, err := getTrendingBooks(db, days, limit)
+	if err != nil {
+		log.Printf("error getting trending books: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	for i := range mostLiked {
+		bookImages, err := getImagesByBookID(db, mostLiked[i].ID)
+		if err != nil {
+			log.Printf("error getting images: %v", err)
+			redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+			return
+		}
+		mostLiked[i].Base64Images = bookImages
+	}
+
+	now := time.Now()
+	pageVariables := PageRankingVariables{
+		Year:         now.Format("2006"),
+		SiteKey:      captcha.SiteKey,
+		MostLiked:    mostLiked,
+		Trending:     trending,
+		TrendingDays: days,
+	}
+
+	_, err = getCurrentUserID(r)
+	if err != nil {
+		pageVariables.LoggedIn = false
+	} else {
+		pageVariables.LoggedIn = true
+	}
+
+	templateDir := os.Getenv("TEMPLATE_DIR")
+	if templateDir == "" {
+		templateDir = "internal/template" // default value for local development
+	}
+	templatePath := filepath.Join(templateDir, "popular.html")
+
+	t, err := template.ParseFiles(templatePath)
+	if err != nil {
+		log.Printf("template error: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "template error", http.StatusInternalServerError)
+		return
+	}
+
+	err = t.Execute(w, pageVariables)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("template error: %v", err)
+		return
+	}
+}
+
+func PopularBooks(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	limit := parseRankingLimit(r.URL.Query().Get("limit"))
+	days := parseTrendingDays(r.URL.Query().Get("days"))
+
+	mostLiked, err := getMostLikedBooks(db, limit)
+	if err != nil {
+		log.Printf("error getting most liked books: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	trending, err := getTrendingBooks(db, days, limit)
+	if err != nil {
+		log.Printf("error getting trending books: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"most_liked":    mostLiked,
+		"trending":      trending,
+		"trending_days": days,
+	})
+}
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ReadingStatus mirrors the reading_status enum from the database.
+type ReadingStatus string
+
+const (
+	ToRead    ReadingStatus = "to_read"
+	Reading   ReadingStatus = "reading"
+	Read      ReadingStatus = "read"
+	Abandoned ReadingStatus = "abandoned"
+	Rereading ReadingStatus = "rereading"
+)
+
+// ReadingStatuses lists every status in the order they are offered in the forms.
+var ReadingStatuses = []ReadingStatus{ToRead, Reading, Read, Abandoned, Rereading}
+
+// readingProgressOrder is a SQL array with the statuses from the least to the most advanced, so an import does not
+// take a book back from "reading" to "to_read".
+const readingProgressOrder = `ARRAY['to_read', 'reading', 'abandoned', 'read', 'rereading']::reading_status[]`
+
+func (rs ReadingStatus) Label() string {
+	switch rs {
+	case ToRead:
+		return "Por leer"
+	case Reading:
+		return "Leyendo"
+	case Read:
+		return "Leído"
+	case Abandoned:
+		return "Abandonado"
+	case Rereading:
+		return "Releyendo"
+	default:
+		return "Desconocido"
+	}
+}
+
+// HasBeenRead keeps the old boolean semantic: the book was finished at least once.
+func (rs ReadingStatus) HasBeenRead() bool {
+	return rs == Read || rs == Rereading
+}
+
+func parseReadingStatus(input string) (ReadingStatus, error) {
+	status := ReadingStatus(strings.TrimSpace(strings.ToLower(input)))
+	for _, rs := range ReadingStatuses {
+		if rs == status {
+			return rs, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown reading status: %q", input)
+}
+
+// readingStatusFromLegacy maps the hasBeenRead flag used by the TOML file and the old forms.
+func readingStatusFromLegacy(hasBeenRead bool) ReadingStatus {
+	if hasBeenRead {
+		return Read
+	}
+
+	return ToRead
+}
+
+// resolveReadingStatus prefers an explicit status and falls back to the legacy hasBeenRead flag.
+func resolveReadingStatus(status string, hasBeenRead bool) (ReadingStatus, error) {
+	if strings.TrimSpace(status) == "" {
+		return readingStatusFromLegacy(hasBeenRead), nil
+	}
+
+	return parseReadingStatus(status)
+}
+
+func parseOptionalDate(input string) (sql.NullTime, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return sql.NullTime{}, nil
+	}
+
+	date, err := time.Parse("2006-01-02", input)
+	if err != nil {
+		return sql.NullTime{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", input)
+	}
+
+	return sql.NullTime{Time: date, Valid: true}, nil
+}
+
+func formatOptionalDate(date sql.NullTime) string {
+	if !date.Valid {
+		return ""
+	}
+
+	return date.Time.Format("2006-01-02")
+}
+
+type readingStatusForm struct {
+	Status     ReadingStatus
+	StartedOn  sql.NullTime
+	FinishedOn sql.NullTime
+}
+
+// parseReadingStatusForm reads the reading_status, started_on and finished_on fields shared by the add and modify forms.
+func parseReadingStatusForm(r *http.Request) (readingStatusForm, error) {
+	status, err := resolveReadingStatus(r.FormValue("reading_status"), r.FormValue("read") == "on")
+	if err != nil {
+		return readingStatusForm{}, err
+	}
+
+	startedOn, err := parseOptionalDate(r.FormValue("started_on"))
+	if err != nil {
+		return readingStatusForm{}, err
+	}
+
+	finishedOn, err := parseOptionalDate(r.FormValue("finished_on"))
+	if err != nil {
+		return readingStatusForm{}, err
+	}
+
+	if startedOn.Valid && finishedOn.Valid && finishedOn.Time.Before(startedOn.Time) {
+		return readingStatusForm{}, errors.New("finished_on cannot be before started_on")
+	}
+
+	return readingStatusForm{Status: status, StartedOn: startedOn, FinishedOn: finishedOn}, nil
+}
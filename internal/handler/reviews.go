@@ -0,0 +1,266 @@
+package handler
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+)
+
+const maxReviewLength = 10000
+
+var (
+	reviewMarkdown = goldmark.New()
+	reviewPolicy   = bluemonday.UGCPolicy()
+)
+
+type Review struct {
+	ID        int           `json:"id"`
+	BookID    int           `json:"book_id"`
+	UserID    string        `json:"-"`
+	UserName  string        `json:"user_name"`
+	Rating    float64       `json:"rating"`
+	Body      string        `json:"body"`
+	BodyHTML  template.HTML `json:"body_html"`
+	Hidden    bool          `json:"hidden"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+	CanEdit   bool          `json:"can_edit"`
+}
+
+type RatingSummary struct {
+	Average float64 `json:"average"`
+	Count   int     `json:"count"`
+}
+
+type reviewRequest struct {
+	Rating float64 `json:"rating"`
+	Body   string  `json:"body"`
+}
+
+type moderationRequest struct {
+	Hidden bool `json:"hidden"`
+}
+
+// renderReviewMarkdown converts the review body to HTML and strips anything outside the user generated content policy.
+func renderReviewMarkdown(body string) (template.HTML, error) {
+	var buf bytes.Buffer
+	if err := reviewMarkdown.Convert([]byte(body), &buf); err != nil {
+		return "", err
+	}
+
+	return template.HTML(reviewPolicy.SanitizeBytes(buf.Bytes())), nil
+}
+
+func validateReview(req reviewRequest) error {
+	if req.Rating < 1 || req.Rating > 5 {
+		return errors.New("rating must be between 1 and 5")
+	}
+
+	if req.Rating*2 != math.Trunc(req.Rating*2) {
+		return errors.New("rating must be a whole or half star")
+	}
+
+	if len(req.Body) > maxReviewLength {
+		return errors.New("review is too long")
+	}
+
+	return nil
+}
+
+// getReviewsByBookID returns the reviews of a book; hidden reviews are only included for admins.
+func getReviewsByBookID(db *sql.DB, bookID int, viewerID string, viewerIsAdmin bool) ([]Review, error) {
+	rows, err := db.Query(`SELECT r.review_id, r.book_id, r.user_id, COALESCE(u.name, ''), r.rating, r.body, r.hidden, r.created_at, r.updated_at
+		FROM book_reviews r
+		JOIN users u ON u.user_id = r.user_id
+		WHERE r.book_id = $1 AND (NOT r.hidden OR $2)
+		ORDER BY r.created_at DESC`, bookID, viewerIsAdmin)
+	if err != nil {
+		return []Review{}, err
+	}
+
+	defer rows.Close()
+
+	reviews := []Review{}
+	for rows.Next() {
+		var review Review
+		if err := rows.Scan(&review.ID, &review.BookID, &review.UserID, &review.UserName, &review.Rating, &review.Body, &review.Hidden, &review.CreatedAt, &review.UpdatedAt); err != nil {
+			return []Review{}, err
+		}
+
+		review.BodyHTML, err = renderReviewMarkdown(review.Body)
+		if err != nil {
+			return []Review{}, err
+		}
+		review.CanEdit = viewerID != "" && viewerID == review.UserID
+		reviews = append(reviews, review)
+	}
+
+	return reviews, rows.Err()
+}
+
+func getRatingSummary(db *sql.DB, bookID int) (RatingSummary, error) {
+	var summary RatingSummary
+	var average sql.NullFloat64
+
+	err := db.QueryRow("SELECT AVG(rating), COUNT(*) FROM book_reviews WHERE book_id = $1 AND NOT hidden", bookID).Scan(&average, &summary.Count)
+	if err != nil {
+		return RatingSummary{}, err
+	}
+
+	summary.Average = math.Round(average.Float64*10) / 10
+
+	return summary, nil
+}
+
+func parseReviewIDVar(r *http.Request) (int, error) {
+	return strconv.Atoi(mux.Vars(r)["review_id"])
+}
+
+func BookReviews(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	bookID, err := parseBookIDVar(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID, _ := getCurrentUserID(r)
+
+	reviews, err := getReviewsByBookID(db, bookID, userID, isAdmin(db, r))
+	if err != nil {
+		log.Printf("error getting reviews: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	summary, err := getRatingSummary(db, bookID)
+	if err != nil {
+		log.Printf("error getting rating summary: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"rating":  summary,
+		"reviews": reviews,
+	})
+}
+
+// SaveReview creates the review of the current user for a book or replaces it if it already exists.
+func SaveReview(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	userID, err := getCurrentUserID(r)
+	if err != nil {
+		writeUnauthenticated(w)
+		return
+	}
+
+	bookID, err := parseBookIDVar(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req reviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Error al decodificar el cuerpo de la solicitud", http.StatusBadRequest)
+		return
+	}
+	req.Body = strings.TrimSpace(req.Body)
+
+	if err := validateReview(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var reviewID int
+	err = db.QueryRow(`INSERT INTO book_reviews(book_id, user_id, rating, body)
+		VALUES($1, $2, $3, $4)
+		ON CONFLICT(book_id, user_id) DO UPDATE
+		SET rating = EXCLUDED.rating, body = EXCLUDED.body, updated_at = NOW()
+		RETURNING review_id`, bookID, userID, req.Rating, req.Body).Scan(&reviewID)
+	if err != nil {
+		log.Printf("error saving review: %v", err)
+		http.Error(w, "Error al guardar la reseña", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"status": "OK", "review_id": reviewID})
+}
+
+// DeleteReview removes a review; only its author or an admin can do it.
+func DeleteReview(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	userID, err := getCurrentUserID(r)
+	if err != nil {
+		writeUnauthenticated(w)
+		return
+	}
+
+	reviewID, err := parseReviewIDVar(r)
+	if err != nil {
+		http.Error(w, "Invalid review_id", http.StatusBadRequest)
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM book_reviews WHERE review_id = $1 AND (user_id = $2 OR $3)", reviewID, userID, isAdmin(db, r))
+	if err != nil {
+		log.Printf("error deleting review: %v", err)
+		http.Error(w, "Error al borrar la reseña", http.StatusInternalServerError)
+		return
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		http.Error(w, "Review not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "OK"})
+}
+
+// ModerateReview hides or shows a review. Hidden reviews do not count for the average rating.
+func ModerateReview(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can moderate reviews", http.StatusForbidden)
+		return
+	}
+
+	reviewID, err := parseReviewIDVar(r)
+	if err != nil {
+		http.Error(w, "Invalid review_id", http.StatusBadRequest)
+		return
+	}
+
+	var req moderationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Error al decodificar el cuerpo de la solicitud", http.StatusBadRequest)
+		return
+	}
+
+	result, err := db.Exec("UPDATE book_reviews SET hidden = $1 WHERE review_id = $2", req.Hidden, reviewID)
+	if err != nil {
+		log.Printf("error moderating review: %v", err)
+		http.Error(w, "Error al moderar la reseña", http.StatusInternalServerError)
+		return
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		http.Error(w, "Review not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "OK"})
+}
@@ -0,0 +1,439 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+var errRevisionNotFound = errors.New("revision not found")
+
+// revisionData is a saved version of a book. On top of what the audit log records, it keeps the ids needed to put
+// the location and genres back.
+type revisionData struct {
+	auditBook
+	LocationID int   `json:"location_id,omitempty"`
+	GenreIDs   []int `json:"genre_ids,omitempty"`
+}
+
+type BookRevision struct {
+	ID           int                    `json:"id"`
+	BookID       int                    `json:"book_id"`
+	Revision     int                    `json:"revision"`
+	Editor       string                 `json:"editor,omitempty"`
+	RevertedFrom int                    `json:"reverted_from,omitempty"`
+	CreatedAt    time.Time              `json:"created_at"`
+	Changes      map[string]AuditChange `json:"changes"`
+	Current      bool                   `json:"current"`
+	data         revisionData
+}
+
+// Fields returns the changes from the previous revision ordered by field name.
+func (br BookRevision) Fields() []AuditField {
+	return AuditEntry{Changes: br.Changes}.Fields()
+}
+
+func revisionFromBook(book BookInfo) revisionData {
+	data := revisionData{auditBook: auditBookFromInfo(book), LocationID: book.LocationID}
+	// A revert leaves the images alone, so they are not part of the revision.
+	data.Images = 0
+	for _, genre := range book.Genres {
+		data.GenreIDs = append(data.GenreIDs, genre.ID)
+	}
+
+	return data
+}
+
+// saveBookRevision stores after as the next revision of the book, inside the transaction that changed it. The first
+// time a book is edited, before is stored as revision 1 so the original version can be restored too.
+func saveBookRevision(tx *sql.Tx, editor sql.NullString, before, after BookInfo, revertedFrom int) error {
+	beforeData, afterData := revisionFromBook(before), revisionFromBook(after)
+	if revertedFrom == 0 && reflect.DeepEqual(beforeData, afterData) {
+		return nil
+	}
+
+	// Locking the book keeps two edits from taking the same revision number.
+	if _, err := tx.Exec("SELECT id FROM books WHERE id = $1 FOR UPDATE", after.ID); err != nil {
+		return err
+	}
+
+	var last int
+	if err := tx.QueryRow("SELECT COALESCE(MAX(revision), 0) FROM book_revisions WHERE book_id = $1", after.ID).Scan(&last); err != nil {
+		return err
+	}
+
+	if last == 0 {
+		if err := insertBookRevision(tx, after.ID, 1, beforeData, sql.NullString{}, 0); err != nil {
+			return err
+		}
+		last = 1
+	}
+
+	return insertBookRevision(tx, after.ID, last+1, afterData, editor, revertedFrom)
+}
+
+func insertBookRevision(q execer, bookID, revision int, data revisionData, editor sql.NullString, revertedFrom int) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.Exec(`INSERT INTO book_revisions(book_id, revision, data, editor_user_id, reverted_from)
+		VALUES($1, $2, $3, $4, $5)`, bookID, revision, encoded, editor, nullableInt(revertedFrom))
+
+	return err
+}
+
+// recordBookEditIn stores the new version of the book as a revision and records the change in the audit log, inside
+// the transaction that changed the book. actor is the user the change is recorded for.
+func recordBookEditIn(tx *sql.Tx, actor sql.NullString, action AuditAction, before BookInfo, revertedFrom int) error {
+	after, err := getBookDetails(tx, before.ID)
+	if err != nil {
+		return err
+	}
+
+	recordAuditAs(tx, actor, action, AuditBook, before.ID, auditBookFromInfo(before), auditBookFromInfo(after))
+
+	return saveBookRevision(tx, actor, before, after, revertedFrom)
+}
+
+// recordBookEdit is recordBookEditIn for a change that is already committed.
+func recordBookEdit(db *sql.DB, r *http.Request, action AuditAction, before BookInfo, revertedFrom int) {
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("error saving the history of book %d: %v", before.ID, err)
+		return
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if err := recordBookEditIn(tx, auditActor(r), action, before, revertedFrom); err != nil {
+		log.Printf("error saving the history of book %d: %v", before.ID, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("error saving the history of book %d: %v", before.ID, err)
+	}
+}
+
+// getBookRevisions returns the revisions of the book, the latest first, each one with its changes from the one
+// before.
+func getBookRevisions(db *sql.DB, bookID int) ([]BookRevision, error) {
+	rows, err := db.Query(`SELECT r.id, r.book_id, r.revision, COALESCE(u.name, u.email, ''), COALESCE(r.reverted_from, 0),
+			r.created_at, r.data
+		FROM book_revisions r
+		LEFT JOIN users u ON u.user_id = r.editor_user_id
+		WHERE r.book_id = $1
+		ORDER BY r.revision`, bookID)
+	if err != nil {
+		return []BookRevision{}, err
+	}
+
+	defer rows.Close()
+
+	var revisions []BookRevision
+	for rows.Next() {
+		var revision BookRevision
+		var data []byte
+		if err := rows.Scan(&revision.ID, &revision.BookID, &revision.Revision, &revision.Editor, &revision.RevertedFrom,
+			&revision.CreatedAt, &data); err != nil {
+			return []BookRevision{}, err
+		}
+		if err := json.Unmarshal(data, &revision.data); err != nil {
+			return []BookRevision{}, err
+		}
+		// Older revisions still have the image count.
+		revision.data.Images = 0
+
+		var previous interface{}
+		if len(revisions) > 0 {
+			previous = revisions[len(revisions)-1].data.auditBook
+		}
+		if revision.Changes, err = auditDiff(previous, revision.data.auditBook); err != nil {
+			return []BookRevision{}, err
+		}
+		if previous == nil {
+			// The first revision is the original book, not a change.
+			revision.Changes = map[string]AuditChange{}
+		}
+
+		revisions = append(revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		return []BookRevision{}, err
+	}
+
+	history := make([]BookRevision, 0, len(revisions))
+	for i := len(revisions) - 1; i >= 0; i-- {
+		history = append(history, revisions[i])
+	}
+	if len(history) > 0 {
+		history[0].Current = true
+	}
+
+	return history, nil
+}
+
+func getBookRevision(db *sql.DB, bookID, revision int) (revisionData, error) {
+	var encoded []byte
+	err := db.QueryRow("SELECT data FROM book_revisions WHERE book_id = $1 AND revision = $2", bookID, revision).Scan(&encoded)
+	if errors.Is(err, sql.ErrNoRows) {
+		return revisionData{}, errRevisionNotFound
+	}
+	if err != nil {
+		return revisionData{}, err
+	}
+
+	var data revisionData
+	if err := json.Unmarshal(encoded, &data); err != nil {
+		return revisionData{}, err
+	}
+
+	return data, nil
+}
+
+// existingIDs keeps the ids that are still in the table, so a revert skips the genres and locations deleted since.
+func existingIDs(db querier, table string, ids []int) ([]int, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT id FROM %s WHERE id = ANY($1) ORDER BY id", table), pq.Array(ids))
+	if err != nil {
+		return []int{}, err
+	}
+
+	defer rows.Close()
+
+	existing := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return []int{}, err
+		}
+		existing = append(existing, id)
+	}
+
+	return existing, rows.Err()
+}
+
+// applyBookRevision puts the book back as it was in the revision, all at once, and saves the result as a new revision
+// for actor. The images are not part of the revisions.
+func applyBookRevision(db *sql.DB, actor sql.NullString, before BookInfo, revision int, data revisionData) error {
+	bookID := before.ID
+
+	status, err := parseReadingStatus(data.ReadingStatus)
+	if err != nil {
+		return err
+	}
+
+	startedOn, err := parseOptionalDate(data.StartedOn)
+	if err != nil {
+		return err
+	}
+
+	finishedOn, err := parseOptionalDate(data.FinishedOn)
+	if err != nil {
+		return err
+	}
+
+	tags, err := parseTagList(strings.Join(data.Tags, ","))
+	if err != nil {
+		return err
+	}
+
+	acquisition, err := acquisitionFromBook(BookInfo{
+		PurchasedOn:   data.PurchasedOn,
+		PurchasePrice: Price(data.PurchasePrice),
+		Currency:      data.Currency,
+		Store:         data.Store,
+		GiftFrom:      data.GiftFrom,
+	})
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	workIDs, err := existingIDs(tx, "works", []int{data.WorkID})
+	if err != nil {
+		return err
+	}
+	workID := data.WorkID
+	if len(workIDs) == 0 {
+		if workID, err = findOrCreateWork(tx, data.Title, data.Author); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`UPDATE books SET
+			title = $1,
+			author = $2,
+			description = $3,
+			isbn_10 = $4,
+			isbn_13 = $5,
+			publisher = $6,
+			published_year = $7,
+			page_count = $8,
+			translator = $9,
+			format = $10,
+			language = $11,
+			reading_status = $12,
+			started_on = $13,
+			finished_on = $14,
+			goodreads_link = $15,
+			work_id = $16
+		WHERE id = $17 AND deleted_at IS NULL`,
+		data.Title, data.Author, data.Description, nullableString(data.ISBN10), nullableString(data.ISBN13),
+		nullableString(data.Publisher), nullableInt(data.PublishedYear), nullableInt(data.PageCount),
+		nullableString(data.Translator), nullableString(data.Format), nullableString(data.Language),
+		status, startedOn, finishedOn, data.GoodreadsLink, workID, bookID)
+	if err != nil {
+		return err
+	}
+
+	if err := replaceAuthorAndTranslatorCredits(tx, bookID, data.Author, data.Translator); err != nil {
+		return err
+	}
+
+	if err := replaceBookTags(tx, bookID, tags); err != nil {
+		return err
+	}
+
+	genreIDs, err := existingIDs(tx, "genres", data.GenreIDs)
+	if err != nil {
+		return err
+	}
+	if err := replaceBookGenres(tx, bookID, genreIDs); err != nil {
+		return err
+	}
+
+	position := sql.NullFloat64{Float64: data.SeriesPosition, Valid: data.SeriesPosition > 0}
+	if err := setBookSeries(tx, bookID, data.Series, position); err != nil {
+		return err
+	}
+
+	locationIDs, err := existingIDs(tx, "locations", []int{data.LocationID})
+	if err != nil {
+		return err
+	}
+	var locationID sql.NullInt64
+	if len(locationIDs) > 0 {
+		locationID = sql.NullInt64{Int64: int64(locationIDs[0]), Valid: true}
+	}
+	if err := setBookLocation(tx, bookID, locationID); err != nil {
+		return err
+	}
+
+	if err := setBookAcquisition(tx, bookID, acquisition); err != nil {
+		return err
+	}
+
+	if err := deleteOrphanWorks(tx); err != nil {
+		return err
+	}
+
+	if err := recordBookEditIn(tx, actor, AuditRevert, before, revision); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func parseRevisionVars(r *http.Request) (int, int, error) {
+	bookID, err := parseBookIDVar(r)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	revision, err := strconv.Atoi(mux.Vars(r)["revision"])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid revision: %v", err)
+	}
+
+	return bookID, revision, nil
+}
+
+func BookRevisions(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can see the history of a book", http.StatusForbidden)
+		return
+	}
+
+	bookID, err := parseBookIDVar(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	revisions, err := getBookRevisions(db, bookID)
+	if err != nil {
+		log.Printf("error getting book revisions: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(revisions)
+}
+
+// RevertBook restores an older revision of the book; the result is saved as a new revision, so a revert can be
+// reverted too.
+func RevertBook(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can revert a book", http.StatusForbidden)
+		return
+	}
+
+	bookID, revision, err := parseRevisionVars(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data, err := getBookRevision(db, bookID, revision)
+	if errors.Is(err, errRevisionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeErrorGeneralStatus(w, err)
+		return
+	}
+
+	before, err := getBookDetails(db, bookID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Book not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeErrorGeneralStatus(w, err)
+		return
+	}
+
+	err = applyBookRevision(db, auditActor(r), before, revision, data)
+	if isUniqueViolation(err) {
+		http.Error(w, "Ya existe otro libro con ese ISBN", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeErrorGeneralStatus(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
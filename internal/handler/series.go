@@ -0,0 +1,425 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"leonlib/internal/captcha"
+
+	"github.com/gorilla/mux"
+)
+
+// maxSeriesPosition is the largest value that fits in books.series_position.
+const maxSeriesPosition = 9999.99
+
+// SeriesPosition is the place of a book in the reading order of its series. It can be fractional, as 1.5 for a
+// novella published between the first and second volumes.
+type SeriesPosition float64
+
+type Series struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Slug        string `json:"slug"`
+	Description string `json:"description"`
+	BookCount   int    `json:"book_count"`
+}
+
+// SeriesBook is a book of a series together with the reading status of the current user, empty when the user
+// has not started it or is not logged in.
+type SeriesBook struct {
+	Book     BookInfo
+	Position SeriesPosition
+	Status   ReadingStatus
+}
+
+type PageSeriesIndexVariables struct {
+	Year     string
+	SiteKey  string
+	Series   []Series
+	LoggedIn bool
+}
+
+type PageSeriesVariables struct {
+	Year     string
+	SiteKey  string
+	Series   Series
+	Books    []SeriesBook
+	LoggedIn bool
+}
+
+// UnmarshalTOML accepts both seriesPosition = 2 and seriesPosition = 1.5 in books_db.toml.
+func (sp *SeriesPosition) UnmarshalTOML(data interface{}) error {
+	var position float64
+	switch value := data.(type) {
+	case int64:
+		position = float64(value)
+	case float64:
+		position = value
+	default:
+		return fmt.Errorf("invalid series position: %v", data)
+	}
+
+	if position <= 0 || position > maxSeriesPosition {
+		return fmt.Errorf("series position out of range: %v", position)
+	}
+
+	*sp = SeriesPosition(position)
+	return nil
+}
+
+// String formats the position without trailing zeros, so 2 is shown as "2" and 1.5 as "1.5".
+func (sp SeriesPosition) String() string {
+	if sp == 0 {
+		return ""
+	}
+
+	return strconv.FormatFloat(float64(sp), 'f', -1, 64)
+}
+
+func (sb SeriesBook) StatusLabel() string {
+	if sb.Status == "" {
+		return "Sin empezar"
+	}
+
+	return sb.Status.Label()
+}
+
+func parseSeriesPosition(input string) (sql.NullFloat64, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return sql.NullFloat64{}, nil
+	}
+
+	position, err := strconv.ParseFloat(input, 64)
+	if err != nil || position <= 0 || position > maxSeriesPosition {
+		return sql.NullFloat64{}, fmt.Errorf("invalid series_position: %q", input)
+	}
+
+	return sql.NullFloat64{Float64: math.Round(position*100) / 100, Valid: true}, nil
+}
+
+// findOrCreateSeries returns the series whose slug matches the name, creating it if needed.
+func findOrCreateSeries(q queryRower, name string) (int, error) {
+	name = strings.TrimSpace(name)
+	slug := slugify(name)
+	if slug == "" {
+		return 0, fmt.Errorf("invalid series name: %q", name)
+	}
+
+	var seriesID int
+	err := q.QueryRow(`INSERT INTO series(name, slug) VALUES($1, $2)
+		ON CONFLICT (slug) DO UPDATE SET name = series.name
+		RETURNING id`, name, slug).Scan(&seriesID)
+
+	return seriesID, err
+}
+
+// setBookSeries puts the book in the named series, or takes it out of its series when name is empty.
+func setBookSeries(db sqlExecutor, bookID int, name string, position sql.NullFloat64) error {
+	if strings.TrimSpace(name) == "" {
+		if position.Valid {
+			return errors.New("series_position requires a series")
+		}
+
+		if _, err := db.Exec("UPDATE books SET series_id = NULL, series_position = NULL WHERE id = $1", bookID); err != nil {
+			return err
+		}
+
+		return deleteOrphanSeries(db)
+	}
+
+	seriesID, err := findOrCreateSeries(db, name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := db.Exec("UPDATE books SET series_id = $1, series_position = $2 WHERE id = $3", seriesID, position, bookID); err != nil {
+		return err
+	}
+
+	return deleteOrphanSeries(db)
+}
+
+func deleteOrphanSeries(db execer) error {
+	_, err := db.Exec("DELETE FROM series s WHERE NOT EXISTS (SELECT 1 FROM books b WHERE b.series_id = s.id)")
+
+	return err
+}
+
+// getBookSeries fills the series fields of the book, leaving them empty when the book is not part of a series.
+func getBookSeries(db querier, book *BookInfo) error {
+	var position sql.NullFloat64
+	err := db.QueryRow(`SELECT s.name, s.slug, b.series_position
+		FROM books b
+		JOIN series s ON s.id = b.series_id
+		WHERE b.id = $1`, book.ID).Scan(&book.Series, &book.SeriesSlug, &position)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	book.SeriesPosition = SeriesPosition(position.Float64)
+	return nil
+}
+
+func getAllSeries(db *sql.DB) ([]Series, error) {
+	rows, err := db.Query(`SELECT s.id, s.name, s.slug, COALESCE(s.description, ''), COUNT(b.id)
+		FROM series s
+		JOIN books b ON b.series_id = s.id AND b.deleted_at IS NULL
+		GROUP BY s.id
+		ORDER BY s.slug`)
+	if err != nil {
+		return []Series{}, err
+	}
+
+	defer rows.Close()
+
+	var series []Series
+	for rows.Next() {
+		var s Series
+		if err := rows.Scan(&s.ID, &s.Name, &s.Slug, &s.Description, &s.BookCount); err != nil {
+			return []Series{}, err
+		}
+		series = append(series, s)
+	}
+
+	return series, rows.Err()
+}
+
+func getSeriesBySlug(db *sql.DB, slug string) (Series, error) {
+	var s Series
+	err := db.QueryRow(`SELECT s.id, s.name, s.slug, COALESCE(s.description, ''),
+			(SELECT COUNT(*) FROM books b WHERE b.series_id = s.id AND b.deleted_at IS NULL)
+		FROM series s
+		WHERE s.slug = $1`, slug).Scan(&s.ID, &s.Name, &s.Slug, &s.Description, &s.BookCount)
+
+	return s, err
+}
+
+// getSeriesBooks returns the books of the series in reading order; books without a position go last.
+func getSeriesBooks(db *sql.DB, seriesID int, userID string) ([]SeriesBook, error) {
+	rows, err := db.Query(`SELECT `+bookColumns+`, b.series_position, ub.status
+		FROM books b
+		LEFT JOIN user_books ub ON ub.book_id = b.id AND ub.user_id = $2
+		WHERE b.series_id = $1 AND b.deleted_at IS NULL
+		ORDER BY b.series_position NULLS LAST, b.published_year, b.title`, seriesID, userID)
+	if err != nil {
+		return []SeriesBook{}, err
+	}
+
+	defer rows.Close()
+
+	var books []SeriesBook
+	for rows.Next() {
+		var position sql.NullFloat64
+		var status sql.NullString
+		bookInfo, err := scanBookInfo(rows, &position, &status)
+		if err != nil {
+			return []SeriesBook{}, err
+		}
+
+		books = append(books, SeriesBook{
+			Book:     bookInfo,
+			Position: SeriesPosition(position.Float64),
+			Status:   ReadingStatus(status.String),
+		})
+	}
+
+	return books, rows.Err()
+}
+
+// getNextInSeries returns the books at the first position after the given book that the user has not read yet.
+// There can be more than one when the library has several editions of the same volume.
+func getNextInSeries(db *sql.DB, book BookInfo, userID string) ([]BookInfo, error) {
+	if book.SeriesSlug == "" || book.SeriesPosition == 0 {
+		return []BookInfo{}, nil
+	}
+
+	rows, err := db.Query(`SELECT `+bookColumns+`, b.series_position
+		FROM books b
+		JOIN books current ON current.series_id = b.series_id
+		LEFT JOIN user_books ub ON ub.book_id = b.id AND ub.user_id = $2
+		WHERE current.id = $1
+		  AND b.deleted_at IS NULL
+		  AND b.series_position > current.series_position
+		  AND (ub.status IS NULL OR ub.status NOT IN ('read', 'rereading'))
+		ORDER BY b.series_position, b.title`, book.ID, userID)
+	if err != nil {
+		return []BookInfo{}, err
+	}
+
+	defer rows.Close()
+
+	var next []BookInfo
+	var nextPosition float64
+	for rows.Next() {
+		var position float64
+		bookInfo, err := scanBookInfo(rows, &position)
+		if err != nil {
+			return []BookInfo{}, err
+		}
+
+		if len(next) > 0 && position != nextPosition {
+			break
+		}
+
+		bookInfo.SeriesPosition = SeriesPosition(position)
+		nextPosition = position
+		next = append(next, bookInfo)
+	}
+
+	return next, rows.Err()
+}
+
+func SeriesIndexPage(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	series, err := getAllSeries(db)
+	if err != nil {
+		log.Printf("error getting series: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	pageVariables := PageSeriesIndexVariables{
+		Year:    now.Format("2006"),
+		SiteKey: captcha.SiteKey,
+		Series:  series,
+	}
+
+	_, err = getCurrentUserID(r)
+	pageVariables.LoggedIn = err == nil
+
+	templateDir := os.Getenv("TEMPLATE_DIR")
+	if templateDir == "" {
+		templateDir = "internal/template" // default value for local development
+	}
+	templatePath := filepath.Join(templateDir, "series_index.html")
+
+	t, err := template.ParseFiles(templatePath)
+	if err != nil {
+		log.Printf("template error: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "template error", http.StatusInternalServerError)
+		return
+	}
+
+	err = t.Execute(w, pageVariables)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("template error: %v", err)
+		return
+	}
+}
+
+func SeriesPage(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	series, err := getSeriesBySlug(db, slugify(mux.Vars(r)["slug"]))
+	if errors.Is(err, sql.ErrNoRows) {
+		redirectToErrorPageWithMessageAndStatusCode(w, "Series not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("error getting series: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	userID, err := getCurrentUserID(r)
+	loggedIn := err == nil
+
+	books, err := getSeriesBooks(db, series.ID, userID)
+	if err != nil {
+		log.Printf("error getting series books: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	pageVariables := PageSeriesVariables{
+		Year:     now.Format("2006"),
+		SiteKey:  captcha.SiteKey,
+		Series:   series,
+		Books:    books,
+		LoggedIn: loggedIn,
+	}
+
+	templateDir := os.Getenv("TEMPLATE_DIR")
+	if templateDir == "" {
+		templateDir = "internal/template" // default value for local development
+	}
+	templatePath := filepath.Join(templateDir, "series.html")
+
+	t, err := template.ParseFiles(templatePath)
+	if err != nil {
+		log.Printf("template error: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "template error", http.StatusInternalServerError)
+		return
+	}
+
+	err = t.Execute(w, pageVariables)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("template error: %v", err)
+		return
+	}
+}
+
+// SeriesInfo returns the reading order of a series, with the status of the current user for every book.
+func SeriesInfo(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	series, err := getSeriesBySlug(db, slugify(mux.Vars(r)["slug"]))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Series not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	userID, _ := getCurrentUserID(r)
+	books, err := getSeriesBooks(db, series.ID, userID)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	type SeriesBookDetail struct {
+		ID       int           `json:"id"`
+		Title    string        `json:"title"`
+		Author   string        `json:"author"`
+		Position *float64      `json:"position"`
+		Status   ReadingStatus `json:"status,omitempty"`
+	}
+
+	results := []SeriesBookDetail{}
+	for _, book := range books {
+		detail := SeriesBookDetail{
+			ID:     book.Book.ID,
+			Title:  book.Book.Title,
+			Author: book.Book.Author,
+			Status: book.Status,
+		}
+		if book.Position != 0 {
+			position := float64(book.Position)
+			detail.Position = &position
+		}
+		results = append(results, detail)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"series": series,
+		"books":  results,
+	})
+}
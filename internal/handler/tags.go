@@ -0,0 +1,484 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"leonlib/internal/captcha"
+
+	"github.com/gorilla/mux"
+)
+
+const maxTagLength = 100
+
+// Tag is a free-form label. It can be decoded from the tags = [...] list of books_db.toml.
+type Tag struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Slug      string `json:"slug"`
+	BookCount int    `json:"book_count"`
+}
+
+// Genre belongs to the curated taxonomy. Path holds the names from the root, e.g. "Ficción > Novela histórica".
+type Genre struct {
+	ID        int    `json:"id"`
+	ParentID  *int   `json:"parent_id"`
+	Name      string `json:"name"`
+	Slug      string `json:"slug"`
+	Path      string `json:"path"`
+	Depth     int    `json:"depth"`
+	BookCount int    `json:"book_count"`
+	Selected  bool   `json:"-"`
+}
+
+type PageTagsVariables struct {
+	Year     string
+	SiteKey  string
+	Tags     []Tag
+	Genres   []Genre
+	LoggedIn bool
+}
+
+type PageTagVariables struct {
+	Year      string
+	SiteKey   string
+	Kind      string
+	Name      string
+	Slug      string
+	Subgenres []Genre
+	Results   []BookInfo
+	LoggedIn  bool
+}
+
+func (t *Tag) UnmarshalText(text []byte) error {
+	tag, err := newTag(string(text))
+	if err != nil {
+		return err
+	}
+
+	*t = tag
+	return nil
+}
+
+// UnmarshalText reads a genre of books_db.toml, written as its slug or its name. Only the slug is set; the genre is
+// looked up when the book is imported.
+func (g *Genre) UnmarshalText(text []byte) error {
+	slug := slugify(string(text))
+	if slug == "" {
+		return fmt.Errorf("invalid genre: %q", text)
+	}
+
+	*g = Genre{Slug: slug}
+	return nil
+}
+
+func newTag(name string) (Tag, error) {
+	name = strings.TrimSpace(name)
+	if len(name) > maxTagLength {
+		return Tag{}, fmt.Errorf("tag is too long: %q", name)
+	}
+
+	slug := slugify(name)
+	if slug == "" {
+		return Tag{}, fmt.Errorf("invalid tag: %q", name)
+	}
+
+	return Tag{Name: name, Slug: slug}, nil
+}
+
+// parseTagList reads the comma separated tags of the modify form, ignoring empty and repeated ones.
+func parseTagList(input string) ([]Tag, error) {
+	var tags []Tag
+	seen := map[string]bool{}
+	for _, name := range strings.Split(input, ",") {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+
+		tag, err := newTag(name)
+		if err != nil {
+			return []Tag{}, err
+		}
+
+		if !seen[tag.Slug] {
+			seen[tag.Slug] = true
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags, nil
+}
+
+func parseGenreIDs(values []string) ([]int, error) {
+	var genreIDs []int
+	for _, value := range values {
+		genreID, err := strconv.Atoi(value)
+		if err != nil {
+			return []int{}, fmt.Errorf("invalid genre: %q", value)
+		}
+		genreIDs = append(genreIDs, genreID)
+	}
+
+	return genreIDs, nil
+}
+
+// genreSubtree returns a query with the ids of the genre whose slug is param and of all its subgenres.
+func genreSubtree(param string) string {
+	return `WITH RECURSIVE subtree AS (
+			SELECT id FROM genres WHERE slug = ` + param + `
+			UNION ALL
+			SELECT g.id FROM genres g JOIN subtree s ON g.parent_id = s.id
+		) SELECT id FROM subtree`
+}
+
+// replaceBookTags replaces the tags of a book inside the transaction of the caller; tags no book uses anymore are
+// deleted.
+func replaceBookTags(tx sqlExecutor, bookID int, tags []Tag) error {
+	if _, err := tx.Exec("DELETE FROM book_tags WHERE book_id = $1", bookID); err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		var tagID int
+		err := tx.QueryRow(`INSERT INTO tags(name, slug) VALUES($1, $2)
+			ON CONFLICT (slug) DO UPDATE SET name = tags.name
+			RETURNING id`, tag.Name, tag.Slug).Scan(&tagID)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec("INSERT INTO book_tags(book_id, tag_id) VALUES($1, $2) ON CONFLICT DO NOTHING", bookID, tagID); err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.Exec("DELETE FROM tags t WHERE NOT EXISTS (SELECT 1 FROM book_tags bt WHERE bt.tag_id = t.id)")
+
+	return err
+}
+
+// replaceBookGenres replaces the genres of a book inside the transaction of the caller.
+func replaceBookGenres(tx execer, bookID int, genreIDs []int) error {
+	if _, err := tx.Exec("DELETE FROM book_genres WHERE book_id = $1", bookID); err != nil {
+		return err
+	}
+
+	for _, genreID := range genreIDs {
+		if _, err := tx.Exec("INSERT INTO book_genres(book_id, genre_id) VALUES($1, $2) ON CONFLICT DO NOTHING", bookID, genreID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func getBookTags(db querier, bookID int) ([]Tag, error) {
+	rows, err := db.Query(`SELECT t.id, t.name, t.slug
+		FROM book_tags bt
+		JOIN tags t ON t.id = bt.tag_id
+		WHERE bt.book_id = $1
+		ORDER BY t.slug`, bookID)
+	if err != nil {
+		return []Tag{}, err
+	}
+
+	defer rows.Close()
+
+	var tags []Tag
+	for rows.Next() {
+		var tag Tag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Slug); err != nil {
+			return []Tag{}, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// getAllTags returns the tags used by at least one book, with the number of books of each one.
+func getAllTags(db *sql.DB) ([]Tag, error) {
+	rows, err := db.Query(`SELECT t.id, t.name, t.slug, COUNT(*)
+		FROM tags t
+		JOIN book_tags bt ON bt.tag_id = t.id
+		JOIN books b ON b.id = bt.book_id AND b.deleted_at IS NULL
+		GROUP BY t.id
+		ORDER BY t.slug`)
+	if err != nil {
+		return []Tag{}, err
+	}
+
+	defer rows.Close()
+
+	var tags []Tag
+	for rows.Next() {
+		var tag Tag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Slug, &tag.BookCount); err != nil {
+			return []Tag{}, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// getGenreTree returns the taxonomy depth first, so every genre comes right after its parent. When bookID is not
+// zero, the genres of that book are marked as selected.
+func getGenreTree(db querier, bookID int) ([]Genre, error) {
+	rows, err := db.Query(`WITH RECURSIVE tree AS (
+			SELECT g.id, g.parent_id, g.name, g.slug, g.name::TEXT AS path, 0 AS depth, ARRAY[g.name::TEXT] AS sort_path
+			FROM genres g WHERE g.parent_id IS NULL
+			UNION ALL
+			SELECT g.id, g.parent_id, g.name, g.slug, t.path || ' > ' || g.name, t.depth + 1, t.sort_path || g.name::TEXT
+			FROM genres g JOIN tree t ON g.parent_id = t.id
+		)
+		SELECT t.id, t.parent_id, t.name, t.slug, t.path, t.depth,
+			(SELECT COUNT(*) FROM book_genres bg JOIN books b ON b.id = bg.book_id WHERE bg.genre_id = t.id AND b.deleted_at IS NULL),
+			EXISTS (SELECT 1 FROM book_genres bg WHERE bg.genre_id = t.id AND bg.book_id = $1)
+		FROM tree t
+		ORDER BY t.sort_path`, bookID)
+	if err != nil {
+		return []Genre{}, err
+	}
+
+	defer rows.Close()
+
+	var genres []Genre
+	for rows.Next() {
+		var genre Genre
+		var parentID sql.NullInt64
+		if err := rows.Scan(&genre.ID, &parentID, &genre.Name, &genre.Slug, &genre.Path, &genre.Depth, &genre.BookCount, &genre.Selected); err != nil {
+			return []Genre{}, err
+		}
+
+		if parentID.Valid {
+			id := int(parentID.Int64)
+			genre.ParentID = &id
+		}
+		genres = append(genres, genre)
+	}
+
+	return genres, rows.Err()
+}
+
+func getBookGenres(db querier, bookID int) ([]Genre, error) {
+	genres, err := getGenreTree(db, bookID)
+	if err != nil {
+		return []Genre{}, err
+	}
+
+	var selected []Genre
+	for _, genre := range genres {
+		if genre.Selected {
+			selected = append(selected, genre)
+		}
+	}
+
+	return selected, nil
+}
+
+// IndentedName is used in the genre select to show the hierarchy.
+func (g Genre) IndentedName() string {
+	return strings.Repeat("— ", g.Depth) + g.Name
+}
+
+func getBooksByFilter(db *sql.DB, filter bookFilter) ([]BookInfo, error) {
+	rows, err := db.Query(`SELECT `+bookColumns+` FROM books b WHERE `+bookFilterConditions(1)+` ORDER BY b.title`,
+		filter.args()...)
+	if err != nil {
+		return []BookInfo{}, err
+	}
+
+	defer rows.Close()
+
+	var books []BookInfo
+	for rows.Next() {
+		bookInfo, err := scanBookInfo(rows)
+		if err != nil {
+			return []BookInfo{}, err
+		}
+
+		bookImages, err := getImagesByBookID(db, bookInfo.ID)
+		if err != nil {
+			return []BookInfo{}, err
+		}
+		bookInfo.Base64Images = bookImages
+
+		books = append(books, bookInfo)
+	}
+
+	return books, rows.Err()
+}
+
+func renderTagTemplate(w http.ResponseWriter, name string, pageVariables interface{}) {
+	templateDir := os.Getenv("TEMPLATE_DIR")
+	if templateDir == "" {
+		templateDir = "internal/template" // default value for local development
+	}
+	templatePath := filepath.Join(templateDir, name)
+
+	t, err := template.ParseFiles(templatePath)
+	if err != nil {
+		log.Printf("template error: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "template error", http.StatusInternalServerError)
+		return
+	}
+
+	err = t.Execute(w, pageVariables)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("template error: %v", err)
+		return
+	}
+}
+
+func TagsPage(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	tags, err := getAllTags(db)
+	if err != nil {
+		log.Printf("error getting tags: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	genres, err := getGenreTree(db, 0)
+	if err != nil {
+		log.Printf("error getting genres: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	pageVariables := PageTagsVariables{
+		Year:    now.Format("2006"),
+		SiteKey: captcha.SiteKey,
+		Tags:    tags,
+		Genres:  genres,
+	}
+
+	_, err = getCurrentUserID(r)
+	pageVariables.LoggedIn = err == nil
+
+	renderTagTemplate(w, "tags.html", pageVariables)
+}
+
+func TagPage(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	slug := slugify(mux.Vars(r)["tag"])
+
+	var name string
+	err := db.QueryRow("SELECT name FROM tags WHERE slug = $1", slug).Scan(&name)
+	if errors.Is(err, sql.ErrNoRows) {
+		redirectToErrorPageWithMessageAndStatusCode(w, "Tag not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("error getting tag: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	books, err := getBooksByFilter(db, bookFilter{Tag: slug})
+	if err != nil {
+		log.Printf("error getting books by tag: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	pageVariables := PageTagVariables{
+		Year:    now.Format("2006"),
+		SiteKey: captcha.SiteKey,
+		Kind:    "Etiqueta",
+		Name:    name,
+		Slug:    slug,
+		Results: books,
+	}
+
+	_, err = getCurrentUserID(r)
+	pageVariables.LoggedIn = err == nil
+
+	renderTagTemplate(w, "tag.html", pageVariables)
+}
+
+// GenrePage lists the books of a genre and of all its subgenres.
+func GenrePage(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	slug := slugify(mux.Vars(r)["genre"])
+
+	genres, err := getGenreTree(db, 0)
+	if err != nil {
+		log.Printf("error getting genres: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	var current *Genre
+	var subgenres []Genre
+	for i, genre := range genres {
+		if genre.Slug == slug {
+			current = &genres[i]
+		} else if current != nil && genre.ParentID != nil && *genre.ParentID == current.ID {
+			subgenres = append(subgenres, genre)
+		}
+	}
+
+	if current == nil {
+		redirectToErrorPageWithMessageAndStatusCode(w, "Genre not found", http.StatusNotFound)
+		return
+	}
+
+	books, err := getBooksByFilter(db, bookFilter{Genre: slug})
+	if err != nil {
+		log.Printf("error getting books by genre: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	pageVariables := PageTagVariables{
+		Year:      now.Format("2006"),
+		SiteKey:   captcha.SiteKey,
+		Kind:      "Género",
+		Name:      current.Path,
+		Slug:      slug,
+		Subgenres: subgenres,
+		Results:   books,
+	}
+
+	_, err = getCurrentUserID(r)
+	pageVariables.LoggedIn = err == nil
+
+	renderTagTemplate(w, "tag.html", pageVariables)
+}
+
+func AllTags(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	tags, err := getAllTags(db)
+	if err != nil {
+		log.Printf("error getting tags: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(tags)
+}
+
+func AllGenres(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	genres, err := getGenreTree(db, 0)
+	if err != nil {
+		log.Printf("error getting genres: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(genres)
+}
@@ -0,0 +1,456 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"leonlib/internal/captcha"
+
+	"github.com/gorilla/mux"
+)
+
+// trashPurgeInterval is how often the trash is checked for items older than the retention period.
+const trashPurgeInterval = 24 * time.Hour
+
+// TrashRetentionDays is how long deleted books and images stay in the trash. Zero keeps them until an admin purges
+// them.
+var TrashRetentionDays = 30
+
+var errNotInTrash = errors.New("not in the trash")
+
+type TrashedBook struct {
+	ID        int
+	Title     string
+	Author    string
+	Images    int
+	DeletedAt time.Time
+}
+
+type TrashedImage struct {
+	ImageID   int
+	BookID    int
+	BookTitle string
+	Image     string
+	DeletedAt time.Time
+}
+
+type PageTrashVariables struct {
+	Year          string
+	SiteKey       string
+	Books         []TrashedBook
+	Images        []TrashedImage
+	RetentionDays int
+	LoggedIn      bool
+}
+
+// PurgeOn is the day the automatic purge removes the item, or an empty string when the trash is never emptied.
+func (tb TrashedBook) PurgeOn() string {
+	return purgeDate(tb.DeletedAt)
+}
+
+func (ti TrashedImage) PurgeOn() string {
+	return purgeDate(ti.DeletedAt)
+}
+
+func purgeDate(deletedAt time.Time) string {
+	if TrashRetentionDays <= 0 {
+		return ""
+	}
+
+	return deletedAt.AddDate(0, 0, TrashRetentionDays).Format("2006-01-02")
+}
+
+// StartTrashPurger purges the trash now and once a day afterwards, deleting for good what has been there for more
+// than retentionDays. It does nothing when retentionDays is zero.
+func StartTrashPurger(db *sql.DB, retentionDays int) {
+	TrashRetentionDays = retentionDays
+	if retentionDays <= 0 {
+		return
+	}
+
+	purge := func() {
+		books, images, err := purgeTrash(db, retentionDays)
+		if err != nil {
+			log.Printf("error purging the trash: %v", err)
+			return
+		}
+		if books > 0 || images > 0 {
+			log.Printf("purged %d books and %d images from the trash", books, images)
+		}
+	}
+
+	purge()
+
+	go func() {
+		ticker := time.NewTicker(trashPurgeInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			purge()
+		}
+	}()
+}
+
+func getTrashedBooks(db *sql.DB) ([]TrashedBook, error) {
+	rows, err := db.Query(`SELECT b.id, b.title, b.author, b.deleted_at,
+			(SELECT COUNT(*) FROM book_images i WHERE i.book_id = b.id)
+		FROM books b
+		WHERE b.deleted_at IS NOT NULL
+		ORDER BY b.deleted_at DESC`)
+	if err != nil {
+		return []TrashedBook{}, err
+	}
+
+	defer rows.Close()
+
+	books := []TrashedBook{}
+	for rows.Next() {
+		var book TrashedBook
+		if err := rows.Scan(&book.ID, &book.Title, &book.Author, &book.DeletedAt, &book.Images); err != nil {
+			return []TrashedBook{}, err
+		}
+		books = append(books, book)
+	}
+
+	return books, rows.Err()
+}
+
+// getTrashedImages returns the images deleted on their own; the images of a deleted book go with it.
+func getTrashedImages(db *sql.DB) ([]TrashedImage, error) {
+	rows, err := db.Query(`SELECT i.image_id, i.book_id, b.title, i.image, i.deleted_at
+		FROM book_images i
+		JOIN books b ON b.id = i.book_id
+		WHERE i.deleted_at IS NOT NULL AND b.deleted_at IS NULL
+		ORDER BY i.deleted_at DESC`)
+	if err != nil {
+		return []TrashedImage{}, err
+	}
+
+	defer rows.Close()
+
+	images := []TrashedImage{}
+	for rows.Next() {
+		var image TrashedImage
+		var data []byte
+		if err := rows.Scan(&image.ImageID, &image.BookID, &image.BookTitle, &data, &image.DeletedAt); err != nil {
+			return []TrashedImage{}, err
+		}
+		image.Image = base64.StdEncoding.EncodeToString(data)
+		images = append(images, image)
+	}
+
+	return images, rows.Err()
+}
+
+func trashBook(db *sql.DB, bookID int) error {
+	result, err := db.Exec("UPDATE books SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL", bookID)
+	if err != nil {
+		return err
+	}
+
+	return expectOneRow(result, sql.ErrNoRows)
+}
+
+func trashImage(db *sql.DB, imageID int) error {
+	result, err := db.Exec("UPDATE book_images SET deleted_at = NOW() WHERE image_id = $1 AND deleted_at IS NULL", imageID)
+	if err != nil {
+		return err
+	}
+
+	return expectOneRow(result, sql.ErrNoRows)
+}
+
+func restoreBook(db *sql.DB, bookID int) error {
+	result, err := db.Exec("UPDATE books SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL", bookID)
+	if err != nil {
+		return err
+	}
+
+	return expectOneRow(result, errNotInTrash)
+}
+
+func restoreImage(db *sql.DB, imageID int) error {
+	result, err := db.Exec("UPDATE book_images SET deleted_at = NULL WHERE image_id = $1 AND deleted_at IS NOT NULL", imageID)
+	if err != nil {
+		return err
+	}
+
+	return expectOneRow(result, errNotInTrash)
+}
+
+func expectOneRow(result sql.Result, notFound error) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return notFound
+	}
+
+	return nil
+}
+
+// purgeBook deletes a book in the trash for good, with its images, likes, reviews and reading progress.
+func purgeBook(db *sql.DB, bookID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var deleted bool
+	if err := tx.QueryRow("SELECT deleted_at IS NOT NULL FROM books WHERE id = $1 FOR UPDATE", bookID).Scan(&deleted); err != nil {
+		return err
+	}
+	if !deleted {
+		return errNotInTrash
+	}
+
+	for _, table := range []string{"book_images", "book_likes", "book_reviews", "user_books"} {
+		if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE book_id = $1", table), bookID); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM books WHERE id = $1", bookID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM tags t WHERE NOT EXISTS (SELECT 1 FROM book_tags bt WHERE bt.tag_id = t.id)"); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if err := deleteOrphanWorks(db); err != nil {
+		log.Printf("error deleting orphan works: %v", err)
+	}
+
+	if err := deleteOrphanSeries(db); err != nil {
+		log.Printf("error deleting orphan series: %v", err)
+	}
+
+	return nil
+}
+
+func purgeImage(db *sql.DB, imageID int) error {
+	result, err := db.Exec("DELETE FROM book_images WHERE image_id = $1 AND deleted_at IS NOT NULL", imageID)
+	if err != nil {
+		return err
+	}
+
+	return expectOneRow(result, errNotInTrash)
+}
+
+// purgeTrash deletes for good the books and images that have been in the trash for more than retentionDays.
+func purgeTrash(db *sql.DB, retentionDays int) (int, int, error) {
+	rows, err := db.Query("SELECT id FROM books WHERE deleted_at < NOW() - make_interval(days => $1)", retentionDays)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var bookIDs []int
+	for rows.Next() {
+		var bookID int
+		if err := rows.Scan(&bookID); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		bookIDs = append(bookIDs, bookID)
+	}
+	rows.Close()
+
+	for _, bookID := range bookIDs {
+		subject, err := getTrashSubject(db, AuditBook, bookID)
+		if err != nil {
+			return 0, 0, fmt.Errorf("purging book %d: %w", bookID, err)
+		}
+
+		if err := purgeBook(db, bookID); err != nil {
+			return 0, 0, fmt.Errorf("purging book %d: %w", bookID, err)
+		}
+
+		recordAudit(db, nil, AuditPurge, AuditBook, bookID, subject, nil)
+	}
+
+	rows, err = db.Query(`DELETE FROM book_images WHERE deleted_at < NOW() - make_interval(days => $1)
+		RETURNING image_id, book_id`, retentionDays)
+	if err != nil {
+		return len(bookIDs), 0, err
+	}
+
+	defer rows.Close()
+
+	var images int
+	for rows.Next() {
+		var imageID, bookID int
+		if err := rows.Scan(&imageID, &bookID); err != nil {
+			return len(bookIDs), images, err
+		}
+		images++
+
+		recordAudit(db, nil, AuditPurge, AuditImage, imageID, map[string]interface{}{"book_id": bookID}, nil)
+	}
+
+	return len(bookIDs), images, rows.Err()
+}
+
+func parseTrashIDVar(r *http.Request, name string) (int, error) {
+	id, err := strconv.Atoi(mux.Vars(r)[name])
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %v", name, err)
+	}
+
+	return id, nil
+}
+
+func writeTrashError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Not found", http.StatusNotFound)
+	case errors.Is(err, errNotInTrash):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case isUniqueViolation(err):
+		http.Error(w, "Ya existe otro libro con ese ISBN", http.StatusConflict)
+	default:
+		log.Printf("error: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+	}
+}
+
+// getTrashSubject describes a book or image for the audit log before it is deleted, restored or purged.
+func getTrashSubject(db *sql.DB, entity AuditEntity, id int) (map[string]interface{}, error) {
+	if entity == AuditImage {
+		var bookID int
+		if err := db.QueryRow("SELECT book_id FROM book_images WHERE image_id = $1", id).Scan(&bookID); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"book_id": bookID}, nil
+	}
+
+	var title, author string
+	if err := db.QueryRow("SELECT title, author FROM books WHERE id = $1", id).Scan(&title, &author); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"title": title, "author": author}, nil
+}
+
+// trashHandler runs action on the entity with the id in the route variable name, for admins only, and records it in
+// the audit log.
+func trashHandler(db *sql.DB, w http.ResponseWriter, r *http.Request, name string, entity AuditEntity,
+	auditAction AuditAction, action func(*sql.DB, int) error) {
+	if !isAdmin(db, r) {
+		http.Error(w, "Only admins can manage the trash", http.StatusForbidden)
+		return
+	}
+
+	id, err := parseTrashIDVar(r, name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	subject, err := getTrashSubject(db, entity, id)
+	if err != nil {
+		writeTrashError(w, err)
+		return
+	}
+
+	if err := action(db, id); err != nil {
+		writeTrashError(w, err)
+		return
+	}
+
+	if auditAction == AuditRestore {
+		recordAudit(db, r, auditAction, entity, id, nil, subject)
+	} else {
+		recordAudit(db, r, auditAction, entity, id, subject, nil)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteBook moves a book to the trash.
+func DeleteBook(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	trashHandler(db, w, r, "book_id", AuditBook, AuditDelete, trashBook)
+}
+
+func RestoreBook(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	trashHandler(db, w, r, "book_id", AuditBook, AuditRestore, restoreBook)
+}
+
+func PurgeBook(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	trashHandler(db, w, r, "book_id", AuditBook, AuditPurge, purgeBook)
+}
+
+func RestoreImage(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	trashHandler(db, w, r, "image_id", AuditImage, AuditRestore, restoreImage)
+}
+
+func PurgeImage(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	trashHandler(db, w, r, "image_id", AuditImage, AuditPurge, purgeImage)
+}
+
+func TrashPage(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(db, r) {
+		redirectToErrorPageWithMessageAndStatusCode(w, "Only admins can manage the trash", http.StatusForbidden)
+		return
+	}
+
+	books, err := getTrashedBooks(db)
+	if err != nil {
+		log.Printf("error getting trashed books: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	images, err := getTrashedImages(db)
+	if err != nil {
+		log.Printf("error getting trashed images: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	pageVariables := PageTrashVariables{
+		Year:          now.Format("2006"),
+		SiteKey:       captcha.SiteKey,
+		Books:         books,
+		Images:        images,
+		RetentionDays: TrashRetentionDays,
+		LoggedIn:      true,
+	}
+
+	templateDir := os.Getenv("TEMPLATE_DIR")
+	if templateDir == "" {
+		templateDir = "internal/template" // default value for local development
+	}
+	templatePath := filepath.Join(templateDir, "admin_papelera.html")
+
+	t, err := template.ParseFiles(templatePath)
+	if err != nil {
+		log.Printf("template error: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "template error", http.StatusInternalServerError)
+		return
+	}
+
+	err = t.Execute(w, pageVariables)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("template error: %v", err)
+		return
+	}
+}
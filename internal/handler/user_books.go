@@ -0,0 +1,384 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"leonlib/internal/captcha"
+
+	"github.com/gorilla/mux"
+)
+
+// UserBook is the reading state of a book for a single user.
+type UserBook struct {
+	BookID          int           `json:"book_id"`
+	Status          ReadingStatus `json:"status"`
+	CurrentPage     *int          `json:"current_page"`
+	ProgressPercent *float64      `json:"progress_percent"`
+	StartedOn       string        `json:"started_on"`
+	FinishedOn      string        `json:"finished_on"`
+	RereadCount     int           `json:"reread_count"`
+	UpdatedAt       time.Time     `json:"updated_at"`
+}
+
+type ShelfBook struct {
+	Book     BookInfo
+	UserBook UserBook
+}
+
+type PageShelfVariables struct {
+	Year     string
+	SiteKey  string
+	Status   ReadingStatus
+	Results  []ShelfBook
+	LoggedIn bool
+}
+
+type userBookRequest struct {
+	Status          string   `json:"status"`
+	CurrentPage     *int     `json:"current_page"`
+	ProgressPercent *float64 `json:"progress_percent"`
+	StartedOn       string   `json:"started_on"`
+	FinishedOn      string   `json:"finished_on"`
+}
+
+const userBookColumns = `ub.book_id, ub.status, ub.current_page, ub.progress_percent, ub.started_on, ub.finished_on, ub.reread_count, ub.updated_at`
+
+func scanUserBook(row rowScanner) (UserBook, error) {
+	var userBook UserBook
+	var currentPage sql.NullInt64
+	var progressPercent sql.NullFloat64
+	var startedOn sql.NullTime
+	var finishedOn sql.NullTime
+
+	err := row.Scan(&userBook.BookID, &userBook.Status, &currentPage, &progressPercent, &startedOn, &finishedOn, &userBook.RereadCount, &userBook.UpdatedAt)
+	if err != nil {
+		return UserBook{}, err
+	}
+
+	userBook.setOptionalFields(currentPage, progressPercent, startedOn, finishedOn)
+
+	return userBook, nil
+}
+
+func (ub *UserBook) setOptionalFields(currentPage sql.NullInt64, progressPercent sql.NullFloat64, startedOn, finishedOn sql.NullTime) {
+	if currentPage.Valid {
+		page := int(currentPage.Int64)
+		ub.CurrentPage = &page
+	}
+	if progressPercent.Valid {
+		percent := progressPercent.Float64
+		ub.ProgressPercent = &percent
+	}
+	ub.StartedOn = formatOptionalDate(startedOn)
+	ub.FinishedOn = formatOptionalDate(finishedOn)
+}
+
+// getUserBook returns nil when the user has not tracked the book yet.
+func getUserBook(db *sql.DB, userID string, bookID int) (*UserBook, error) {
+	row := db.QueryRow(`SELECT `+userBookColumns+` FROM user_books ub WHERE ub.user_id = $1 AND ub.book_id = $2`, userID, bookID)
+
+	userBook, err := scanUserBook(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &userBook, nil
+}
+
+// saveUserBook applies the requested changes on top of the current state. Dates and progress that are not sent
+// keep their previous value; starting a reread bumps reread_count and marking a book as read completes it.
+func saveUserBook(db *sql.DB, userID string, bookID int, req userBookRequest) (UserBook, error) {
+	status, err := parseReadingStatus(req.Status)
+	if err != nil {
+		return UserBook{}, err
+	}
+
+	if req.CurrentPage != nil && *req.CurrentPage < 0 {
+		return UserBook{}, errors.New("current_page cannot be negative")
+	}
+
+	if req.ProgressPercent != nil && (*req.ProgressPercent < 0 || *req.ProgressPercent > 100) {
+		return UserBook{}, errors.New("progress_percent must be between 0 and 100")
+	}
+
+	startedOn, err := parseOptionalDate(req.StartedOn)
+	if err != nil {
+		return UserBook{}, err
+	}
+
+	finishedOn, err := parseOptionalDate(req.FinishedOn)
+	if err != nil {
+		return UserBook{}, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return UserBook{}, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	// Without this check a missing book fails on the foreign key, and a book in the trash would be saved.
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM books WHERE id = $1 AND deleted_at IS NULL)", bookID).Scan(&exists); err != nil {
+		return UserBook{}, err
+	}
+	if !exists {
+		return UserBook{}, fmt.Errorf("book %d: %w", bookID, sql.ErrNoRows)
+	}
+
+	var previousStatus ReadingStatus
+	var currentPage sql.NullInt64
+	var progressPercent sql.NullFloat64
+	var previousStartedOn sql.NullTime
+	var previousFinishedOn sql.NullTime
+	var rereadCount int
+
+	err = tx.QueryRow(`SELECT status, current_page, progress_percent, started_on, finished_on, reread_count
+		FROM user_books WHERE user_id = $1 AND book_id = $2 FOR UPDATE`, userID, bookID).
+		Scan(&previousStatus, &currentPage, &progressPercent, &previousStartedOn, &previousFinishedOn, &rereadCount)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return UserBook{}, err
+	}
+
+	today := sql.NullTime{Time: time.Now(), Valid: true}
+	statusChanged := status != previousStatus
+
+	if req.CurrentPage != nil {
+		currentPage = sql.NullInt64{Int64: int64(*req.CurrentPage), Valid: true}
+	}
+	if req.ProgressPercent != nil {
+		progressPercent = sql.NullFloat64{Float64: *req.ProgressPercent, Valid: true}
+	}
+
+	if status == Rereading && statusChanged {
+		rereadCount++
+		previousStartedOn = today
+		previousFinishedOn = sql.NullTime{}
+		if req.CurrentPage == nil {
+			currentPage = sql.NullInt64{}
+		}
+		if req.ProgressPercent == nil {
+			progressPercent = sql.NullFloat64{}
+		}
+	}
+
+	if !startedOn.Valid {
+		startedOn = previousStartedOn
+		if !startedOn.Valid && (status == Reading || status == Rereading) {
+			startedOn = today
+		}
+	}
+
+	if !finishedOn.Valid {
+		finishedOn = previousFinishedOn
+		if status == Read && statusChanged {
+			finishedOn = today
+		}
+	}
+
+	if status == Read && req.ProgressPercent == nil {
+		progressPercent = sql.NullFloat64{Float64: 100, Valid: true}
+	}
+
+	if startedOn.Valid && finishedOn.Valid && finishedOn.Time.Before(startedOn.Time) {
+		return UserBook{}, errors.New("finished_on cannot be before started_on")
+	}
+
+	row := tx.QueryRow(`INSERT INTO user_books AS ub (user_id, book_id, status, current_page, progress_percent, started_on, finished_on, reread_count, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW())
+		ON CONFLICT (user_id, book_id) DO UPDATE SET
+			status = EXCLUDED.status,
+			current_page = EXCLUDED.current_page,
+			progress_percent = EXCLUDED.progress_percent,
+			started_on = EXCLUDED.started_on,
+			finished_on = EXCLUDED.finished_on,
+			reread_count = EXCLUDED.reread_count,
+			updated_at = EXCLUDED.updated_at
+		RETURNING `+userBookColumns,
+		userID, bookID, status, currentPage, progressPercent, startedOn, finishedOn, rereadCount)
+
+	userBook, err := scanUserBook(row)
+	if err != nil {
+		return UserBook{}, err
+	}
+
+	return userBook, tx.Commit()
+}
+
+func getShelfByUser(db *sql.DB, userID string, status ReadingStatus) ([]ShelfBook, error) {
+	rows, err := db.Query(`SELECT `+bookColumns+`, `+userBookColumns+`
+		FROM user_books ub
+		JOIN books b ON b.id = ub.book_id
+		WHERE ub.user_id = $1 AND b.deleted_at IS NULL AND ($2 = '' OR ub.status::text = $2)
+		ORDER BY ub.updated_at DESC`, userID, string(status))
+	if err != nil {
+		return []ShelfBook{}, err
+	}
+
+	defer rows.Close()
+
+	var shelf []ShelfBook
+	for rows.Next() {
+		var userBook UserBook
+		var currentPage sql.NullInt64
+		var progressPercent sql.NullFloat64
+		var startedOn sql.NullTime
+		var finishedOn sql.NullTime
+
+		bookInfo, err := scanBookInfo(rows, &userBook.BookID, &userBook.Status, &currentPage, &progressPercent, &startedOn, &finishedOn, &userBook.RereadCount, &userBook.UpdatedAt)
+		if err != nil {
+			return []ShelfBook{}, err
+		}
+		userBook.setOptionalFields(currentPage, progressPercent, startedOn, finishedOn)
+
+		bookImages, err := getImagesByBookID(db, bookInfo.ID)
+		if err != nil {
+			return []ShelfBook{}, err
+		}
+		bookInfo.Base64Images = bookImages
+
+		shelf = append(shelf, ShelfBook{Book: bookInfo, UserBook: userBook})
+	}
+
+	return shelf, rows.Err()
+}
+
+func parseBookIDVar(r *http.Request) (int, error) {
+	bookID, err := strconv.Atoi(mux.Vars(r)["book_id"])
+	if err != nil {
+		return 0, fmt.Errorf("invalid book_id: %v", err)
+	}
+
+	return bookID, nil
+}
+
+func MyBookStatus(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	userID, err := getCurrentUserID(r)
+	if err != nil {
+		writeUnauthenticated(w)
+		return
+	}
+
+	bookID, err := parseBookIDVar(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userBook, err := getUserBook(db, userID, bookID)
+	if err != nil {
+		log.Printf("error getting user book: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if userBook == nil {
+		userBook = &UserBook{BookID: bookID, Status: ToRead}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(userBook)
+}
+
+func UpdateMyBookProgress(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	userID, err := getCurrentUserID(r)
+	if err != nil {
+		writeUnauthenticated(w)
+		return
+	}
+
+	bookID, err := parseBookIDVar(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req userBookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Error al decodificar el cuerpo de la solicitud", http.StatusBadRequest)
+		return
+	}
+
+	userBook, err := saveUserBook(db, userID, bookID, req)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Book not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("error saving user book: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(userBook)
+}
+
+func MyShelfPage(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	userID, err := getCurrentUserID(r)
+	if err != nil {
+		log.Printf("(MyShelfPage) User is not logged in: %v", err)
+		http.Redirect(w, r, "/ingresar", http.StatusSeeOther)
+		return
+	}
+
+	var status ReadingStatus
+	if statusParam := r.URL.Query().Get("status"); statusParam != "" {
+		status, err = parseReadingStatus(statusParam)
+		if err != nil {
+			redirectToErrorPageWithMessageAndStatusCode(w, "Wrong status", http.StatusBadRequest)
+			return
+		}
+	}
+
+	shelf, err := getShelfByUser(db, userID, status)
+	if err != nil {
+		log.Printf("error getting shelf: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	pageVariables := PageShelfVariables{
+		Year:     now.Format("2006"),
+		SiteKey:  captcha.SiteKey,
+		Status:   status,
+		Results:  shelf,
+		LoggedIn: true,
+	}
+
+	templateDir := os.Getenv("TEMPLATE_DIR")
+	if templateDir == "" {
+		templateDir = "internal/template" // default value for local development
+	}
+	templatePath := filepath.Join(templateDir, "mi_estante.html")
+
+	t, err := template.ParseFiles(templatePath)
+	if err != nil {
+		log.Printf("template error: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "template error", http.StatusInternalServerError)
+		return
+	}
+
+	err = t.Execute(w, pageVariables)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("template error: %v", err)
+		return
+	}
+}
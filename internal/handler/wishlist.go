@@ -0,0 +1,355 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"leonlib/internal/captcha"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxWishlistTitleLength  = 255
+	maxWishlistSeenAtLength = 500
+	defaultWishlistPriority = 2
+)
+
+// WishlistItem is a book we want to buy. AcquiredBookID points to the catalog book once it is bought.
+type WishlistItem struct {
+	ID             int        `json:"id"`
+	Title          string     `json:"title"`
+	Author         string     `json:"author"`
+	ISBN13         string     `json:"isbn_13,omitempty"`
+	Publisher      string     `json:"publisher,omitempty"`
+	Priority       int        `json:"priority"`
+	TargetPrice    *Price     `json:"target_price,omitempty"`
+	Currency       string     `json:"currency,omitempty"`
+	SeenAt         string     `json:"seen_at,omitempty"`
+	Notes          string     `json:"notes,omitempty"`
+	AddedBy        string     `json:"added_by,omitempty"`
+	AddedByUserID  string     `json:"-"`
+	CreatedAt      time.Time  `json:"created_at"`
+	AcquiredBookID int        `json:"acquired_book_id,omitempty"`
+	AcquiredAt     *time.Time `json:"acquired_at,omitempty"`
+}
+
+type PageWishlistVariables struct {
+	Year     string
+	SiteKey  string
+	Pending  []WishlistItem
+	Acquired []WishlistItem
+	LoggedIn bool
+	IsAdmin  bool
+}
+
+var errInvalidWishlistItem = errors.New("invalid wishlist item")
+
+type wishlistRequest struct {
+	Title       string `json:"title"`
+	Author      string `json:"author"`
+	ISBN        string `json:"isbn"`
+	Publisher   string `json:"publisher"`
+	Priority    int    `json:"priority"`
+	TargetPrice string `json:"target_price"`
+	Currency    string `json:"currency"`
+	SeenAt      string `json:"seen_at"`
+	Notes       string `json:"notes"`
+}
+
+const wishlistColumns = `w.id, w.title, w.author, COALESCE(w.isbn_13, ''), COALESCE(w.publisher, ''), w.priority,
+	w.target_price, COALESCE(w.currency, ''), COALESCE(w.seen_at, ''), COALESCE(w.notes, ''),
+	COALESCE(u.name, u.email, ''), COALESCE(w.added_by, ''), w.created_at, COALESCE(w.acquired_book_id, 0), w.acquired_at`
+
+func (wi WishlistItem) PriorityLabel() string {
+	switch wi.Priority {
+	case 1:
+		return "Alta"
+	case 2:
+		return "Media"
+	case 3:
+		return "Baja"
+	default:
+		return "Desconocida"
+	}
+}
+
+func scanWishlistItem(row rowScanner) (WishlistItem, error) {
+	var item WishlistItem
+	var targetPrice sql.NullFloat64
+	var acquiredAt sql.NullTime
+	err := row.Scan(&item.ID, &item.Title, &item.Author, &item.ISBN13, &item.Publisher, &item.Priority,
+		&targetPrice, &item.Currency, &item.SeenAt, &item.Notes, &item.AddedBy, &item.AddedByUserID, &item.CreatedAt,
+		&item.AcquiredBookID, &acquiredAt)
+	if err != nil {
+		return WishlistItem{}, err
+	}
+
+	if targetPrice.Valid {
+		price := Price(targetPrice.Float64)
+		item.TargetPrice = &price
+	}
+	if acquiredAt.Valid {
+		item.AcquiredAt = &acquiredAt.Time
+	}
+
+	return item, nil
+}
+
+// getWishlist returns the items still to buy, the most wanted first, or the bought ones, the latest first.
+func getWishlist(db *sql.DB, acquired bool) ([]WishlistItem, error) {
+	order := `w.priority, w.created_at`
+	if acquired {
+		order = `w.acquired_at DESC`
+	}
+
+	rows, err := db.Query(`SELECT `+wishlistColumns+`
+		FROM wishlist_items w
+		LEFT JOIN users u ON u.user_id = w.added_by
+		WHERE (w.acquired_at IS NOT NULL) = $1
+		ORDER BY `+order, acquired)
+	if err != nil {
+		return []WishlistItem{}, err
+	}
+
+	defer rows.Close()
+
+	items := []WishlistItem{}
+	for rows.Next() {
+		item, err := scanWishlistItem(rows)
+		if err != nil {
+			return []WishlistItem{}, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+func getWishlistItem(db *sql.DB, itemID int) (WishlistItem, error) {
+	return scanWishlistItem(db.QueryRow(`SELECT `+wishlistColumns+`
+		FROM wishlist_items w
+		LEFT JOIN users u ON u.user_id = w.added_by
+		WHERE w.id = $1`, itemID))
+}
+
+func createWishlistItem(db *sql.DB, userID string, req wishlistRequest) (WishlistItem, error) {
+	title := strings.TrimSpace(req.Title)
+	author := strings.TrimSpace(req.Author)
+	if title == "" || author == "" || len(title) > maxWishlistTitleLength || len(author) > maxWishlistTitleLength {
+		return WishlistItem{}, fmt.Errorf("%w: title and author are required", errInvalidWishlistItem)
+	}
+
+	bookISBN, err := parseBookISBN(req.ISBN)
+	if err != nil {
+		return WishlistItem{}, fmt.Errorf("%w: %v", errInvalidWishlistItem, err)
+	}
+
+	priority := req.Priority
+	if priority == 0 {
+		priority = defaultWishlistPriority
+	}
+	if priority < 1 || priority > 3 {
+		return WishlistItem{}, fmt.Errorf("%w: priority must be 1 (high), 2 (medium) or 3 (low)", errInvalidWishlistItem)
+	}
+
+	targetPrice, err := parsePrice("target_price", req.TargetPrice)
+	if err != nil {
+		return WishlistItem{}, fmt.Errorf("%w: %v", errInvalidWishlistItem, err)
+	}
+
+	currency, err := parseCurrency(req.Currency, targetPrice)
+	if err != nil {
+		return WishlistItem{}, fmt.Errorf("%w: %v", errInvalidWishlistItem, err)
+	}
+
+	seenAt := nullableString(req.SeenAt)
+	if len(seenAt.String) > maxWishlistSeenAtLength {
+		return WishlistItem{}, fmt.Errorf("%w: seen_at is too long", errInvalidWishlistItem)
+	}
+
+	var itemID int
+	err = db.QueryRow(`INSERT INTO wishlist_items(title, author, isbn_13, publisher, priority, target_price, currency, seen_at, notes, added_by)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id`, title, author, bookISBN.ISBN13, nullableString(req.Publisher), priority, targetPrice, currency,
+		seenAt, nullableString(req.Notes), userID).Scan(&itemID)
+	if err != nil {
+		return WishlistItem{}, err
+	}
+
+	return getWishlistItem(db, itemID)
+}
+
+// markWishlistAcquired links the item to the catalog book it became; it is a no-op for items already acquired.
+func markWishlistAcquired(db execer, itemID, bookID int) error {
+	_, err := db.Exec(`UPDATE wishlist_items SET acquired_book_id = $1, acquired_at = NOW()
+		WHERE id = $2 AND acquired_at IS NULL`, bookID, itemID)
+
+	return err
+}
+
+func parseWishlistItemIDVar(r *http.Request) (int, error) {
+	itemID, err := strconv.Atoi(mux.Vars(r)["item_id"])
+	if err != nil {
+		return 0, fmt.Errorf("invalid item_id: %v", err)
+	}
+
+	return itemID, nil
+}
+
+func Wishlist(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	items, err := getWishlist(db, r.URL.Query().Get("acquired") == "true")
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(items)
+}
+
+// WishlistItemInfo returns one item; add_book.html uses it to pre-fill the form of a book marked as acquired.
+func WishlistItemInfo(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	itemID, err := parseWishlistItemIDVar(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	item, err := getWishlistItem(db, itemID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Wishlist item not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(item)
+}
+
+func AddWishlistItem(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	userID, err := getCurrentUserID(r)
+	if err != nil {
+		writeUnauthenticated(w)
+		return
+	}
+
+	var req wishlistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Error al decodificar el cuerpo de la solicitud", http.StatusBadRequest)
+		return
+	}
+
+	item, err := createWishlistItem(db, userID, req)
+	if errors.Is(err, errInvalidWishlistItem) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("error adding wishlist item: %v", err)
+		writeErrorGeneralStatus(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(item)
+}
+
+// DeleteWishlistItem removes an item; only an admin or the user who added it can do it.
+func DeleteWishlistItem(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	userID, err := getCurrentUserID(r)
+	if err != nil {
+		writeUnauthenticated(w)
+		return
+	}
+
+	itemID, err := parseWishlistItemIDVar(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	item, err := getWishlistItem(db, itemID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Wishlist item not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeErrorGeneralStatus(w, err)
+		return
+	}
+
+	if item.AddedByUserID != userID && !isAdmin(db, r) {
+		http.Error(w, "Only admins can remove items added by someone else", http.StatusForbidden)
+		return
+	}
+
+	if _, err := db.Exec("DELETE FROM wishlist_items WHERE id = $1", itemID); err != nil {
+		writeErrorGeneralStatus(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func WishlistPage(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	pending, err := getWishlist(db, false)
+	if err != nil {
+		log.Printf("error getting wishlist: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	acquired, err := getWishlist(db, true)
+	if err != nil {
+		log.Printf("error getting acquired wishlist items: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "error getting information from the database", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	pageVariables := PageWishlistVariables{
+		Year:     now.Format("2006"),
+		SiteKey:  captcha.SiteKey,
+		Pending:  pending,
+		Acquired: acquired,
+		IsAdmin:  isAdmin(db, r),
+	}
+
+	_, err = getCurrentUserID(r)
+	pageVariables.LoggedIn = err == nil
+
+	templateDir := os.Getenv("TEMPLATE_DIR")
+	if templateDir == "" {
+		templateDir = "internal/template" // default value for local development
+	}
+	templatePath := filepath.Join(templateDir, "deseos.html")
+
+	t, err := template.ParseFiles(templatePath)
+	if err != nil {
+		log.Printf("template error: %v", err)
+		redirectToErrorPageWithMessageAndStatusCode(w, "template error", http.StatusInternalServerError)
+		return
+	}
+
+	err = t.Execute(w, pageVariables)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("template error: %v", err)
+		return
+	}
+}
@@ -0,0 +1,270 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const maxLanguageLength = 10
+
+// bookFormats maps the values accepted in books.format to the label shown in the pages.
+var bookFormats = map[string]string{
+	"hardcover": "Pasta dura",
+	"paperback": "Pasta blanda",
+	"ebook":     "Libro electrónico",
+	"audiobook": "Audiolibro",
+}
+
+// Work groups every edition of the same title, for example the hardcover and the translation of a novel.
+type Work struct {
+	ID       int           `json:"id"`
+	Title    string        `json:"title"`
+	Author   string        `json:"author"`
+	Likes    int           `json:"likes"`
+	Rating   RatingSummary `json:"rating"`
+	Editions []Edition     `json:"editions"`
+}
+
+type Edition struct {
+	ID            int    `json:"id"`
+	Title         string `json:"title"`
+	Publisher     string `json:"publisher"`
+	PublishedYear int    `json:"published_year"`
+	Translator    string `json:"translator"`
+	Format        string `json:"format"`
+	Language      string `json:"language"`
+	ISBN13        string `json:"isbn_13"`
+}
+
+// editionForm holds the edition fields shared by the add and modify forms.
+type editionForm struct {
+	Publisher  sql.NullString
+	Year       sql.NullInt64
+	PageCount  sql.NullInt64
+	Translator sql.NullString
+	Format     sql.NullString
+	Language   sql.NullString
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// FormatLabel returns the Spanish name of the edition format, or an empty string when it is unknown.
+func (bi BookInfo) FormatLabel() string {
+	return bookFormats[bi.Format]
+}
+
+func parseBookFormat(input string) (sql.NullString, error) {
+	input = strings.ToLower(strings.TrimSpace(input))
+	if input == "" {
+		return sql.NullString{}, nil
+	}
+
+	if _, ok := bookFormats[input]; !ok {
+		return sql.NullString{}, fmt.Errorf("invalid format: %q", input)
+	}
+
+	return sql.NullString{String: input, Valid: true}, nil
+}
+
+func parseLanguage(input string) (sql.NullString, error) {
+	language := nullableString(strings.ToLower(input))
+	if len(language.String) > maxLanguageLength {
+		return sql.NullString{}, errors.New("language must be a language code such as \"es\" or \"en\"")
+	}
+
+	return language, nil
+}
+
+// parseEditionForm reads the publisher, published_year, page_count, translator, format and language fields.
+func parseEditionForm(r *http.Request) (editionForm, error) {
+	year, err := parseOptionalPositiveInt("published_year", r.FormValue("published_year"))
+	if err != nil {
+		return editionForm{}, err
+	}
+
+	pageCount, err := parseOptionalPositiveInt("page_count", r.FormValue("page_count"))
+	if err != nil {
+		return editionForm{}, err
+	}
+
+	format, err := parseBookFormat(r.FormValue("format"))
+	if err != nil {
+		return editionForm{}, err
+	}
+
+	language, err := parseLanguage(r.FormValue("language"))
+	if err != nil {
+		return editionForm{}, err
+	}
+
+	return editionForm{
+		Publisher:  nullableString(r.FormValue("publisher")),
+		Year:       year,
+		PageCount:  pageCount,
+		Translator: nullableString(r.FormValue("translator")),
+		Format:     format,
+		Language:   language,
+	}, nil
+}
+
+// findOrCreateWork returns the work with the given title and author, ignoring case, creating it if needed.
+func findOrCreateWork(q queryRower, title, author string) (int, error) {
+	var workID int
+	err := q.QueryRow(`INSERT INTO works(title, author) VALUES($1, $2)
+		ON CONFLICT ((lower(title)), (lower(author))) DO UPDATE SET title = works.title
+		RETURNING id`, strings.TrimSpace(title), strings.TrimSpace(author)).Scan(&workID)
+
+	return workID, err
+}
+
+// resolveWorkID uses the work chosen in the form when there is one; otherwise the book goes to the work
+// that matches its title and author.
+func resolveWorkID(db queryRower, input, title, author string) (int, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return findOrCreateWork(db, title, author)
+	}
+
+	workID, err := strconv.Atoi(input)
+	if err != nil {
+		return 0, fmt.Errorf("invalid work_id: %v", err)
+	}
+
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM works WHERE id = $1)", workID).Scan(&exists); err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, fmt.Errorf("work %d does not exist", workID)
+	}
+
+	return workID, nil
+}
+
+func deleteOrphanWorks(db execer) error {
+	_, err := db.Exec("DELETE FROM works w WHERE NOT EXISTS (SELECT 1 FROM books b WHERE b.work_id = w.id)")
+
+	return err
+}
+
+// getOtherEditions returns the editions of the work except the book being displayed.
+func getOtherEditions(db *sql.DB, workID, bookID int) ([]BookInfo, error) {
+	rows, err := db.Query(`SELECT `+bookColumns+` FROM books b
+		WHERE b.work_id = $1 AND b.id <> $2 AND b.deleted_at IS NULL
+		ORDER BY b.published_year NULLS LAST, b.id`, workID, bookID)
+	if err != nil {
+		return []BookInfo{}, err
+	}
+
+	defer rows.Close()
+
+	var editions []BookInfo
+	for rows.Next() {
+		bookInfo, err := scanBookInfo(rows)
+		if err != nil {
+			return []BookInfo{}, err
+		}
+		editions = append(editions, bookInfo)
+	}
+
+	return editions, rows.Err()
+}
+
+// getWorkLikesCount counts the users that liked any edition of the work.
+func getWorkLikesCount(db *sql.DB, workID int) (int, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(DISTINCT l.user_id)
+		FROM book_likes l
+		JOIN books b ON b.id = l.book_id
+		WHERE b.work_id = $1 AND b.deleted_at IS NULL`, workID).Scan(&count)
+
+	return count, err
+}
+
+// getWorkRatingSummary averages the visible reviews of every edition of the work.
+func getWorkRatingSummary(db *sql.DB, workID int) (RatingSummary, error) {
+	var summary RatingSummary
+	var average sql.NullFloat64
+
+	err := db.QueryRow(`SELECT AVG(r.rating), COUNT(*)
+		FROM book_reviews r
+		JOIN books b ON b.id = r.book_id
+		WHERE b.work_id = $1 AND b.deleted_at IS NULL AND NOT r.hidden`, workID).Scan(&average, &summary.Count)
+	if err != nil {
+		return RatingSummary{}, err
+	}
+
+	summary.Average = math.Round(average.Float64*10) / 10
+
+	return summary, nil
+}
+
+func getWork(db *sql.DB, workID int) (Work, error) {
+	var work Work
+	err := db.QueryRow("SELECT id, title, author FROM works WHERE id = $1", workID).Scan(&work.ID, &work.Title, &work.Author)
+	if err != nil {
+		return Work{}, err
+	}
+
+	editions, err := getOtherEditions(db, workID, 0)
+	if err != nil {
+		return Work{}, err
+	}
+
+	work.Editions = []Edition{}
+	for _, book := range editions {
+		work.Editions = append(work.Editions, Edition{
+			ID:            book.ID,
+			Title:         book.Title,
+			Publisher:     book.Publisher,
+			PublishedYear: book.PublishedYear,
+			Translator:    book.Translator,
+			Format:        book.Format,
+			Language:      book.Language,
+			ISBN13:        book.ISBN13,
+		})
+	}
+
+	if work.Likes, err = getWorkLikesCount(db, workID); err != nil {
+		return Work{}, err
+	}
+
+	if work.Rating, err = getWorkRatingSummary(db, workID); err != nil {
+		return Work{}, err
+	}
+
+	return work, nil
+}
+
+func WorkInfo(db *sql.DB, w http.ResponseWriter, r *http.Request) {
+	workID, err := strconv.Atoi(mux.Vars(r)["work_id"])
+	if err != nil {
+		http.Error(w, "Invalid work_id", http.StatusBadRequest)
+		return
+	}
+
+	work, err := getWork(db, workID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Work not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("error getting work: %v", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(work)
+}
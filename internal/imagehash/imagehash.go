@@ -0,0 +1,64 @@
+// Package imagehash computes perceptual hashes to find pictures of the same cover
+package imagehash
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math/bits"
+)
+
+const size = 8
+
+// ErrTooSmall is returned for images smaller than 8x8 pixels
+var ErrTooSmall = errors.New("imagehash: image is too small")
+
+// Average returns the 64 bit average hash of the image: it is shrunk to 8x8 gray pixels and every bit tells
+// whether a pixel is brighter than the mean. Resized or recompressed copies of a picture get the same or a close hash.
+func Average(data []byte) (uint64, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+
+	bounds := img.Bounds()
+	if bounds.Dx() < size || bounds.Dy() < size {
+		return 0, ErrTooSmall
+	}
+
+	var cells [size * size]float64
+	var counts [size * size]int
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		cellY := (y - bounds.Min.Y) * size / bounds.Dy()
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			cellX := (x - bounds.Min.X) * size / bounds.Dx()
+			r, g, b, _ := img.At(x, y).RGBA()
+			cells[cellY*size+cellX] += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+			counts[cellY*size+cellX]++
+		}
+	}
+
+	var mean float64
+	for i := range cells {
+		cells[i] /= float64(counts[i])
+		mean += cells[i]
+	}
+	mean /= size * size
+
+	var hash uint64
+	for i, cell := range cells {
+		if cell > mean {
+			hash |= 1 << uint(i)
+		}
+	}
+
+	return hash, nil
+}
+
+// Distance is the number of different bits between two hashes; 0 means the same picture.
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
@@ -0,0 +1,100 @@
+package imagehash
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// halves draws an image with a dark left half and a light right half, or the other way around.
+func halves(width, height int, darkLeft bool) image.Image {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			dark := x < width/2
+			if !darkLeft {
+				dark = !dark
+			}
+			if dark {
+				img.SetGray(x, y, color.Gray{Y: 20})
+			} else {
+				img.SetGray(x, y, color.Gray{Y: 230})
+			}
+		}
+	}
+
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 60}); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestAverage(t *testing.T) {
+	// The right half of every row is brighter than the mean.
+	const lightRight = 0xf0f0f0f0f0f0f0f0
+
+	tests := []struct {
+		name string
+		data []byte
+		want uint64
+		err  error
+	}{
+		{"png", encodePNG(t, halves(64, 96, true)), lightRight, nil},
+		{"resized", encodePNG(t, halves(200, 300, true)), lightRight, nil},
+		{"jpeg", encodeJPEG(t, halves(64, 96, true)), lightRight, nil},
+		{"inverted", encodePNG(t, halves(64, 96, false)), ^uint64(lightRight), nil},
+		{"too small", encodePNG(t, halves(4, 4, true)), 0, ErrTooSmall},
+	}
+
+	for _, test := range tests {
+		got, err := Average(test.data)
+		if got != test.want || !errors.Is(err, test.err) {
+			t.Errorf("Average(%s) = %#x, %v, want %#x, %v", test.name, got, err, test.want, test.err)
+		}
+	}
+
+	if _, err := Average([]byte("not an image")); err == nil {
+		t.Error("Average() of invalid data should fail")
+	}
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b uint64
+		want int
+	}{
+		{0, 0, 0},
+		{0xf0f0f0f0f0f0f0f0, 0xf0f0f0f0f0f0f0f0, 0},
+		{0xf0f0f0f0f0f0f0f0, 0xf0f0f0f0f0f0f0f1, 1},
+		{0, ^uint64(0), 64},
+	}
+
+	for _, test := range tests {
+		if got := Distance(test.a, test.b); got != test.want {
+			t.Errorf("Distance(%#x, %#x) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
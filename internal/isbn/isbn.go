@@ -0,0 +1,145 @@
+// Package isbn holds functions to validate and normalize ISBN-10 and ISBN-13 codes
+package isbn
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrInvalidLength is returned when the code does not have 10 or 13 digits
+	ErrInvalidLength = errors.New("isbn: must have 10 or 13 digits")
+	// ErrInvalidChecksum is returned when the check digit does not match
+	ErrInvalidChecksum = errors.New("isbn: invalid check digit")
+	// ErrInvalidCharacter is returned when the code has something other than digits (or a final X for ISBN-10)
+	ErrInvalidCharacter = errors.New("isbn: invalid character")
+	// ErrNoISBN10 is returned when an ISBN-13 has no ISBN-10 equivalent (979 prefix)
+	ErrNoISBN10 = errors.New("isbn: only 978 ISBN-13 codes have an ISBN-10 equivalent")
+)
+
+// Clean removes hyphens and spaces, and upper-cases the ISBN-10 "x" check digit.
+func Clean(input string) string {
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(input) {
+		switch {
+		case r == '-' || r == ' ':
+			continue
+		case r == 'x':
+			b.WriteRune('X')
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+func isbn10CheckDigit(first9 string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(first9[i]-'0') * (10 - i)
+	}
+
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return 'X'
+	}
+
+	return byte('0' + check)
+}
+
+func isbn13CheckDigit(first12 string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		digit := int(first12[i] - '0')
+		if i%2 == 1 {
+			digit *= 3
+		}
+		sum += digit
+	}
+
+	return byte('0' + (10-sum%10)%10)
+}
+
+func allDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ValidateISBN10 checks an already cleaned ISBN-10.
+func ValidateISBN10(code string) error {
+	if len(code) != 10 {
+		return ErrInvalidLength
+	}
+
+	last := code[9]
+	if !allDigits(code[:9]) || !(last == 'X' || (last >= '0' && last <= '9')) {
+		return ErrInvalidCharacter
+	}
+
+	if isbn10CheckDigit(code[:9]) != last {
+		return ErrInvalidChecksum
+	}
+
+	return nil
+}
+
+// ValidateISBN13 checks an already cleaned ISBN-13.
+func ValidateISBN13(code string) error {
+	if len(code) != 13 {
+		return ErrInvalidLength
+	}
+
+	if !allDigits(code) {
+		return ErrInvalidCharacter
+	}
+
+	if isbn13CheckDigit(code[:12]) != code[12] {
+		return ErrInvalidChecksum
+	}
+
+	return nil
+}
+
+// ToISBN13 converts a valid ISBN-10 into its ISBN-13 form.
+func ToISBN13(isbn10 string) string {
+	first12 := "978" + isbn10[:9]
+
+	return first12 + string(isbn13CheckDigit(first12))
+}
+
+// ToISBN10 converts a valid 978 ISBN-13 into its ISBN-10 form.
+func ToISBN10(isbn13 string) (string, error) {
+	if !strings.HasPrefix(isbn13, "978") {
+		return "", ErrNoISBN10
+	}
+
+	first9 := isbn13[3:12]
+
+	return first9 + string(isbn10CheckDigit(first9)), nil
+}
+
+// Normalize validates an ISBN-10 or ISBN-13 in any common notation and returns it as ISBN-13.
+func Normalize(input string) (string, error) {
+	code := Clean(input)
+
+	switch len(code) {
+	case 10:
+		if err := ValidateISBN10(code); err != nil {
+			return "", err
+		}
+		return ToISBN13(code), nil
+	case 13:
+		if err := ValidateISBN13(code); err != nil {
+			return "", err
+		}
+		return code, nil
+	default:
+		return "", ErrInvalidLength
+	}
+}
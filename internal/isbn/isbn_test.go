@@ -0,0 +1,121 @@
+package isbn
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"0-306-40615-2", "0306406152"},
+		{" 978 0 306 40615 7 ", "9780306406157"},
+		{"0-8044-2957-x", "080442957X"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if got := Clean(test.input); got != test.want {
+			t.Errorf("Clean(%q) = %q, want %q", test.input, got, test.want)
+		}
+	}
+}
+
+func TestValidateISBN10(t *testing.T) {
+	tests := []struct {
+		code string
+		want error
+	}{
+		{"0306406152", nil},
+		{"080442957X", nil},
+		{"843760494X", nil},
+		{"0306406153", ErrInvalidChecksum},
+		{"0804429570", ErrInvalidChecksum},
+		{"X306406152", ErrInvalidCharacter},
+		{"03064061A2", ErrInvalidCharacter},
+		{"030640615", ErrInvalidLength},
+		{"9780306406157", ErrInvalidLength},
+	}
+
+	for _, test := range tests {
+		if err := ValidateISBN10(test.code); !errors.Is(err, test.want) {
+			t.Errorf("ValidateISBN10(%q) = %v, want %v", test.code, err, test.want)
+		}
+	}
+}
+
+func TestValidateISBN13(t *testing.T) {
+	tests := []struct {
+		code string
+		want error
+	}{
+		{"9780306406157", nil},
+		{"9791090636071", nil},
+		{"9780306406158", ErrInvalidChecksum},
+		{"978030640615X", ErrInvalidCharacter},
+		{"978030640615", ErrInvalidLength},
+	}
+
+	for _, test := range tests {
+		if err := ValidateISBN13(test.code); !errors.Is(err, test.want) {
+			t.Errorf("ValidateISBN13(%q) = %v, want %v", test.code, err, test.want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+		err   error
+	}{
+		{"0-306-40615-2", "9780306406157", nil},
+		{"978-0-306-40615-7", "9780306406157", nil},
+		{"0-8044-2957-x", "9780804429573", nil},
+		{"84-376-0494-X", "9788437604947", nil},
+		{"979-10-90636-07-1", "9791090636071", nil},
+		{"0-306-40615-3", "", ErrInvalidChecksum},
+		{"978-0-306-40615-8", "", ErrInvalidChecksum},
+		{"12345", "", ErrInvalidLength},
+		{"", "", ErrInvalidLength},
+	}
+
+	for _, test := range tests {
+		got, err := Normalize(test.input)
+		if got != test.want || !errors.Is(err, test.err) {
+			t.Errorf("Normalize(%q) = %q, %v, want %q, %v", test.input, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestToISBN10(t *testing.T) {
+	tests := []struct {
+		isbn13 string
+		want   string
+		err    error
+	}{
+		{"9780306406157", "0306406152", nil},
+		{"9780804429573", "080442957X", nil},
+		{"9791090636071", "", ErrNoISBN10},
+	}
+
+	for _, test := range tests {
+		got, err := ToISBN10(test.isbn13)
+		if got != test.want || !errors.Is(err, test.err) {
+			t.Errorf("ToISBN10(%q) = %q, %v, want %q, %v", test.isbn13, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestToISBN13(t *testing.T) {
+	for isbn10, want := range map[string]string{
+		"0306406152": "9780306406157",
+		"080442957X": "9780804429573",
+	} {
+		if got := ToISBN13(isbn10); got != want {
+			t.Errorf("ToISBN13(%q) = %q, want %q", isbn10, got, want)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+// Package metadata holds the providers used to propose book information from external catalogs
+package metadata
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// ErrNotFound is returned by a Provider when the catalog has no match for the query
+var ErrNotFound = errors.New("metadata: book not found")
+
+// Query describes the book to look up. ISBN takes precedence over Title and Author when present.
+type Query struct {
+	ISBN   string
+	Title  string
+	Author string
+}
+
+func (q Query) IsEmpty() bool {
+	return strings.TrimSpace(q.ISBN) == "" && strings.TrimSpace(q.Title) == ""
+}
+
+// Book is the information proposed by a Provider; every field may be empty.
+type Book struct {
+	Title     string   `json:"title"`
+	Authors   []string `json:"authors"`
+	Publisher string   `json:"publisher"`
+	Year      int      `json:"year"`
+	PageCount int      `json:"page_count"`
+	Subjects  []string `json:"subjects"`
+	ISBN      string   `json:"isbn"`
+	CoverURL  string   `json:"cover_url"`
+}
+
+// Provider looks up book metadata in an external catalog.
+type Provider interface {
+	// Lookup returns the best match for the query or ErrNotFound.
+	Lookup(ctx context.Context, query Query) (Book, error)
+	// Cover downloads a cover image previously returned in Book.CoverURL.
+	Cover(ctx context.Context, coverURL string) ([]byte, error)
+}
@@ -0,0 +1,181 @@
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultOpenLibraryURL is the public Open Library API
+	DefaultOpenLibraryURL = "https://openlibrary.org"
+	// DefaultOpenLibraryCoversURL is the public Open Library covers service
+	DefaultOpenLibraryCoversURL = "https://covers.openlibrary.org"
+
+	maxSubjects   = 10
+	maxCoverBytes = 5 << 20
+)
+
+const searchFields = "title,author_name,publisher,first_publish_year,number_of_pages_median,subject,cover_i,isbn"
+
+// OpenLibrary is a Provider backed by the Open Library search API.
+type OpenLibrary struct {
+	BaseURL   string
+	CoversURL string
+	Client    *http.Client
+}
+
+type openLibrarySearchResponse struct {
+	NumFound int                 `json:"numFound"`
+	Docs     []openLibrarySearch `json:"docs"`
+}
+
+type openLibrarySearch struct {
+	Title            string   `json:"title"`
+	AuthorName       []string `json:"author_name"`
+	Publisher        []string `json:"publisher"`
+	FirstPublishYear int      `json:"first_publish_year"`
+	NumberOfPages    int      `json:"number_of_pages_median"`
+	Subject          []string `json:"subject"`
+	CoverID          int      `json:"cover_i"`
+	ISBN             []string `json:"isbn"`
+}
+
+// NewOpenLibrary creates a client for the given API and covers base URLs; empty values use the public services.
+func NewOpenLibrary(baseURL, coversURL string) *OpenLibrary {
+	if baseURL == "" {
+		baseURL = DefaultOpenLibraryURL
+	}
+
+	if coversURL == "" {
+		coversURL = DefaultOpenLibraryCoversURL
+	}
+
+	return &OpenLibrary{
+		BaseURL:   strings.TrimRight(baseURL, "/"),
+		CoversURL: strings.TrimRight(coversURL, "/"),
+		Client:    &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (ol *OpenLibrary) get(ctx context.Context, endpoint string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "leonlib (https://github.com/leogtzr/leonlib)")
+
+	resp, err := ol.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("openlibrary: unexpected status %d from %s", resp.StatusCode, endpoint)
+	}
+
+	return resp, nil
+}
+
+func (ol *OpenLibrary) Lookup(ctx context.Context, query Query) (Book, error) {
+	if query.IsEmpty() {
+		return Book{}, errors.New("openlibrary: an ISBN or a title is required")
+	}
+
+	params := url.Values{}
+	params.Set("fields", searchFields)
+	params.Set("limit", "1")
+	if isbn := strings.TrimSpace(query.ISBN); isbn != "" {
+		params.Set("isbn", isbn)
+	} else {
+		params.Set("title", strings.TrimSpace(query.Title))
+		if author := strings.TrimSpace(query.Author); author != "" {
+			params.Set("author", author)
+		}
+	}
+
+	resp, err := ol.get(ctx, ol.BaseURL+"/search.json?"+params.Encode())
+	if err != nil {
+		return Book{}, err
+	}
+	defer resp.Body.Close()
+
+	var result openLibrarySearchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Book{}, fmt.Errorf("openlibrary: error decoding search response: %v", err)
+	}
+
+	if len(result.Docs) == 0 {
+		return Book{}, ErrNotFound
+	}
+
+	doc := result.Docs[0]
+	book := Book{
+		Title:     doc.Title,
+		Authors:   doc.AuthorName,
+		Year:      doc.FirstPublishYear,
+		PageCount: doc.NumberOfPages,
+		Subjects:  doc.Subject,
+	}
+
+	if len(doc.Publisher) > 0 {
+		book.Publisher = doc.Publisher[0]
+	}
+
+	if len(book.Subjects) > maxSubjects {
+		book.Subjects = book.Subjects[:maxSubjects]
+	}
+
+	if query.ISBN != "" {
+		book.ISBN = strings.TrimSpace(query.ISBN)
+	} else {
+		for _, isbn := range doc.ISBN {
+			if len(isbn) == 13 {
+				book.ISBN = isbn
+				break
+			}
+		}
+	}
+
+	if doc.CoverID > 0 {
+		book.CoverURL = fmt.Sprintf("%s/b/id/%d-L.jpg", ol.CoversURL, doc.CoverID)
+	}
+
+	return book, nil
+}
+
+// Cover only downloads images from the configured covers service, so callers can pass along user supplied URLs.
+func (ol *OpenLibrary) Cover(ctx context.Context, coverURL string) ([]byte, error) {
+	if !strings.HasPrefix(coverURL, ol.CoversURL+"/") {
+		return nil, fmt.Errorf("openlibrary: cover url %q is not from %s", coverURL, ol.CoversURL)
+	}
+
+	resp, err := ol.get(ctx, coverURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	image, err := io.ReadAll(io.LimitReader(resp.Body, maxCoverBytes+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(image) > maxCoverBytes {
+		return nil, errors.New("openlibrary: cover image is too big")
+	}
+
+	return image, nil
+}
@@ -0,0 +1,119 @@
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var coverImage = []byte("\x89PNG fake cover")
+
+func newTestOpenLibrary(t *testing.T) *OpenLibrary {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/search.json", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch {
+		case query.Get("isbn") == "9780306406157":
+			fmt.Fprint(w, `{"numFound":1,"docs":[{"title":"Pedro Páramo","author_name":["Juan Rulfo"],
+				"publisher":["Cátedra","RM"],"first_publish_year":1955,"number_of_pages_median":128,
+				"cover_i":42,"isbn":["0306406152","9780306406157"]}]}`)
+		case query.Get("title") == "El llano en llamas" && query.Get("author") == "Juan Rulfo":
+			fmt.Fprint(w, `{"numFound":1,"docs":[{"title":"El llano en llamas","author_name":["Juan Rulfo"],
+				"isbn":["8437604478","9788437604473"]}]}`)
+		default:
+			fmt.Fprint(w, `{"numFound":0,"docs":[]}`)
+		}
+	})
+	mux.HandleFunc("/b/id/42-L.jpg", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(coverImage)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return NewOpenLibrary(server.URL, server.URL)
+}
+
+func TestOpenLibraryLookupByISBN(t *testing.T) {
+	ol := newTestOpenLibrary(t)
+
+	book, err := ol.Lookup(context.Background(), Query{ISBN: "9780306406157", Title: "ignored"})
+	if err != nil {
+		t.Fatalf("Lookup() error = %v", err)
+	}
+
+	if book.Title != "Pedro Páramo" || book.Publisher != "Cátedra" || book.Year != 1955 || book.PageCount != 128 {
+		t.Errorf("Lookup() = %+v", book)
+	}
+
+	if book.ISBN != "9780306406157" {
+		t.Errorf("ISBN = %q, want the queried one", book.ISBN)
+	}
+
+	if want := ol.CoversURL + "/b/id/42-L.jpg"; book.CoverURL != want {
+		t.Errorf("CoverURL = %q, want %q", book.CoverURL, want)
+	}
+}
+
+func TestOpenLibraryLookupByTitle(t *testing.T) {
+	ol := newTestOpenLibrary(t)
+
+	book, err := ol.Lookup(context.Background(), Query{Title: "El llano en llamas", Author: "Juan Rulfo"})
+	if err != nil {
+		t.Fatalf("Lookup() error = %v", err)
+	}
+
+	if book.ISBN != "9788437604473" {
+		t.Errorf("ISBN = %q, want the first ISBN-13 of the result", book.ISBN)
+	}
+
+	if book.CoverURL != "" {
+		t.Errorf("CoverURL = %q, want none", book.CoverURL)
+	}
+}
+
+func TestOpenLibraryLookupNotFound(t *testing.T) {
+	ol := newTestOpenLibrary(t)
+
+	tests := []Query{
+		{ISBN: "9791090636071"},
+		{Title: "Un libro que no existe"},
+	}
+
+	for _, query := range tests {
+		if _, err := ol.Lookup(context.Background(), query); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Lookup(%+v) error = %v, want ErrNotFound", query, err)
+		}
+	}
+
+	if _, err := ol.Lookup(context.Background(), Query{}); err == nil {
+		t.Error("Lookup() with an empty query should fail")
+	}
+}
+
+func TestOpenLibraryCover(t *testing.T) {
+	ol := newTestOpenLibrary(t)
+
+	image, err := ol.Cover(context.Background(), ol.CoversURL+"/b/id/42-L.jpg")
+	if err != nil {
+		t.Fatalf("Cover() error = %v", err)
+	}
+
+	if !bytes.Equal(image, coverImage) {
+		t.Errorf("Cover() = %q, want %q", image, coverImage)
+	}
+
+	if _, err := ol.Cover(context.Background(), ol.CoversURL+"/b/id/7-L.jpg"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Cover() of a missing image error = %v, want ErrNotFound", err)
+	}
+
+	if _, err := ol.Cover(context.Background(), "https://example.com/cover.jpg"); err == nil {
+		t.Error("Cover() should refuse URLs outside the covers service")
+	}
+}
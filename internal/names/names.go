@@ -0,0 +1,200 @@
+// Package names holds functions to compare person names typed in different ways
+package names
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// accents must stay in sync with the author_slug SQL function.
+var accents = strings.NewReplacer(
+	"á", "a", "à", "a", "ä", "a", "â", "a", "ã", "a", "å", "a",
+	"é", "e", "è", "e", "ë", "e", "ê", "e",
+	"í", "i", "ì", "i", "ï", "i", "î", "i",
+	"ó", "o", "ò", "o", "ö", "o", "ô", "o", "õ", "o",
+	"ú", "u", "ù", "u", "ü", "u", "û", "u",
+	"ñ", "n", "ç", "c", "ý", "y",
+)
+
+// StripAccents lower-cases the name and replaces the accented letters with their plain version.
+func StripAccents(name string) string {
+	return accents.Replace(strings.ToLower(name))
+}
+
+func words(text string) []string {
+	return strings.FieldsFunc(StripAccents(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Fold returns the words of any text, such as a title, without case, accents or punctuation.
+func Fold(text string) string {
+	return strings.Join(words(text), " ")
+}
+
+// IsSuffix reports whether the text is a suffix written after a comma at the end of a name, such as "Jr.".
+func IsSuffix(text string) bool {
+	switch strings.Join(words(text), "") {
+	case "jr", "sr", "ii", "iii", "iv", "phd":
+		return true
+	default:
+		return false
+	}
+}
+
+// Tokens returns the words of the name without accents or punctuation. "Last, First" is read as "First Last", and a
+// suffix such as ", Jr." stays at the end.
+func Tokens(name string) []string {
+	var suffixes []string
+	for {
+		comma := strings.LastIndex(name, ",")
+		if comma < 0 || !IsSuffix(name[comma+1:]) {
+			break
+		}
+		suffixes = append([]string{name[comma+1:]}, suffixes...)
+		name = name[:comma]
+	}
+
+	if last, first, found := strings.Cut(name, ","); found {
+		name = first + " " + last
+	}
+
+	return words(strings.Join(append([]string{name}, suffixes...), " "))
+}
+
+// Key is the folded form of a name: same case, no accents, no punctuation and "First Last" order.
+func Key(name string) string {
+	return strings.Join(Tokens(name), " ")
+}
+
+// Levenshtein returns the number of single letter edits needed to turn a into b.
+func Levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(rb)]
+}
+
+// maxDistance is the number of typos tolerated for a key of the given length.
+func maxDistance(length int) int {
+	switch {
+	case length < 8:
+		return 0
+	case length < 12:
+		return 1
+	default:
+		return 2
+	}
+}
+
+func sameTokens(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	sortedA := append([]string(nil), a...)
+	sortedB := append([]string(nil), b...)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+
+	return strings.Join(sortedA, " ") == strings.Join(sortedB, " ")
+}
+
+// initialsMatch reports whether the names share the last name and every other word of the shorter name
+// is the initial of the matching word in the longer one, as in "J. R. R. Tolkien" and "John Ronald Reuel Tolkien".
+func initialsMatch(a, b []string) bool {
+	if len(a) < 2 || len(a) != len(b) || a[len(a)-1] != b[len(b)-1] {
+		return false
+	}
+
+	usesInitials := false
+	for i := 0; i < len(a)-1; i++ {
+		switch {
+		case a[i] == b[i]:
+		case len([]rune(a[i])) == 1 && strings.HasPrefix(b[i], a[i]):
+			usesInitials = true
+		case len([]rune(b[i])) == 1 && strings.HasPrefix(a[i], b[i]):
+			usesInitials = true
+		default:
+			return false
+		}
+	}
+
+	return usesInitials
+}
+
+// Similar reports whether two names probably belong to the same person.
+func Similar(a, b string) bool {
+	tokensA, tokensB := Tokens(a), Tokens(b)
+	keyA, keyB := strings.Join(tokensA, " "), strings.Join(tokensB, " ")
+	if keyA == "" || keyB == "" {
+		return false
+	}
+
+	if keyA == keyB || sameTokens(tokensA, tokensB) || initialsMatch(tokensA, tokensB) {
+		return true
+	}
+
+	return Levenshtein(keyA, keyB) <= maxDistance(min(len(keyA), len(keyB)))
+}
+
+// Cluster groups the indexes of the names that are similar to each other, directly or through another name.
+// Names without any similar name are left out.
+func Cluster(list []string) [][]int {
+	parent := make([]int, len(list))
+	for i := range parent {
+		parent[i] = i
+	}
+
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := range list {
+		for j := i + 1; j < len(list); j++ {
+			if Similar(list[i], list[j]) {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	groups := map[int][]int{}
+	var roots []int
+	for i := range list {
+		root := find(i)
+		if _, ok := groups[root]; !ok {
+			roots = append(roots, root)
+		}
+		groups[root] = append(groups[root], i)
+	}
+
+	var clusters [][]int
+	for _, root := range roots {
+		if len(groups[root]) > 1 {
+			clusters = append(clusters, groups[root])
+		}
+	}
+
+	return clusters
+}
@@ -0,0 +1,112 @@
+package names
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Gabriel García Márquez", "gabriel garcia marquez"},
+		{"García Márquez, Gabriel", "gabriel garcia marquez"},
+		{"  J.R.R. Tolkien ", "j r r tolkien"},
+		{"Muñoz Molina, Antonio", "antonio munoz molina"},
+		{"Henry S. Warren, JR.", "henry s warren jr"},
+		{"Warren, Henry S., Jr.", "henry s warren jr"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if got := Key(test.name); got != test.want {
+			t.Errorf("Key(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Cien años de soledad", "cien anos de soledad"},
+		{"¿Quién mató a Palomino Molero?", "quien mato a palomino molero"},
+		{"Patria, I", "patria i"},
+	}
+
+	for _, test := range tests {
+		if got := Fold(test.text); got != test.want {
+			t.Errorf("Fold(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"rulfo", "", 5},
+		{"rulfo", "rulfo", 0},
+		{"rulfo", "rolfo", 1},
+		{"kitten", "sitting", 3},
+		{"ñandu", "nandu", 1},
+	}
+
+	for _, test := range tests {
+		if got := Levenshtein(test.a, test.b); got != test.want {
+			t.Errorf("Levenshtein(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestSimilar(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"Gabriel García Márquez", "gabriel garcia marquez", true},
+		{"García Márquez, Gabriel", "Gabriel García Márquez", true},
+		{"Márquez García Gabriel", "Gabriel García Márquez", true},
+		{"J. R. R. Tolkien", "John Ronald Reuel Tolkien", true},
+		{"Gabriel Garcia Marques", "Gabriel García Márquez", true},
+		{"Jorge Luis Borjes", "Jorge Luis Borges", true},
+		{"Juan Rulfo", "Juan Rolfo", true},
+		{"Ana Paz", "Ana Pez", false},
+		{"Octavio Paz", "Juan Rulfo", false},
+		{"Christopher Tolkien", "J. R. R. Tolkien", false},
+		{"", "", false},
+	}
+
+	for _, test := range tests {
+		if got := Similar(test.a, test.b); got != test.want {
+			t.Errorf("Similar(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestCluster(t *testing.T) {
+	tests := []struct {
+		list []string
+		want [][]int
+	}{
+		{[]string{"Juan Rulfo", "Octavio Paz"}, nil},
+		{
+			[]string{"Gabriel García Márquez", "Octavio Paz", "García Márquez, Gabriel", "Paz, Octavio", "Juan Rulfo"},
+			[][]int{{0, 2}, {1, 3}},
+		},
+		{
+			[]string{"Jorge Luis Borges", "Jorge Luis Borjes", "Borjes, Jorge Luis"},
+			[][]int{{0, 1, 2}},
+		},
+	}
+
+	for _, test := range tests {
+		if got := Cluster(test.list); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Cluster(%q) = %v, want %v", test.list, got, test.want)
+		}
+	}
+}
@@ -66,7 +66,7 @@ func initRoutes(db *sql.DB) {
 			"GET",
 			"/admin/initdb",
 			func(w http.ResponseWriter, r *http.Request) {
-				handler.CreateDBFromFile(db, w)
+				handler.CreateDBFromFile(db, w, r)
 			},
 		},
 		Router{
@@ -205,6 +205,686 @@ func initRoutes(db *sql.DB) {
 				handler.BooksList(db, w, r)
 			},
 		},
+		Router{
+			"My Liked Books Page",
+			"GET",
+			"/mis-libros",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.MyLikedBooksPage(db, w, r)
+			},
+		},
+		Router{
+			"My Liked Books",
+			"GET",
+			"/api/me/likes",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.MyLikedBooks(db, w, r)
+			},
+		},
+		Router{
+			"Popular Books Page",
+			"GET",
+			"/popular",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.PopularBooksPage(db, w, r)
+			},
+		},
+		Router{
+			"Popular Books",
+			"GET",
+			"/api/books/popular",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.PopularBooks(db, w, r)
+			},
+		},
+		Router{
+			"My Shelf Page",
+			"GET",
+			"/mi-estante",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.MyShelfPage(db, w, r)
+			},
+		},
+		Router{
+			"My Book Status",
+			"GET",
+			"/api/me/books/{book_id}",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.MyBookStatus(db, w, r)
+			},
+		},
+		Router{
+			"Update My Book Progress",
+			"PUT",
+			"/api/me/books/{book_id}",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.UpdateMyBookProgress(db, w, r)
+			},
+		},
+		Router{
+			"Book Reviews",
+			"GET",
+			"/api/books/{book_id}/reviews",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.BookReviews(db, w, r)
+			},
+		},
+		Router{
+			"Save Review",
+			"POST",
+			"/api/books/{book_id}/reviews",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.SaveReview(db, w, r)
+			},
+		},
+		Router{
+			"Delete Review",
+			"DELETE",
+			"/api/reviews/{review_id}",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.DeleteReview(db, w, r)
+			},
+		},
+		Router{
+			"Moderate Review",
+			"PUT",
+			"/api/reviews/{review_id}/moderation",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.ModerateReview(db, w, r)
+			},
+		},
+		Router{
+			"Book by ISBN",
+			"GET",
+			"/api/v1/books/isbn/{isbn}",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.BookByISBN(db, w, r)
+			},
+		},
+		Router{
+			"Lookup Metadata",
+			"GET",
+			"/api/metadata/lookup",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.LookupMetadata(db, w, r)
+			},
+		},
+		Router{
+			"Enrich Books",
+			"POST",
+			"/admin/enrich",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.EnrichBooks(db, w, r)
+			},
+		},
+		Router{
+			"Enrich Status",
+			"GET",
+			"/api/enrich/{job_id}",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.EnrichStatus(db, w, r)
+			},
+		},
+		Router{
+			"Work Info",
+			"GET",
+			"/api/works/{work_id}",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.WorkInfo(db, w, r)
+			},
+		},
+		Router{
+			"Author page",
+			"GET",
+			"/autor/{slug}",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.AuthorPage(db, w, r)
+			},
+		},
+		Router{
+			"Book Credits",
+			"GET",
+			"/api/books/{book_id}/authors",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.BookCredits(db, w, r)
+			},
+		},
+		Router{
+			"Update Book Credits",
+			"PUT",
+			"/api/books/{book_id}/authors",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.UpdateBookCredits(db, w, r)
+			},
+		},
+		Router{
+			"Author Aliases page",
+			"GET",
+			"/admin/autores",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.AuthorAliasesPage(db, w, r)
+			},
+		},
+		Router{
+			"Author Clusters",
+			"GET",
+			"/admin/authors/clusters",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.AuthorClusters(db, w, r)
+			},
+		},
+		Router{
+			"Merge Authors",
+			"POST",
+			"/admin/authors/merge",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.MergeAuthors(db, w, r)
+			},
+		},
+		Router{
+			"Duplicates page",
+			"GET",
+			"/admin/duplicados",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.DuplicatesPage(db, w, r)
+			},
+		},
+		Router{
+			"Book Duplicates",
+			"GET",
+			"/admin/books/duplicates",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.BookDuplicates(db, w, r)
+			},
+		},
+		Router{
+			"Dismiss Duplicate",
+			"POST",
+			"/admin/books/duplicates/dismiss",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.DismissDuplicate(db, w, r)
+			},
+		},
+		Router{
+			"Merge Books",
+			"POST",
+			"/admin/books/merge",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.MergeBooks(db, w, r)
+			},
+		},
+		Router{
+			"Tags",
+			"GET",
+			"/tags",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.TagsPage(db, w, r)
+			},
+		},
+		Router{
+			"Tag",
+			"GET",
+			"/tags/{tag}",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.TagPage(db, w, r)
+			},
+		},
+		Router{
+			"Genre",
+			"GET",
+			"/generos/{genre}",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.GenrePage(db, w, r)
+			},
+		},
+		Router{
+			"All Tags",
+			"GET",
+			"/api/tags",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.AllTags(db, w, r)
+			},
+		},
+		Router{
+			"All Genres",
+			"GET",
+			"/api/genres",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.AllGenres(db, w, r)
+			},
+		},
+		Router{
+			"Series Index",
+			"GET",
+			"/series",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.SeriesIndexPage(db, w, r)
+			},
+		},
+		Router{
+			"Series",
+			"GET",
+			"/series/{slug}",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.SeriesPage(db, w, r)
+			},
+		},
+		Router{
+			"Series Info",
+			"GET",
+			"/api/series/{slug}",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.SeriesInfo(db, w, r)
+			},
+		},
+		Router{
+			"Locations",
+			"GET",
+			"/ubicaciones",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.LocationsPage(db, w, r)
+			},
+		},
+		Router{
+			"Location",
+			"GET",
+			"/ubicaciones/{location_id}",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.LocationPage(db, w, r)
+			},
+		},
+		Router{
+			"All Locations",
+			"GET",
+			"/api/locations",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.AllLocations(db, w, r)
+			},
+		},
+		Router{
+			"Create Location",
+			"POST",
+			"/api/locations",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.CreateLocation(db, w, r)
+			},
+		},
+		Router{
+			"Update Location",
+			"PUT",
+			"/api/locations/{location_id}",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.UpdateLocation(db, w, r)
+			},
+		},
+		Router{
+			"Delete Location",
+			"DELETE",
+			"/api/locations/{location_id}",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.DeleteLocation(db, w, r)
+			},
+		},
+		Router{
+			"Book Loans",
+			"GET",
+			"/api/books/{book_id}/loans",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.BookLoans(db, w, r)
+			},
+		},
+		Router{
+			"Lend Book",
+			"POST",
+			"/api/books/{book_id}/loans",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.LendBook(db, w, r)
+			},
+		},
+		Router{
+			"Request Loan",
+			"POST",
+			"/api/books/{book_id}/loan_requests",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.RequestLoan(db, w, r)
+			},
+		},
+		Router{
+			"Overdue Loans",
+			"GET",
+			"/api/loans/overdue",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.OverdueLoans(db, w, r)
+			},
+		},
+		Router{
+			"Approve Loan",
+			"POST",
+			"/api/loans/{loan_id}/approve",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.ApproveLoan(db, w, r)
+			},
+		},
+		Router{
+			"Reject Loan",
+			"POST",
+			"/api/loans/{loan_id}/reject",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.RejectLoan(db, w, r)
+			},
+		},
+		Router{
+			"Return Loan",
+			"POST",
+			"/api/loans/{loan_id}/return",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.ReturnLoan(db, w, r)
+			},
+		},
+		Router{
+			"Loans",
+			"GET",
+			"/admin/prestamos",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.LoansPage(db, w, r)
+			},
+		},
+		Router{
+			"Wishlist Page",
+			"GET",
+			"/deseos",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.WishlistPage(db, w, r)
+			},
+		},
+		Router{
+			"Wishlist",
+			"GET",
+			"/api/wishlist",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.Wishlist(db, w, r)
+			},
+		},
+		Router{
+			"Add Wishlist Item",
+			"POST",
+			"/api/wishlist",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.AddWishlistItem(db, w, r)
+			},
+		},
+		Router{
+			"Wishlist Item",
+			"GET",
+			"/api/wishlist/{item_id}",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.WishlistItemInfo(db, w, r)
+			},
+		},
+		Router{
+			"Delete Wishlist Item",
+			"DELETE",
+			"/api/wishlist/{item_id}",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.DeleteWishlistItem(db, w, r)
+			},
+		},
+		Router{
+			"Spending Report",
+			"GET",
+			"/api/reports/spending",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.SpendingReport(db, w, r)
+			},
+		},
+		Router{
+			"Spending",
+			"GET",
+			"/admin/gastos",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.SpendingPage(db, w, r)
+			},
+		},
+		Router{
+			"Delete Book",
+			"DELETE",
+			"/api/books/{book_id}",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.DeleteBook(db, w, r)
+			},
+		},
+		Router{
+			"Restore Book",
+			"POST",
+			"/api/trash/books/{book_id}/restore",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.RestoreBook(db, w, r)
+			},
+		},
+		Router{
+			"Purge Book",
+			"DELETE",
+			"/api/trash/books/{book_id}",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.PurgeBook(db, w, r)
+			},
+		},
+		Router{
+			"Restore Image",
+			"POST",
+			"/api/trash/images/{image_id}/restore",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.RestoreImage(db, w, r)
+			},
+		},
+		Router{
+			"Purge Image",
+			"DELETE",
+			"/api/trash/images/{image_id}",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.PurgeImage(db, w, r)
+			},
+		},
+		Router{
+			"Trash",
+			"GET",
+			"/admin/papelera",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.TrashPage(db, w, r)
+			},
+		},
+		Router{
+			"Audit Log",
+			"GET",
+			"/api/audit",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.AuditLog(db, w, r)
+			},
+		},
+		Router{
+			"Audit",
+			"GET",
+			"/admin/auditoria",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.AuditPage(db, w, r)
+			},
+		},
+		Router{
+			"Book Revisions",
+			"GET",
+			"/api/books/{book_id}/revisions",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.BookRevisions(db, w, r)
+			},
+		},
+		Router{
+			"Revert Book",
+			"POST",
+			"/api/books/{book_id}/revisions/{revision}/revert",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.RevertBook(db, w, r)
+			},
+		},
+		Router{
+			"Import Status",
+			"GET",
+			"/api/imports/{job_id}",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.ImportStatus(db, w, r)
+			},
+		},
+		Router{
+			"Export TOML",
+			"GET",
+			"/admin/export.toml",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.ExportTOML(db, w, r)
+			},
+		},
+		Router{
+			"Export Zip",
+			"GET",
+			"/admin/export.zip",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.ExportZip(db, w, r)
+			},
+		},
+		Router{
+			"Catalog Page",
+			"GET",
+			"/admin/catalogo",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.CatalogPage(db, w, r)
+			},
+		},
+		Router{
+			"Catalog Export",
+			"GET",
+			"/api/catalog/export",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.CatalogExport(db, w, r)
+			},
+		},
+		Router{
+			"Catalog Import",
+			"POST",
+			"/api/catalog/import",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.CatalogImport(db, w, r)
+			},
+		},
+		Router{
+			"Goodreads Page",
+			"GET",
+			"/goodreads",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.GoodreadsPage(db, w, r)
+			},
+		},
+		Router{
+			"Goodreads Preview",
+			"POST",
+			"/api/goodreads/preview",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.GoodreadsPreview(db, w, r)
+			},
+		},
+		Router{
+			"Goodreads Import",
+			"POST",
+			"/api/goodreads/import",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.GoodreadsImport(db, w, r)
+			},
+		},
+		Router{
+			"OPDS Root",
+			"GET",
+			"/opds",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.OPDSRoot(db, w, r)
+			},
+		},
+		Router{
+			"OPDS Authors",
+			"GET",
+			"/opds/authors",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.OPDSAuthors(db, w, r)
+			},
+		},
+		Router{
+			"OPDS Author",
+			"GET",
+			"/opds/authors/{slug}",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.OPDSAuthor(db, w, r)
+			},
+		},
+		Router{
+			"OPDS Tags",
+			"GET",
+			"/opds/tags",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.OPDSTags(db, w, r)
+			},
+		},
+		Router{
+			"OPDS Tag",
+			"GET",
+			"/opds/tags/{tag}",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.OPDSTag(db, w, r)
+			},
+		},
+		Router{
+			"OPDS Recent",
+			"GET",
+			"/opds/recent",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.OPDSRecent(db, w, r)
+			},
+		},
+		Router{
+			"OPDS Popular",
+			"GET",
+			"/opds/popular",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.OPDSPopular(db, w, r)
+			},
+		},
+		Router{
+			"OPDS Cover",
+			"GET",
+			"/opds/covers/{image_id}",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.OPDSCover(db, w, r)
+			},
+		},
+		Router{
+			"Metadata Proposals",
+			"GET",
+			"/api/metadata/proposals",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.MetadataProposals(db, w, r)
+			},
+		},
+		Router{
+			"Accept Metadata Proposal",
+			"POST",
+			"/api/metadata/proposals/{proposal_id}/accept",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.AcceptMetadataProposal(db, w, r)
+			},
+		},
+		Router{
+			"Reject Metadata Proposal",
+			"DELETE",
+			"/api/metadata/proposals/{proposal_id}",
+			func(w http.ResponseWriter, r *http.Request) {
+				handler.RejectMetadataProposal(db, w, r)
+			},
+		},
 		Router{
 			"Remove Image",
 			"POST",